@@ -1,7 +1,9 @@
 package actions
 
 import (
-	"brm/localization"
+	"brm/audit"
+	"brm/config"
+	"brm/fsys"
 	"brm/trash"
 	"errors"
 	"fmt"
@@ -10,21 +12,42 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
+	"syscall"
 )
 
-var (
-	ErrRemoveRoot      = errors.New(localization.GetMessage("err_remove_root"))
-	ErrRemoveTrashSelf = errors.New(localization.GetMessage("err_remove_trash_self"))
-)
+type DeleteOptions struct {
+	ForceProtected bool
+	// Dedup stores the files of the item in the blob store when set.
+	Dedup *DedupOptions
+	// ConfirmEvict is asked before entries are evicted under the prompt
+	// quota policy; without it nothing is evicted.
+	ConfirmEvict func(evict []trash.TrashInfo) bool
+	// OnEvict is told about every entry evicted to make room.
+	OnEvict func(evicted trash.TrashInfo)
+	// Jobs is how many items of a batch are moved at once; below two they
+	// are moved one by one.
+	Jobs int
+	// CopyRate caps the bytes per second a batch writes into the trash when
+	// it has to copy, e.g. across filesystems. Zero means no cap.
+	CopyRate int64
+}
 
-func GetTrashPath() (string, error) {
+// trashDir is where the default trash lives, ~/.trash. Unlike GetTrashPath
+// it creates nothing.
+func trashDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
+	return filepath.Join(home, ".trash"), nil
+}
 
-	trashPath := filepath.Join(home, ".trash")
+func GetTrashPath() (string, error) {
+	trashPath, err := trashDir()
+	if err != nil {
+		return "", err
+	}
 
 	info, err := os.Stat(trashPath)
 	if os.IsNotExist(err) {
@@ -41,7 +64,13 @@ func GetTrashPath() (string, error) {
 	return trashPath, nil
 }
 
-func getUniquePath(dir, baseName string) (string, error) {
+func getUniquePath(vfs fsys.FS, dir, baseName string) (string, error) {
+	return uniquePath(vfs, dir, baseName, nil)
+}
+
+// uniquePath is getUniquePath that also skips the names taken reports as
+// taken, e.g. reserved by another item of a parallel batch.
+func uniquePath(vfs fsys.FS, dir, baseName string, taken func(name string) bool) (string, error) {
 	ext := filepath.Ext(baseName)
 	name := strings.TrimSuffix(baseName, ext)
 
@@ -50,23 +79,73 @@ func getUniquePath(dir, baseName string) (string, error) {
 
 	for {
 		fullPath := filepath.Join(dir, uniqueName)
-		_, err := os.Stat(fullPath)
-		if os.IsNotExist(err) {
+		free := taken == nil || !taken(uniqueName)
+		if free {
+			var err error
+			if free, err = isFreeName(vfs, fullPath); err != nil {
+				return "", err
+			}
+		}
+		if free {
 			return fullPath, nil
-		} else if err != nil {
-			return "", err
 		}
 		uniqueName = fmt.Sprintf("%s_%d%s", name, counter, ext)
 		counter++
 	}
 }
 
+// isFreeName reports whether neither path nor an archived or encrypted item
+// stored under that name exists.
+func isFreeName(vfs fsys.FS, path string) (bool, error) {
+	if filepath.Base(path) == trash.BlobDirName {
+		return false, nil
+	}
+	for _, candidate := range []string{path, path + archiveSuffix, path + encryptedSuffix} {
+		_, err := vfs.Lstat(candidate)
+		if err == nil {
+			return false, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
 func MoveDir(src, dst string) error {
-	if err := os.Rename(src, dst); err == nil {
-		return nil
+	return moveDir(fsys.OS{}, src, dst)
+}
+
+// moveDir renames src to dst and, across filesystems, copies the whole tree
+// before removing src, so a failed copy never leaves src half moved.
+func moveDir(vfs fsys.FS, src, dst string) error {
+	err := vfs.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	if err := copyTree(vfs, src, dst); err != nil {
+		_ = vfs.RemoveAll(dst)
+		return &CrossDeviceError{Source: src, Target: dst, Err: err}
+	}
+	return vfs.RemoveAll(src)
+}
+
+func copyTree(vfs fsys.FS, src, dst string) error {
+	type dirMode struct {
+		path string
+		mode fs.FileMode
 	}
+	var dirs []dirMode
 
-	err := filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
+	err := fsys.WalkDir(vfs, src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
 		if err != nil {
 			return err
 		}
@@ -77,19 +156,30 @@ func MoveDir(src, dst string) error {
 		targetPath := filepath.Join(dst, relPath)
 
 		if info.IsDir() {
-			return os.MkdirAll(targetPath, info.Mode())
+			// Directories stay writable until their contents are copied.
+			dirs = append(dirs, dirMode{targetPath, info.Mode().Perm()})
+			return vfs.MkdirAll(targetPath, info.Mode().Perm()|0700)
 		}
-		return MoveFile(path, targetPath)
+		return copyFile(vfs, path, targetPath, info)
 	})
 	if err != nil {
 		return err
 	}
 
-	return os.RemoveAll(src)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := vfs.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func ClearDir(dir string) error {
-	entries, err := os.ReadDir(dir)
+	return clearDir(fsys.OS{}, dir, PurgeOptions{})
+}
+
+func clearDir(vfs fsys.FS, dir string, opts PurgeOptions) error {
+	entries, err := vfs.ReadDir(dir)
 	if err != nil {
 		return err
 	}
@@ -97,10 +187,12 @@ func ClearDir(dir string) error {
 	for _, entry := range entries {
 		path := filepath.Join(dir, entry.Name())
 
-		if entry.IsDir() {
-			err = os.RemoveAll(path)
+		if opts.Shred != nil {
+			err = removeItem(vfs, path, opts)
+		} else if entry.IsDir() {
+			err = vfs.RemoveAll(path)
 		} else {
-			err = os.Remove(path)
+			err = vfs.Remove(path)
 		}
 
 		if err != nil {
@@ -112,148 +204,376 @@ func ClearDir(dir string) error {
 }
 
 func MoveFile(srcPath, dstPath string) error {
-	inputFile, err := os.Open(srcPath)
+	return moveFile(fsys.OS{}, srcPath, dstPath)
+}
+
+func moveFile(vfs fsys.FS, srcPath, dstPath string) error {
+	info, err := vfs.Lstat(srcPath)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(vfs, srcPath, dstPath, info); err != nil {
+		return err
+	}
+	return vfs.Remove(srcPath)
+}
+
+// copyFile copies a regular file or symlink and removes the partial copy on failure.
+func copyFile(vfs fsys.FS, srcPath, dstPath string, info fs.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := vfs.Readlink(srcPath)
+		if err != nil {
+			return err
+		}
+		return vfs.Symlink(target, dstPath)
+	}
+
+	inputFile, err := vfs.Open(srcPath)
 	if err != nil {
 		return err
 	}
 	defer inputFile.Close()
 
-	outputFile, err := os.Create(dstPath)
+	outputFile, err := vfs.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = outputFile.Close()
-	}()
 
 	_, err = io.Copy(outputFile, inputFile)
+	if closeErr := outputFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = vfs.Chmod(dstPath, info.Mode().Perm())
+	}
 	if err != nil {
+		_ = vfs.Remove(dstPath)
 		return err
 	}
+	return nil
+}
+
+func moveItem(vfs fsys.FS, srcPath, dstPath string, info fs.FileInfo) error {
+	if info.IsDir() {
+		return moveDir(vfs, srcPath, dstPath)
+	}
 
-	info, err := os.Stat(srcPath)
-	if err == nil {
-		_ = os.Chmod(dstPath, info.Mode())
+	err := vfs.Rename(srcPath, dstPath)
+	if err == nil || !isCrossDevice(err) {
+		return err
 	}
+	if err := moveFile(vfs, srcPath, dstPath); err != nil {
+		return &CrossDeviceError{Source: srcPath, Target: dstPath, Err: err}
+	}
+	return nil
+}
+
+// checkDeletable refuses to trash the root, the trash itself and, unless
+// forced, protected paths.
+func checkDeletable(vfs fsys.FS, absSrcPath, trashRoot string, opts DeleteOptions, protection func() (*Protection, error)) error {
+	if absSrcPath == "/" {
+		return &ProtectedPathError{Path: absSrcPath, Err: ErrRemoveRoot}
+	}
+
+	if trashRoot != "" && (absSrcPath == trashRoot || isAncestor(trashRoot, absSrcPath)) {
+		return &ProtectedPathError{Path: absSrcPath, Err: ErrRemoveTrashSelf}
+	}
+
+	if !opts.ForceProtected {
+		p, err := protection()
+		if err != nil {
+			return err
+		}
+		if err := p.Check(vfs, absSrcPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type defaultTrashKey struct {
+	path     string
+	readOnly bool
+}
 
-	return os.Remove(srcPath)
+// defaultTrashes keeps the default trash once made, so a run loads the
+// config, hooks and protection rules and opens the audit log once however
+// many items it touches.
+var defaultTrashes struct {
+	sync.Mutex
+	trashes   map[defaultTrashKey]Trash
+	auditLogs map[string]*audit.Log
 }
 
-func SaveDelete(srcPath string) error {
-	absSrcPath, err := filepath.Abs(srcPath)
+// DefaultTrash is ~/.trash set up from the config. It is made once per run.
+func DefaultTrash() (Trash, error) {
+	return defaultTrash(false)
+}
+
+func defaultTrash(readOnly bool) (Trash, error) {
+	var trashPath string
+	var err error
+	if readOnly {
+		trashPath, err = trashDir()
+	} else {
+		trashPath, err = GetTrashPath()
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	key := defaultTrashKey{trashPath, readOnly}
+	defaultTrashes.Lock()
+	defer defaultTrashes.Unlock()
+	if t, ok := defaultTrashes.trashes[key]; ok {
+		return t, nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	protection, err := DefaultProtection()
+	if err != nil {
+		return nil, err
 	}
+	quota, err := defaultQuotaOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := defaultHooks(cfg)
+	if err != nil {
+		return nil, err
+	}
+	t, err := NewDirTrash(trashPath, TrashOptions{
+		Encrypt:    defaultEncryptOptions(cfg),
+		Key:        DefaultKey,
+		Quota:      quota,
+		Audit:      defaultAuditLog(cfg),
+		Hooks:      hooks,
+		Protection: protection,
+		ReadOnly:   readOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if defaultTrashes.trashes == nil {
+		defaultTrashes.trashes = make(map[defaultTrashKey]Trash)
+	}
+	defaultTrashes.trashes[key] = t
+	return t, nil
+}
 
-	trashPath, err := GetTrashPath()
+// CloseDefaultTrash closes the audit log the default trashes write to and
+// forgets them. Front ends call it before they exit.
+func CloseDefaultTrash() error {
+	defaultTrashes.Lock()
+	defer defaultTrashes.Unlock()
+	var errs []error
+	for _, log := range defaultTrashes.auditLogs {
+		errs = append(errs, log.Close())
+	}
+	defaultTrashes.trashes = nil
+	defaultTrashes.auditLogs = nil
+	return errors.Join(errs...)
+}
+
+func SaveDelete(srcPath string, opts DeleteOptions) error {
+	t, err := DefaultTrash()
 	if err != nil {
 		return err
 	}
+	_, err = t.Put(srcPath, opts)
+	return err
+}
+
+// ListTrash lists the items in the default trash. It only reads the index,
+// so listing creates, locks and upgrades nothing.
+func ListTrash() ([]trash.TrashInfo, error) {
+	t, err := defaultTrash(true)
+	if err != nil {
+		return nil, err
+	}
+	return t.List()
+}
 
-	absTrashPath, err := filepath.Abs(trashPath)
+func EmptyTrash(opts PurgeOptions) error {
+	t, err := DefaultTrash()
 	if err != nil {
 		return err
 	}
+	return t.Empty(opts)
+}
 
-	if absSrcPath == "/" {
-		return ErrRemoveRoot
+func IsInTrash(path string) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
 	}
 
-	if absSrcPath == absTrashPath {
-		return os.RemoveAll(absTrashPath)
+	trashPath, err := trashDir()
+	if err != nil {
+		return false, err
 	}
 
-	fileName := filepath.Base(absSrcPath)
+	return absPath == trashPath || isAncestor(trashPath, absPath), nil
+}
 
-	info, err := os.Stat(absSrcPath)
+func PermanentDelete(path string, opts PurgeOptions) error {
+	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return err
 	}
 
-	dstPath, err := getUniquePath(absTrashPath, fileName)
+	t, err := DefaultTrash()
 	if err != nil {
 		return err
 	}
 
-	if info.IsDir() {
-		err = MoveDir(absSrcPath, dstPath)
-	} else {
-		err = MoveFile(absSrcPath, dstPath)
+	if absPath == t.Root() {
+		return t.Empty(opts)
 	}
-	if err != nil {
-		return err
+	if !isAncestor(t.Root(), absPath) {
+		return &NotInTrashError{Name: path}
 	}
 
-	err = trash.AddTrashInfoEntry(trash.TrashInfo{
-		TrashName:    filepath.Base(dstPath),
-		OriginalPath: absSrcPath,
-		DeletionDate: time.Now(),
-	})
+	relPath, err := filepath.Rel(t.Root(), absPath)
 	if err != nil {
 		return err
 	}
+	if strings.SplitN(relPath, string(filepath.Separator), 2)[0] == trash.BlobDirName {
+		return &NotInTrashError{Name: path}
+	}
+	if !strings.ContainsRune(relPath, filepath.Separator) {
+		// Files the index has lost are deleted like paths inside items.
+		_, err := t.Stat(relPath)
+		var notInTrash *NotInTrashError
+		if !errors.As(err, &notInTrash) {
+			if err != nil {
+				return err
+			}
+			return t.Purge(relPath, opts)
+		}
+	}
 
-	return nil
+	if _, err := os.Lstat(absPath); err != nil {
+		return err
+	}
+	if dt, ok := t.(*dirTrash); ok {
+		return dt.purgePath(absPath, opts)
+	}
+	return removeItem(fsys.OS{}, absPath, opts)
 }
 
-func EmptyTrash() error {
-	trashPath, err := GetTrashPath()
+func Purge(trashName string, opts PurgeOptions) error {
+	t, err := DefaultTrash()
 	if err != nil {
 		return err
 	}
-	return ClearDir(trashPath)
+	if _, err := t.Stat(trashName); err != nil {
+		return err
+	}
+	return t.Purge(trashName, opts)
 }
+
 func Restore() error {
-	filePath, err := trash.GetTrashInfoPath()
+	t, err := DefaultTrash()
 	if err != nil {
 		return err
 	}
-
-	entries, err := trash.LoadTrashInfo(filePath)
+	t, release, err := holdTrash(t)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	trashFilesDir, err := getTrashFilesDir()
+	entries, err := t.List()
 	if err != nil {
 		return err
 	}
 
-	var remainingEntries []trash.TrashInfo
-
+	var errs []error
 	for _, entry := range entries {
-		trashFilePath := filepath.Join(trashFilesDir, entry.TrashName)
-
-		if _, err := os.Stat(trashFilePath); os.IsNotExist(err) {
-			continue
+		if err := t.Restore(entry.TrashName); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.TrashName, err))
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		restoreDir := filepath.Dir(entry.OriginalPath)
-		if err := os.MkdirAll(restoreDir, 0755); err != nil {
-			remainingEntries = append(remainingEntries, entry)
-			continue
-		}
+// FindInTrash looks an item up by its trash name or, failing that, by the
+// path it was deleted from, preferring the most recent deletion.
+func FindInTrash(t Trash, name string) (trash.TrashInfo, error) {
+	entry, err := t.Stat(name)
+	if !errors.Is(err, ErrNotInTrash) {
+		return entry, err
+	}
 
-		err = os.Rename(trashFilePath, entry.OriginalPath)
-		if err != nil {
-			remainingEntries = append(remainingEntries, entry)
-			continue
+	absPath, absErr := filepath.Abs(name)
+	if absErr != nil {
+		return entry, err
+	}
+	entries, listErr := t.List()
+	if listErr != nil {
+		return entry, listErr
+	}
+	found := false
+	for _, candidate := range entries {
+		if candidate.OriginalPath == absPath && (!found || candidate.DeletionDate.After(entry.DeletionDate)) {
+			entry, found = candidate, true
 		}
 	}
+	if !found {
+		return entry, err
+	}
+	return entry, nil
+}
 
-	err = trash.SaveTrashInfo(filePath, remainingEntries)
+// RestoreItem restores one item named by its trash name or original path.
+func RestoreItem(name string) error {
+	t, err := DefaultTrash()
 	if err != nil {
 		return err
 	}
+	entry, err := FindInTrash(t, name)
+	if err != nil {
+		return err
+	}
+	return t.Restore(entry.TrashName)
+}
 
+// RestoreItems restores the items named by names like RestoreItem, loading
+// the index once for all of them, and tells report how each went. It only
+// fails itself when the trash cannot be opened.
+func RestoreItems(names []string, report func(name string, err error)) error {
+	t, err := DefaultTrash()
+	if err != nil {
+		return err
+	}
+	t, release, err := holdTrash(t)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for _, name := range names {
+		entry, err := FindInTrash(t, name)
+		if err == nil {
+			err = t.Restore(entry.TrashName)
+		}
+		report(name, err)
+	}
 	return nil
 }
 
-func getTrashFilesDir() (string, error) {
-	home, err := os.UserHomeDir()
+// PurgeItem deletes one item for good, named by its trash name or original
+// path.
+func PurgeItem(name string, opts PurgeOptions) error {
+	t, err := DefaultTrash()
 	if err != nil {
-		return "", errors.New("cannot determine home directory")
+		return err
 	}
-	trashPath := filepath.Join(home, ".trash")
-	return trashPath, nil
+	entry, err := FindInTrash(t, name)
+	if err != nil {
+		return err
+	}
+	return t.Purge(entry.TrashName, opts)
 }
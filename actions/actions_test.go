@@ -0,0 +1,1840 @@
+package actions
+
+import (
+	"brm/audit"
+	"brm/crypt"
+	"brm/fsys"
+	"brm/trash"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testTrashRoot = "/home/user/.trash"
+
+func newTestTrash(t *testing.T, vfs fsys.FS) (Trash, trash.Store) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	store := trash.NewMemoryStore()
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{Store: store, FS: vfs})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+	return tr, store
+}
+
+func writeTestTree(t *testing.T, vfs fsys.FS) {
+	t.Helper()
+	for _, dir := range []string{"/work/project/src", "/work/project/empty"} {
+		if err := vfs.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"/work/project/README":      "readme",
+		"/work/project/src/main.go": "package main",
+		"/work/notes.txt":           "some notes",
+	}
+	for path, content := range files {
+		if err := fsys.WriteFile(vfs, path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vfs.Symlink("README", "/work/project/link"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertContent(t *testing.T, vfs fsys.FS, path, want string) {
+	t.Helper()
+	got, err := fsys.ReadFile(vfs, path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if string(got) != want {
+		t.Fatalf("%s = %q, want %q", path, got, want)
+	}
+}
+
+func assertMissing(t *testing.T, vfs fsys.FS, path string) {
+	t.Helper()
+	if _, err := vfs.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("%s should not exist, Lstat error: %v", path, err)
+	}
+}
+
+func TestPutAndRestore(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, store := newTestTrash(t, mem)
+
+	entry, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	assertMissing(t, mem, "/work/notes.txt")
+	assertContent(t, mem, filepath.Join(testTrashRoot, entry.TrashName), "some notes")
+
+	if entry.Metadata == nil || entry.Metadata.Size != int64(len("some notes")) || entry.Metadata.SHA256 == "" {
+		t.Fatalf("metadata not captured: %+v", entry.Metadata)
+	}
+	if _, ok, _ := store.Get(entry.TrashName); !ok {
+		t.Fatalf("entry %s missing from index", entry.TrashName)
+	}
+
+	if err := tr.Restore(entry.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertContent(t, mem, "/work/notes.txt", "some notes")
+	if entries, _ := store.All(); len(entries) != 0 {
+		t.Fatalf("index not pruned after restore: %v", entries)
+	}
+}
+
+func TestPutUniqueNames(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, _ := newTestTrash(t, mem)
+
+	first, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(mem, "/work/notes.txt", []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.TrashName != "notes.txt" || second.TrashName != "notes_1.txt" {
+		t.Fatalf("trash names = %q, %q", first.TrashName, second.TrashName)
+	}
+}
+
+func TestPutCrossDeviceFallback(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	faulty := fsys.NewFaultFS(mem, fsys.Fault{Op: "rename", Err: syscall.EXDEV})
+	tr, _ := newTestTrash(t, faulty)
+
+	entry, err := tr.Put("/work/project", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put across devices: %v", err)
+	}
+
+	assertMissing(t, mem, "/work/project")
+	trashed := filepath.Join(testTrashRoot, entry.TrashName)
+	assertContent(t, mem, filepath.Join(trashed, "README"), "readme")
+	assertContent(t, mem, filepath.Join(trashed, "src", "main.go"), "package main")
+
+	info, err := mem.Lstat(filepath.Join(trashed, "src", "main.go"))
+	if err != nil || info.Mode().Perm() != 0640 {
+		t.Fatalf("mode not preserved: %v, %v", info, err)
+	}
+	if target, err := mem.Readlink(filepath.Join(trashed, "link")); err != nil || target != "README" {
+		t.Fatalf("symlink not preserved: %q, %v", target, err)
+	}
+	if info, err := mem.Lstat(filepath.Join(trashed, "empty")); err != nil || !info.IsDir() {
+		t.Fatalf("empty dir not copied: %v", err)
+	}
+
+	if err := tr.Restore(entry.TrashName); err != nil {
+		t.Fatalf("Restore across devices: %v", err)
+	}
+	assertContent(t, mem, "/work/project/src/main.go", "package main")
+	assertMissing(t, mem, trashed)
+}
+
+func TestPutCrossDeviceNoSpace(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	faulty := fsys.NewFaultFS(mem,
+		fsys.Fault{Op: "rename", Err: syscall.EXDEV},
+		fsys.Fault{Op: "write", Path: testTrashRoot + "/project/src/*", After: 4, Err: syscall.ENOSPC},
+	)
+	tr, store := newTestTrash(t, faulty)
+
+	_, err := tr.Put("/work/project", DeleteOptions{})
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Put error = %v, want ENOSPC", err)
+	}
+	var crossDevice *CrossDeviceError
+	if !errors.As(err, &crossDevice) || crossDevice.Source != "/work/project" {
+		t.Fatalf("Put error = %#v, want CrossDeviceError for /work/project", err)
+	}
+
+	assertContent(t, mem, "/work/project/README", "readme")
+	assertContent(t, mem, "/work/project/src/main.go", "package main")
+	assertMissing(t, mem, filepath.Join(testTrashRoot, "project"))
+	if entries, _ := store.All(); len(entries) != 0 {
+		t.Fatalf("failed Put left index entries: %v", entries)
+	}
+}
+
+func TestMoveFileNoSpaceRemovesPartialCopy(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	faulty := fsys.NewFaultFS(mem, fsys.Fault{Op: "write", Path: "/work/copy.txt", After: 2, Err: syscall.ENOSPC})
+
+	err := moveFile(faulty, "/work/notes.txt", "/work/copy.txt")
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("moveFile error = %v, want ENOSPC", err)
+	}
+	assertContent(t, mem, "/work/notes.txt", "some notes")
+	assertMissing(t, mem, "/work/copy.txt")
+}
+
+func TestPutPermissionDenied(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	faulty := fsys.NewFaultFS(mem, fsys.Fault{Op: "rename", Err: syscall.EACCES})
+	tr, store := newTestTrash(t, faulty)
+
+	_, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("Put error = %v, want EACCES", err)
+	}
+	assertContent(t, mem, "/work/notes.txt", "some notes")
+	if entries, _ := store.All(); len(entries) != 0 {
+		t.Fatalf("failed Put left index entries: %v", entries)
+	}
+}
+
+func TestPutUnreadableItemKeepsMetadataBestEffort(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	faulty := fsys.NewFaultFS(mem,
+		fsys.Fault{Op: "openfile", Path: "/work/notes.txt", Err: syscall.EACCES},
+		fsys.Fault{Op: "readdir", Path: "/work/project/src", Err: syscall.EACCES})
+	tr, _ := newTestTrash(t, faulty)
+
+	file, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put of an unreadable file: %v", err)
+	}
+	if file.Metadata.SHA256 != "" || file.Metadata.Size != 10 {
+		t.Fatalf("metadata of an unreadable file: %+v", file.Metadata)
+	}
+	dir, err := tr.Put("/work/project", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put of a partly unreadable directory: %v", err)
+	}
+	// README and the link to it are read before src fails.
+	if !dir.Metadata.SizeUnknown || dir.Metadata.Size != 6 || dir.Metadata.FileCount != 2 {
+		t.Fatalf("size of a partly unreadable directory: %+v", dir.Metadata)
+	}
+	if got := dir.Metadata.FormatSize(); got != "6 B+" {
+		t.Fatalf("FormatSize = %q, want the size marked incomplete", got)
+	}
+	assertMissing(t, mem, "/work/project")
+}
+
+func TestRestoreFailureKeepsEntry(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	faulty := fsys.NewFaultFS(mem)
+	tr, store := newTestTrash(t, faulty)
+
+	entry, err := tr.Put("/work/project/src", DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.RemoveAll("/work/project"); err != nil {
+		t.Fatal(err)
+	}
+
+	faulty.Inject(fsys.Fault{Op: "mkdirall", Path: "/work/project", Err: syscall.EACCES})
+	if err := tr.Restore(entry.TrashName); !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("Restore error = %v, want EACCES", err)
+	}
+	if _, ok, _ := store.Get(entry.TrashName); !ok {
+		t.Fatal("entry dropped after failed restore")
+	}
+
+	faulty.Reset()
+	if err := tr.Restore(entry.TrashName); err != nil {
+		t.Fatalf("Restore after fault cleared: %v", err)
+	}
+	assertContent(t, mem, "/work/project/src/main.go", "package main")
+}
+
+func TestRestoreConflict(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, _ := newTestTrash(t, mem)
+
+	entry, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(mem, "/work/notes.txt", []byte("new notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = tr.Restore(entry.TrashName)
+	var conflict *ConflictError
+	if !errors.Is(err, ErrRestoreConflict) || !errors.As(err, &conflict) || conflict.Path != "/work/notes.txt" {
+		t.Fatalf("Restore error = %v, want ConflictError for /work/notes.txt", err)
+	}
+	assertContent(t, mem, "/work/notes.txt", "new notes")
+	assertContent(t, mem, filepath.Join(testTrashRoot, entry.TrashName), "some notes")
+}
+
+func TestPutRefusesRootAndTrash(t *testing.T) {
+	mem := fsys.NewMemFS()
+	tr, _ := newTestTrash(t, mem)
+
+	if _, err := tr.Put("/", DeleteOptions{ForceProtected: true}); !errors.Is(err, ErrRemoveRoot) {
+		t.Fatalf("Put(/) error = %v, want ErrRemoveRoot", err)
+	}
+	for _, path := range []string{testTrashRoot, filepath.Join(testTrashRoot, "item")} {
+		if _, err := tr.Put(path, DeleteOptions{ForceProtected: true}); !errors.Is(err, ErrRemoveTrashSelf) {
+			t.Fatalf("Put(%s) error = %v, want ErrRemoveTrashSelf", path, err)
+		}
+	}
+}
+
+func TestPutRefusesProtectedPath(t *testing.T) {
+	mem := fsys.NewMemFS()
+	tr, _ := newTestTrash(t, mem)
+	if err := mem.MkdirAll("/etc", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := tr.Put("/etc", DeleteOptions{})
+	var protected *ProtectedPathError
+	if !errors.Is(err, ErrProtectedPath) || !errors.As(err, &protected) || protected.Rule != "/etc" {
+		t.Fatalf("Put(/etc) error = %v, want ProtectedPathError with rule /etc", err)
+	}
+	if _, err := os.Stat("/etc"); err != nil {
+		t.Fatalf("real /etc touched: %v", err)
+	}
+}
+
+func TestProtectionCoversAncestors(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	for _, dir := range []string{"/work/secrets", "/work/old/repo/.git"} {
+		if err := mem.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", t.TempDir())
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{
+		Store:      trash.NewMemoryStore(),
+		FS:         mem,
+		Protection: &Protection{Rules: []string{"/work/secrets/*.key"}, GitRoots: true},
+	})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+
+	for path, want := range map[string]ProtectedPathError{
+		"/work/secrets": {Path: "/work/secrets", Rule: "/work/secrets/*.key"},
+		"/work":         {Path: "/work", Rule: "/work/secrets/*.key"},
+		"/work/old":     {Path: "/work/old/repo", Rule: RuleGitRoot},
+	} {
+		_, err := tr.Put(path, DeleteOptions{})
+		var protected *ProtectedPathError
+		if !errors.As(err, &protected) || protected.Path != want.Path || protected.Rule != want.Rule {
+			t.Fatalf("Put(%s) error = %v, want %s protected by %s", path, err, want.Path, want.Rule)
+		}
+	}
+	if _, err := tr.Put("/work/project", DeleteOptions{}); err != nil {
+		t.Fatalf("Put of an unprotected directory: %v", err)
+	}
+}
+
+func TestPurgeAndEmpty(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, store := newTestTrash(t, mem)
+
+	notes, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := tr.Put("/work/project", DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Purge(notes.TrashName, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	assertMissing(t, mem, filepath.Join(testTrashRoot, notes.TrashName))
+	var notInTrash *NotInTrashError
+	if _, err := tr.Stat(notes.TrashName); !errors.As(err, &notInTrash) || notInTrash.Name != notes.TrashName {
+		t.Fatalf("Stat after purge = %v, want NotInTrashError", err)
+	}
+
+	if err := tr.Empty(PurgeOptions{}); err != nil {
+		t.Fatalf("Empty: %v", err)
+	}
+	assertMissing(t, mem, filepath.Join(testTrashRoot, project.TrashName))
+	if entries, _ := store.All(); len(entries) != 0 {
+		t.Fatalf("index not cleared: %v", entries)
+	}
+}
+
+func TestCompressAndRestore(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	mtime := time.Date(2020, 1, 1, 10, 0, 0, 123456789, time.UTC)
+	if err := mem.Chtimes("/work/project/README", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	tr, store := newTestTrash(t, mem)
+
+	entry, err := tr.Put("/work/project", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	compressed, err := CompressTrash(tr, CompressPolicy{MinSize: 1}, time.Now())
+	if err != nil {
+		t.Fatalf("CompressTrash: %v", err)
+	}
+	if len(compressed) != 1 || compressed[0].Storage != trash.StorageTarGzip || compressed[0].StoredSize == 0 {
+		t.Fatalf("compressed = %+v", compressed)
+	}
+	assertMissing(t, mem, filepath.Join(testTrashRoot, entry.TrashName))
+	if _, err := tr.Stat(entry.TrashName + archiveSuffix); err != nil {
+		t.Fatalf("Stat by archive name: %v", err)
+	}
+
+	again, err := CompressTrash(tr, CompressPolicy{MinSize: 1}, time.Now())
+	if err != nil || len(again) != 0 {
+		t.Fatalf("second pass compressed %+v, %v", again, err)
+	}
+
+	if err := tr.Restore(entry.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+	assertContent(t, mem, "/work/project/src/main.go", "package main")
+	if target, err := mem.Readlink("/work/project/link"); err != nil || target != "README" {
+		t.Fatalf("link -> %q, %v", target, err)
+	}
+	info, err := mem.Lstat("/work/project/README")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+		t.Fatalf("README mode %v mtime %v, want 0640 %v", info.Mode().Perm(), info.ModTime(), mtime)
+	}
+	if _, err := mem.Lstat("/work/project/empty"); err != nil {
+		t.Fatalf("empty directory not restored: %v", err)
+	}
+	assertMissing(t, mem, filepath.Join(testTrashRoot, entry.StoredName()+archiveSuffix))
+	if entries, _ := store.All(); len(entries) != 0 {
+		t.Fatalf("index still has %d entries", len(entries))
+	}
+}
+
+func TestPutAvoidsArchivedName(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, _ := newTestTrash(t, mem)
+
+	first, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := CompressTrash(tr, CompressPolicy{MinSize: 1}, time.Now()); err != nil {
+		t.Fatalf("CompressTrash: %v", err)
+	}
+
+	if err := fsys.WriteFile(mem, "/work/notes.txt", []byte("new notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if second.TrashName == first.TrashName {
+		t.Fatalf("second item reused trash name %q of an archived item", first.TrashName)
+	}
+}
+
+func TestDedupSharesBlobs(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	if err := fsys.WriteFile(mem, "/work/copy.txt", []byte("some notes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tr, store := newTestTrash(t, mem)
+	opts := DeleteOptions{Dedup: &DedupOptions{}}
+
+	first, err := tr.Put("/work/notes.txt", opts)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	second, err := tr.Put("/work/copy.txt", opts)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if second.Storage != trash.StorageDedup || len(second.Blobs) != 1 || second.Blobs[0].SHA256 != first.Blobs[0].SHA256 {
+		t.Fatalf("second entry = %+v, want a reference to the first blob", second)
+	}
+	blobPath := trash.BlobPath(testTrashRoot, first.Blobs[0].SHA256)
+	assertContent(t, mem, blobPath, "some notes")
+	assertMissing(t, mem, filepath.Join(testTrashRoot, first.TrashName))
+	assertMissing(t, mem, filepath.Join(testTrashRoot, second.TrashName))
+
+	if err := tr.Purge(first.TrashName, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	assertContent(t, mem, blobPath, "some notes")
+
+	if err := tr.Restore(second.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertContent(t, mem, "/work/copy.txt", "some notes")
+	if info, err := mem.Lstat("/work/copy.txt"); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("restored mode %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	assertMissing(t, mem, blobPath)
+	if entries, _ := store.All(); len(entries) != 0 {
+		t.Fatalf("index still has %d entries", len(entries))
+	}
+}
+
+func TestDedupDirectory(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, _ := newTestTrash(t, mem)
+
+	entry, err := tr.Put("/work/project", DeleteOptions{Dedup: &DedupOptions{}})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if len(entry.Blobs) != 2 {
+		t.Fatalf("blobs = %+v, want README and src/main.go", entry.Blobs)
+	}
+	assertMissing(t, mem, filepath.Join(testTrashRoot, entry.TrashName, "README"))
+
+	if err := tr.Restore(entry.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+	assertContent(t, mem, "/work/project/src/main.go", "package main")
+	if target, err := mem.Readlink("/work/project/link"); err != nil || target != "README" {
+		t.Fatalf("link -> %q, %v", target, err)
+	}
+}
+
+func TestDefaultKeyConfirmsNewPassphrase(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prompt := PassphrasePrompt
+	defer func() { PassphrasePrompt = prompt; defaultKey.key = nil }()
+	var answers []string
+	var asked []bool
+	PassphrasePrompt = func(confirm bool) ([]byte, error) {
+		asked = append(asked, confirm)
+		answer := answers[0]
+		answers = answers[1:]
+		return []byte(answer), nil
+	}
+
+	answers = []string{"correct horse", "correct hrose"}
+	if _, err := DefaultKey(); !errors.Is(err, ErrPassphraseMismatch) {
+		t.Fatalf("DefaultKey with a mistyped repeat = %v, want ErrPassphraseMismatch", err)
+	}
+	paramsPath, err := crypt.GetParamsPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(paramsPath); !os.IsNotExist(err) {
+		t.Fatalf("key parameters created from a mistyped passphrase: %v", err)
+	}
+
+	answers = []string{"correct horse", "correct horse"}
+	if _, err := DefaultKey(); err != nil {
+		t.Fatalf("DefaultKey: %v", err)
+	}
+
+	// Once the parameters exist the passphrase is checked against them.
+	defaultKey.key = nil
+	answers = []string{"correct horse"}
+	if _, err := DefaultKey(); err != nil {
+		t.Fatalf("DefaultKey with existing parameters: %v", err)
+	}
+	if fmt.Sprint(asked) != "[false true false true false]" {
+		t.Fatalf("prompts %v", asked)
+	}
+}
+
+func TestEncryptedPutAndRestore(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	t.Setenv("HOME", t.TempDir())
+
+	paramsPath := filepath.Join(t.TempDir(), "encryption.json")
+	key, err := crypt.OpenKey(paramsPath, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("OpenKey: %v", err)
+	}
+	if _, err := crypt.OpenKey(paramsPath, []byte("wrong horse")); !errors.Is(err, crypt.ErrWrongKey) {
+		t.Fatalf("OpenKey with wrong passphrase: %v, want ErrWrongKey", err)
+	}
+
+	store := trash.NewMemoryStore()
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{
+		Store:   store,
+		FS:      mem,
+		Encrypt: &EncryptOptions{EncryptPaths: true},
+		Key:     func() (*crypt.Key, error) { return key, nil },
+	})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+
+	entry, err := tr.Put("/work/project", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	assertMissing(t, mem, "/work/project")
+	if entry.OriginalPath != "" || entry.EncryptedPath == "" || strings.Contains(entry.TrashName, "project") {
+		t.Fatalf("entry leaks the original path: %+v", entry)
+	}
+	stored, err := fsys.ReadFile(mem, filepath.Join(testTrashRoot, entry.StoredName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte("package main")) {
+		t.Fatal("stored item contains plain text")
+	}
+
+	if err := tr.Restore(entry.StoredName()); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+	assertContent(t, mem, "/work/project/src/main.go", "package main")
+	assertMissing(t, mem, filepath.Join(testTrashRoot, entry.StoredName()))
+}
+
+func TestQuotaEvictsOldest(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, store := newTestTrash(t, mem)
+	dt := tr.(*dirTrash)
+	dt.space = func(string) (int64, int64, bool) { return 1000, 1000, true }
+
+	old, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// "some notes" and the project tree do not fit into 20 bytes together.
+	dt.quota = &QuotaOptions{Limit: 20, Policy: QuotaRefuse}
+	if _, err := tr.Put("/work/project", DeleteOptions{}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Put with refuse policy: %v, want ErrQuotaExceeded", err)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+
+	dt.quota.Policy = QuotaEvict
+	var evicted []string
+	entry, err := tr.Put("/work/project", DeleteOptions{
+		OnEvict: func(e trash.TrashInfo) { evicted = append(evicted, e.TrashName) },
+	})
+	if err != nil {
+		t.Fatalf("Put with evict policy: %v", err)
+	}
+	if len(evicted) != 1 || evicted[0] != old.TrashName {
+		t.Fatalf("evicted %v, want [%s]", evicted, old.TrashName)
+	}
+	assertMissing(t, mem, filepath.Join(testTrashRoot, old.TrashName))
+	entries, err := store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].TrashName != entry.TrashName {
+		t.Fatalf("entries after eviction: %+v", entries)
+	}
+}
+
+func TestNoSpaceForCopy(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, store := newTestTrash(t, mem)
+	dt := tr.(*dirTrash)
+	dt.space = func(string) (int64, int64, bool) { return 1000, 5, true }
+
+	if err := dt.makeRoom(store, 10, true, DeleteOptions{}); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("makeRoom across devices: %v, want ErrNoSpace", err)
+	}
+	if err := dt.makeRoom(store, 10, false, DeleteOptions{}); err != nil {
+		t.Fatalf("makeRoom for a rename: %v", err)
+	}
+}
+
+func TestMaintainOnlyChecksIndexByDefault(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".trash"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".trash", "untracked.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, repair := range []bool{false, true} {
+		report, err := Maintain(MaintainPolicy{Repair: repair})
+		if err != nil {
+			t.Fatalf("Maintain(repair %v): %v", repair, err)
+		}
+		if len(report.Fsck.OrphanFiles) != 1 || report.Repaired != repair {
+			t.Fatalf("report with repair %v: %+v", repair, report)
+		}
+		tr, err := DefaultTrash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tr.Stat("untracked.txt"); (err == nil) != repair {
+			t.Fatalf("untracked file indexed with repair %v: %v", repair, err)
+		}
+	}
+}
+
+func TestMaintainTrash(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, store := newTestTrash(t, mem)
+
+	old, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	recent, err := tr.Put("/work/project", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	now := time.Now()
+	old.DeletionDate = now.Add(-40 * 24 * time.Hour)
+	if err := store.Add(old); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := MaintainTrash(tr, MaintainPolicy{
+		MaxAge:   30 * 24 * time.Hour,
+		Compress: CompressPolicy{MinSize: 1},
+	}, now)
+	if err != nil {
+		t.Fatalf("MaintainTrash: %v", err)
+	}
+	if len(report.Expired) != 1 || report.Expired[0].TrashName != old.TrashName {
+		t.Fatalf("expired %+v, want %s", report.Expired, old.TrashName)
+	}
+	if len(report.Compressed) != 1 || report.Compressed[0].TrashName != recent.TrashName {
+		t.Fatalf("compressed %+v, want %s", report.Compressed, recent.TrashName)
+	}
+	assertMissing(t, mem, filepath.Join(testTrashRoot, old.TrashName))
+
+	entries, err := store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Storage != trash.StorageTarGzip {
+		t.Fatalf("entries after maintenance: %+v", entries)
+	}
+}
+
+func TestTrashStats(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, store := newTestTrash(t, mem)
+
+	notes, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := tr.Put("/work/project", DeleteOptions{}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	now := time.Now()
+	notes.DeletionDate = now.Add(-10 * 24 * time.Hour)
+	if err := store.Add(notes); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := StatsTrash(tr, now, 1)
+	if err != nil {
+		t.Fatalf("StatsTrash: %v", err)
+	}
+	// project holds "readme", "package main" and a symlink.
+	if stats.Items != 2 || stats.Files != 4 || stats.TotalSize != 28 {
+		t.Fatalf("totals %+v", stats)
+	}
+	if len(stats.ByDirectory) != 1 || stats.ByDirectory[0] != (StatsGroup{Key: "/work", Count: 2, Size: 28}) {
+		t.Fatalf("by directory %+v", stats.ByDirectory)
+	}
+	wantExt := []StatsGroup{{Key: StatsDirectory, Count: 1, Size: 18}, {Key: ".txt", Count: 1, Size: 10}}
+	if len(stats.ByExtension) != 2 || stats.ByExtension[0] != wantExt[0] || stats.ByExtension[1] != wantExt[1] {
+		t.Fatalf("by extension %+v", stats.ByExtension)
+	}
+	if stats.ByAge[0].Count != 1 || stats.ByAge[2].Count != 1 {
+		t.Fatalf("by age %+v", stats.ByAge)
+	}
+	if len(stats.Largest) != 1 || stats.Largest[0].OriginalPath != "/work/project" {
+		t.Fatalf("largest %+v", stats.Largest)
+	}
+}
+
+func TestPlanPutsSharesNamesAndQuota(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	for _, dir := range []string{"/work/a", "/work/b"} {
+		if err := mem.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(mem, dir+"/x", []byte("12345"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr, store := newTestTrash(t, mem)
+	dt := tr.(*dirTrash)
+	dt.space = func(string) (int64, int64, bool) { return 1000, 1000, true }
+	notes, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	dt.quota = &QuotaOptions{Limit: 15, Policy: QuotaEvict}
+
+	plan, err := dt.PlanPuts()
+	if err != nil {
+		t.Fatalf("PlanPuts: %v", err)
+	}
+	var got []string
+	for _, path := range []string{"/work/a/x", "/work/b/x"} {
+		steps, err := plan.PlanPut(path, DeleteOptions{})
+		if err != nil {
+			t.Fatalf("PlanPut(%s): %v", path, err)
+		}
+		for _, step := range steps {
+			got = append(got, step.Action+" "+step.TrashName)
+		}
+	}
+	// The second x only goes over the quota because of the first.
+	want := "move x,evict " + notes.TrashName + ",move x_1"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("plan %q, want %q", strings.Join(got, ","), want)
+	}
+	if entries, err := store.All(); err != nil || len(entries) != 1 {
+		t.Fatalf("index changed by the plan: %v, %v", entries, err)
+	}
+	assertContent(t, mem, "/work/a/x", "12345")
+}
+
+func TestPlanChangesNothing(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, store := newTestTrash(t, mem)
+	dt := tr.(*dirTrash)
+	dt.space = func(string) (int64, int64, bool) { return 1000, 1000, true }
+
+	notes, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	dt.quota = &QuotaOptions{Limit: 20, Policy: QuotaEvict}
+
+	steps, err := dt.PlanPut("/work/project", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("PlanPut: %v", err)
+	}
+	if len(steps) != 2 || steps[0].Action != PlanEvict || steps[0].TrashName != notes.TrashName ||
+		steps[1].Action != PlanMove || steps[1].Size != 18 || steps[1].CopyBytes != 0 {
+		t.Fatalf("PlanPut steps %+v", steps)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+	assertContent(t, mem, filepath.Join(testTrashRoot, notes.TrashName), "some notes")
+
+	if _, err := dt.PlanPut("/", DeleteOptions{}); !errors.Is(err, ErrRemoveRoot) {
+		t.Fatalf("PlanPut of /: %v, want ErrRemoveRoot", err)
+	}
+
+	if err := fsys.WriteFile(mem, "/work/notes.txt", []byte("new notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dt.PlanRestore(notes.TrashName); !errors.Is(err, ErrRestoreConflict) {
+		t.Fatalf("PlanRestore over an existing file: %v, want ErrRestoreConflict", err)
+	}
+
+	if err := mem.MkdirAll(filepath.Join(testTrashRoot, trash.BlobDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	steps, err = dt.PlanEmpty()
+	if err != nil {
+		t.Fatalf("PlanEmpty: %v", err)
+	}
+	if len(steps) != 1 || steps[0].Action != PlanPurge || steps[0].Size != 10 {
+		t.Fatalf("PlanEmpty steps %+v", steps)
+	}
+	if entries, err := store.All(); err != nil || len(entries) != 1 {
+		t.Fatalf("entries after planning: %v, %v", entries, err)
+	}
+}
+
+// listTree lists everything below dir, so a test can tell whether anything
+// was created or changed there.
+func listTree(t *testing.T, dir string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		paths = append(paths, fmt.Sprintf("%s %d", path, info.Size()))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestPlanWritesNothingToDisk(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	file := filepath.Join(home, "notes.txt")
+	if err := os.WriteFile(file, []byte("some notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := listTree(t, home)
+	if _, err := PlanDelete(file, DeleteOptions{}); err != nil {
+		t.Fatalf("PlanDelete: %v", err)
+	}
+	if steps, err := PlanEmptyTrash(); err != nil || len(steps) != 0 {
+		t.Fatalf("PlanEmptyTrash of a missing trash: %v, %v", steps, err)
+	}
+	if after := listTree(t, home); strings.Join(after, "\n") != strings.Join(before, "\n") {
+		t.Fatalf("planning without a trash created:\n%s", strings.Join(after, "\n"))
+	}
+
+	// A version 1 index would be backed up and upgraded by a real open.
+	for _, dir := range []string{".trash", ".brm"} {
+		if err := os.Mkdir(filepath.Join(home, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(home, ".trash", "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	index := `[{"trash_name": "old.txt", "original_path": "` + filepath.Join(home, "old.txt") + `"}]`
+	if err := os.WriteFile(filepath.Join(home, ".brm", "trash.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before = listTree(t, home)
+	steps, err := PlanRestoreItem("old.txt")
+	if err != nil || len(steps) != 1 || steps[0].Target != filepath.Join(home, "old.txt") {
+		t.Fatalf("PlanRestoreItem: %+v, %v", steps, err)
+	}
+	if _, err := PlanPurgeItem(filepath.Join(home, "old.txt")); err != nil {
+		t.Fatalf("PlanPurgeItem by path: %v", err)
+	}
+	if after := listTree(t, home); strings.Join(after, "\n") != strings.Join(before, "\n") {
+		t.Fatalf("planning changed the trash:\n%s\nwas:\n%s", strings.Join(after, "\n"), strings.Join(before, "\n"))
+	}
+
+	tr, err := defaultTrash(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Purge("old.txt", PurgeOptions{}); !errors.Is(err, trash.ErrReadOnly) {
+		t.Fatalf("Purge on a read-only trash: %v, want ErrReadOnly", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".trash", "old.txt")); err != nil {
+		t.Fatalf("refused Purge removed the item: %v", err)
+	}
+}
+
+func TestCustomRootHasItsOwnIndex(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	work := t.TempDir()
+
+	var trashes []Trash
+	for _, name := range []string{"a", "b"} {
+		tr, err := NewDirTrash(filepath.Join(work, "trash-"+name), TrashOptions{})
+		if err != nil {
+			t.Fatalf("NewDirTrash: %v", err)
+		}
+		file := filepath.Join(work, name+".txt")
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tr.Put(file, DeleteOptions{}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		trashes = append(trashes, tr)
+	}
+
+	for i, tr := range trashes {
+		entries, err := tr.List()
+		if err != nil || len(entries) != 1 || entries[0].TrashName != []string{"a.txt", "b.txt"}[i] {
+			t.Fatalf("entries of %s: %+v, %v", tr.Root(), entries, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, ".brm", "trash.json")); !os.IsNotExist(err) {
+		t.Fatalf("custom trashes used the default index: %v", err)
+	}
+}
+
+func TestHeldTrashLoadsIndexOnce(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	work := t.TempDir()
+	indexPath := filepath.Join(t.TempDir(), "trash.json")
+	tr, err := NewDirTrash(filepath.Join(work, "trash"), TrashOptions{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+	var names []string
+	for _, name := range []string{"a", "b", "c"} {
+		file := filepath.Join(work, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := tr.Put(file, DeleteOptions{})
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		names = append(names, entry.TrashName)
+	}
+
+	held, release, err := tr.(Holder).Hold()
+	if err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+	if _, err := held.Stat(names[0]); err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	// Once loaded, the held index is not read again, so restoring the
+	// other items does not notice the journal is gone.
+	if err := os.Rename(strings.TrimSuffix(indexPath, ".json")+".log", indexPath+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := held.Restore(name); err != nil {
+			t.Fatalf("Restore %s: %v", name, err)
+		}
+	}
+	if err := release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := os.Stat(filepath.Join(work, name)); err != nil {
+			t.Fatalf("%s not restored: %v", name, err)
+		}
+	}
+}
+
+type countingStore struct {
+	trash.Store
+	adds   int
+	checks int
+}
+
+func (s *countingStore) Add(entries ...trash.TrashInfo) error {
+	s.adds++
+	return s.Store.Add(entries...)
+}
+
+func (s *countingStore) CheckWritable() error {
+	s.checks++
+	return s.Store.CheckWritable()
+}
+
+func TestPutBatchAddsEachItemOnceMoved(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	t.Setenv("HOME", t.TempDir())
+
+	store := &countingStore{Store: trash.NewMemoryStore()}
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{Store: store, FS: mem})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+
+	results := make(map[string]error)
+	err = tr.(Batcher).PutBatch([]string{"/work/notes.txt", "/work/missing", "/work/project"}, DeleteOptions{},
+		func(path string, entry trash.TrashInfo, err error) {
+			results[path] = err
+			// A crash now must not lose the item.
+			if _, ok, _ := store.Get(entry.TrashName); err == nil && !ok {
+				t.Errorf("%s reported before it was in the index", path)
+			}
+		})
+	if err != nil {
+		t.Fatalf("PutBatch: %v", err)
+	}
+	if results["/work/notes.txt"] != nil || results["/work/project"] != nil || !os.IsNotExist(results["/work/missing"]) {
+		t.Fatalf("results %v", results)
+	}
+	if store.adds != 2 {
+		t.Fatalf("index written %d times, want once per item", store.adds)
+	}
+	entries, err := store.All()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("entries %v, %v", entries, err)
+	}
+	assertMissing(t, mem, "/work/project")
+	assertContent(t, mem, filepath.Join(testTrashRoot, "notes.txt"), "some notes")
+}
+
+func TestPutBatchCommitsInChunks(t *testing.T) {
+	mem := fsys.NewMemFS()
+	t.Setenv("HOME", t.TempDir())
+	if err := mem.MkdirAll("/work", 0755); err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, batchChunkSize+10)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/work/file%d", i)
+		if err := fsys.WriteFile(mem, paths[i], nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &countingStore{Store: trash.NewMemoryStore()}
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{Store: store, FS: mem})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+	var reported []string
+	err = tr.(Batcher).PutBatch(paths, DeleteOptions{Jobs: 4}, func(path string, _ trash.TrashInfo, err error) {
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		reported = append(reported, path)
+	})
+	if err != nil {
+		t.Fatalf("PutBatch: %v", err)
+	}
+	if strings.Join(reported, ",") != strings.Join(paths, ",") {
+		t.Fatalf("reported %d paths out of order", len(reported))
+	}
+	if store.checks != 2 {
+		t.Fatalf("index opened %d times, want once per chunk", store.checks)
+	}
+	if entries, err := store.All(); err != nil || len(entries) != len(paths) {
+		t.Fatalf("entries %d, %v; want %d", len(entries), err, len(paths))
+	}
+}
+
+func TestParallelPutBatch(t *testing.T) {
+	mem := fsys.NewMemFS()
+	t.Setenv("HOME", t.TempDir())
+	store := trash.NewMemoryStore()
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{Store: store, FS: mem})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+
+	// Same base names in different directories compete for trash names.
+	var paths []string
+	for i := range 40 {
+		path := fmt.Sprintf("/work/%d/data.txt", i%8)
+		if i >= 8 {
+			path = fmt.Sprintf("/work/%d/%d/data.txt", i%8, i)
+		}
+		if err := mem.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(mem, path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	var reported []string
+	err = tr.(Batcher).PutBatch(paths, DeleteOptions{Jobs: 8}, func(path string, entry trash.TrashInfo, err error) {
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		reported = append(reported, path)
+	})
+	if err != nil {
+		t.Fatalf("PutBatch: %v", err)
+	}
+	if strings.Join(reported, ",") != strings.Join(paths, ",") {
+		t.Fatalf("reported out of order: %v", reported)
+	}
+
+	entries, err := store.All()
+	if err != nil || len(entries) != len(paths) {
+		t.Fatalf("entries %d, %v; want %d", len(entries), err, len(paths))
+	}
+	for _, entry := range entries {
+		assertContent(t, mem, filepath.Join(testTrashRoot, entry.TrashName), entry.OriginalPath)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(1000)
+	start := time.Now()
+	for range 3 {
+		limiter.wait(100)
+	}
+	// The first write goes at once, the other two wait 100ms each.
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Fatalf("three 100 byte writes at 1000 B/s took %v", elapsed)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	t.Setenv("HOME", t.TempDir())
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{
+		Store: trash.NewMemoryStore(),
+		FS:    mem,
+		Audit: audit.NewLog(logPath, audit.LogOptions{}),
+	})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+
+	notes, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := tr.Put("/work/missing", DeleteOptions{}); err == nil {
+		t.Fatal("Put of a missing file succeeded")
+	}
+	if err := tr.Restore(notes.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	readme, err := tr.Put("/work/project/README", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := tr.Purge(readme.TrashName, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if _, err := tr.Put("/work/project/src", DeleteOptions{}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := tr.Empty(PurgeOptions{}); err != nil {
+		t.Fatalf("Empty: %v", err)
+	}
+
+	records, err := audit.Read(logPath, audit.Query{})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	var got []string
+	for _, rec := range records {
+		got = append(got, fmt.Sprintf("%s %s %s %d", rec.Op, rec.Outcome, strings.Join(rec.Paths, ","), rec.Bytes))
+		if rec.PID != os.Getpid() || len(rec.Argv) == 0 {
+			t.Errorf("process not recorded: %+v", rec)
+		}
+	}
+	want := []string{
+		"delete ok /work/notes.txt 10",
+		"delete failed /work/missing 0",
+		"restore ok /work/notes.txt 10",
+		"delete ok /work/project/README 6",
+		"purge ok /work/project/README 6",
+		"delete ok /work/project/src 12",
+		"empty ok /work/project/src 12",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("records:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	byPath, err := audit.Read(logPath, audit.Query{Names: []string{"/work/project"}})
+	if err != nil || len(byPath) != 4 {
+		t.Fatalf("records under /work/project: %d, %v; want 4", len(byPath), err)
+	}
+	byName, err := audit.Read(logPath, audit.Query{Names: []string{notes.TrashName}})
+	if err != nil || len(byName) != 2 {
+		t.Fatalf("records of %s: %d, %v; want 2", notes.TrashName, len(byName), err)
+	}
+	future, err := audit.Read(logPath, audit.Query{Since: time.Now().Add(time.Hour)})
+	if err != nil || len(future) != 0 {
+		t.Fatalf("records since an hour ahead: %v, %v", future, err)
+	}
+}
+
+func TestAuditLogCapsCommandLine(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"brm"}
+	for i := 0; i < 1000; i++ {
+		os.Args = append(os.Args, fmt.Sprintf("file%d", i))
+	}
+
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	log := audit.NewLog(logPath, audit.LogOptions{})
+	defer log.Close()
+	for i := 0; i < 3; i++ {
+		if err := log.Record(audit.Record{Op: audit.OpDelete, Paths: []string{os.Args[i+1]}}, nil); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	records, err := audit.Read(logPath, audit.Query{})
+	if err != nil || len(records) != 3 {
+		t.Fatalf("Read: %d records, %v; want 3", len(records), err)
+	}
+	for _, rec := range records {
+		if len(rec.Argv) != 17 || rec.Argv[16] != "... (+985 more)" {
+			t.Fatalf("argv not capped: %d args, last %q", len(rec.Argv), rec.Argv[len(rec.Argv)-1])
+		}
+	}
+}
+
+// writeHook writes a hook that appends its input to log and fails when the
+// file veto exists.
+func writeHook(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "hook")
+	script := fmt.Sprintf("#!/bin/sh\ncat >> %q\necho >> %q\n[ ! -e %q ]\n",
+		filepath.Join(dir, "log"), filepath.Join(dir, "log"), filepath.Join(dir, "veto"))
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHooks(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	hook := writeHook(t, dir)
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{
+		Store: trash.NewMemoryStore(),
+		FS:    mem,
+		Hooks: Hooks{HookPreDelete: hook, HookPostDelete: hook, HookPreRestore: hook, HookPostRestore: hook, HookPrePurge: hook},
+	})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+	veto := func(on bool) {
+		t.Helper()
+		if on {
+			if err := os.WriteFile(filepath.Join(dir, "veto"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.Remove(filepath.Join(dir, "veto")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	veto(true)
+	var hookErr *HookError
+	if err := tr.Restore(entry.TrashName); !errors.As(err, &hookErr) || hookErr.Hook != HookPreRestore {
+		t.Fatalf("vetoed Restore = %v", err)
+	}
+	if err := tr.Purge(entry.TrashName, PurgeOptions{}); !errors.As(err, &hookErr) || hookErr.Hook != HookPrePurge {
+		t.Fatalf("vetoed Purge = %v", err)
+	}
+	if err := tr.Empty(PurgeOptions{}); !errors.As(err, &hookErr) {
+		t.Fatalf("vetoed Empty = %v", err)
+	}
+	if _, err := tr.Put("/work/project/README", DeleteOptions{}); !errors.As(err, &hookErr) || hookErr.Hook != HookPreDelete {
+		t.Fatalf("vetoed Put = %v", err)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+	if _, err := tr.Stat(entry.TrashName); err != nil {
+		t.Fatalf("vetoed item gone: %v", err)
+	}
+	veto(false)
+	if err := tr.Restore(entry.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hooks []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var input hookInput
+		if err := json.Unmarshal([]byte(line), &input); err != nil {
+			t.Fatalf("hook input %q: %v", line, err)
+		}
+		for _, item := range input.Items {
+			hooks = append(hooks, fmt.Sprintf("%s %s %s %d", input.Hook, item.Path, item.TrashName, item.Size))
+		}
+	}
+	name := entry.TrashName
+	want := []string{
+		"pre-delete /work/notes.txt  0",
+		"post-delete /work/notes.txt " + name + " 10",
+		"pre-restore /work/notes.txt " + name + " 10",
+		"pre-purge /work/notes.txt " + name + " 10",
+		"pre-purge /work/notes.txt " + name + " 10",
+		"pre-delete /work/project/README  0",
+		"pre-restore /work/notes.txt " + name + " 10",
+		"post-restore /work/notes.txt " + name + " 10",
+	}
+	if strings.Join(hooks, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("hooks ran:\n%s\nwant:\n%s", strings.Join(hooks, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// unreadableStore fails every read of the index.
+type unreadableStore struct {
+	trash.Store
+}
+
+var errUnreadable = errors.New("index unreadable")
+
+func (unreadableStore) Get(string) (trash.TrashInfo, bool, error) {
+	return trash.TrashInfo{}, false, errUnreadable
+}
+
+func (unreadableStore) All() ([]trash.TrashInfo, error) {
+	return nil, errUnreadable
+}
+
+func TestPrePurgeHookGuardsEvictionAndIndexErrors(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	hook := writeHook(t, dir)
+	store := trash.NewMemoryStore()
+	tr, err := NewDirTrash(testTrashRoot, TrashOptions{Store: store, FS: mem, Hooks: Hooks{HookPrePurge: hook}})
+	if err != nil {
+		t.Fatalf("NewDirTrash: %v", err)
+	}
+	dt := tr.(*dirTrash)
+	dt.space = func(string) (int64, int64, bool) { return 1000, 1000, true }
+
+	old, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "veto"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A vetoed eviction refuses the deletion that needed the room.
+	dt.quota = &QuotaOptions{Limit: 20, Policy: QuotaEvict}
+	var hookErr *HookError
+	if _, err := tr.Put("/work/project", DeleteOptions{}); !errors.As(err, &hookErr) || hookErr.Hook != HookPrePurge {
+		t.Fatalf("Put with vetoed eviction = %v", err)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+	if _, err := tr.Stat(old.TrashName); err != nil {
+		t.Fatalf("vetoed victim gone: %v", err)
+	}
+	dt.quota.Limit = 5
+	if evicted, err := dt.EnforceQuota(); !errors.As(err, &hookErr) || len(evicted) != 0 {
+		t.Fatalf("EnforceQuota with veto = %v, %v", evicted, err)
+	}
+
+	// Without an index the hook cannot be asked, so nothing is purged.
+	dt.quota = nil
+	dt.store = unreadableStore{store}
+	if err := tr.Purge(old.TrashName, PurgeOptions{}); !errors.Is(err, errUnreadable) {
+		t.Fatalf("Purge with an unreadable index = %v", err)
+	}
+	if err := tr.Empty(PurgeOptions{}); !errors.Is(err, errUnreadable) {
+		t.Fatalf("Empty with an unreadable index = %v", err)
+	}
+	assertContent(t, mem, filepath.Join(testTrashRoot, old.TrashName), "some notes")
+
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"hook":"pre-purge"`); n != 2 {
+		t.Fatalf("pre-purge ran %d times, want 2 (both evictions):\n%s", n, data)
+	}
+}
+
+// recordingFS logs the changes shredding makes: every overwrite pass with
+// what the file held afterwards, every chmod, rename and unlink.
+type recordingFS struct {
+	fsys.FS
+	log []string
+}
+
+type recordingFile struct {
+	fsys.File
+	fs      *recordingFS
+	name    string
+	written int64
+}
+
+func (f *recordingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+func (f *recordingFile) Close() error {
+	err := f.File.Close()
+	data, _ := fsys.ReadFile(f.fs.FS, f.name)
+	f.fs.log = append(f.fs.log, fmt.Sprintf("write %s %d %q", f.name, f.written, data))
+	return err
+}
+
+func (r *recordingFS) OpenFile(name string, flag int, perm fs.FileMode) (fsys.File, error) {
+	file, err := r.FS.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return file, err
+	}
+	return &recordingFile{File: file, fs: r, name: name}, nil
+}
+
+func (r *recordingFS) Chmod(name string, mode fs.FileMode) error {
+	r.log = append(r.log, fmt.Sprintf("chmod %s %v", name, mode))
+	return r.FS.Chmod(name, mode)
+}
+
+func (r *recordingFS) Rename(oldpath, newpath string) error {
+	r.log = append(r.log, "rename "+oldpath+" "+newpath)
+	return r.FS.Rename(oldpath, newpath)
+}
+
+func (r *recordingFS) Remove(name string) error {
+	r.log = append(r.log, "remove "+name)
+	return r.FS.Remove(name)
+}
+
+func TestShredOverwritesThenRenamesBeforeUnlink(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	if err := mem.Chmod("/work/project/README", 0444); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordingFS{FS: mem}
+
+	err := removeItem(rec, "/work/project", PurgeOptions{Shred: &ShredOptions{Passes: 2, Pattern: ShredPatternZero}})
+	if err != nil {
+		t.Fatalf("shred: %v", err)
+	}
+	assertMissing(t, mem, "/work/project")
+
+	// Both files get two full passes of zeros before anything is renamed.
+	want := []string{
+		"chmod /work/project/README -rw-r--r--",
+		`write /work/project/README 6 "\x00\x00\x00\x00\x00\x00"`,
+		`write /work/project/README 6 "\x00\x00\x00\x00\x00\x00"`,
+		`write /work/project/src/main.go 12 "` + strings.Repeat(`\x00`, 12) + `"`,
+		`write /work/project/src/main.go 12 "` + strings.Repeat(`\x00`, 12) + `"`,
+	}
+	if len(rec.log) < len(want) || strings.Join(rec.log[:len(want)], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("overwrites:\n%s\nwant:\n%s", strings.Join(rec.log, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Then every path, deepest first and symlinks included, is renamed to a
+	// random name of the same length and only that name is unlinked.
+	rest := rec.log[len(want):]
+	paths := []string{"/work/project/src/main.go", "/work/project/src", "/work/project/link",
+		"/work/project/empty", "/work/project/README", "/work/project"}
+	if len(rest) != 2*len(paths) {
+		t.Fatalf("renames and unlinks:\n%s", strings.Join(rest, "\n"))
+	}
+	for i, path := range paths {
+		rename, remove := strings.Fields(rest[2*i]), strings.Fields(rest[2*i+1])
+		if rename[0] != "rename" || rename[1] != path || remove[0] != "remove" || remove[1] != rename[2] {
+			t.Fatalf("step %d for %s: %q, %q", i, path, rest[2*i], rest[2*i+1])
+		}
+		obscured := rename[2]
+		if filepath.Dir(obscured) != filepath.Dir(path) || len(filepath.Base(obscured)) != len(filepath.Base(path)) ||
+			filepath.Base(obscured) == filepath.Base(path) {
+			t.Fatalf("%s renamed to %s", path, obscured)
+		}
+	}
+}
+
+func TestShredRandomPattern(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	rec := &recordingFS{FS: mem}
+
+	if err := shredTree(rec, "/work/notes.txt", ShredOptions{Pattern: ShredPatternRandom}); err != nil {
+		t.Fatalf("shredTree: %v", err)
+	}
+	// Passes below one still overwrite once.
+	if len(rec.log) != 3 || !strings.HasPrefix(rec.log[0], "write /work/notes.txt 10 ") ||
+		strings.Contains(rec.log[0], "some notes") {
+		t.Fatalf("log:\n%s", strings.Join(rec.log, "\n"))
+	}
+	assertMissing(t, mem, "/work/notes.txt")
+}
+
+func TestShredFailureUnlinksNothing(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	opts := ShredOptions{Passes: 1, Pattern: ShredPatternZero}
+
+	faulty := fsys.NewFaultFS(mem, fsys.Fault{Op: "write", Path: "/work/project/src/main.go", After: 4, Err: syscall.ENOSPC})
+	if err := shredTree(faulty, "/work/project", opts); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("shredTree with a failing write: %v, want ENOSPC", err)
+	}
+	if _, err := mem.Lstat("/work/project/src/main.go"); err != nil {
+		t.Fatalf("file unlinked after a failed overwrite: %v", err)
+	}
+
+	faulty = fsys.NewFaultFS(mem, fsys.Fault{Op: "rename", Path: "/work/notes.txt", Err: syscall.EACCES})
+	if err := shredTree(faulty, "/work/notes.txt", opts); !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("shredTree with a failing rename: %v, want EACCES", err)
+	}
+	assertContent(t, mem, "/work/notes.txt", strings.Repeat("\x00", 10))
+}
+
+func TestShredLeavesHardLinkedDataAlone(t *testing.T) {
+	dir := t.TempDir()
+	item := filepath.Join(dir, "item")
+	if err := os.MkdirAll(item, 0755); err != nil {
+		t.Fatal(err)
+	}
+	linked, other := filepath.Join(item, "linked"), filepath.Join(dir, "other")
+	if err := os.WriteFile(linked, []byte("shared data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(linked, other); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+
+	var warned []string
+	opts := ShredOptions{Passes: 1, Pattern: ShredPatternZero, OnLinked: func(path string) { warned = append(warned, path) }}
+	if err := shredTree(fsys.OS{}, item, opts); err != nil {
+		t.Fatalf("shredTree: %v", err)
+	}
+	if _, err := os.Lstat(item); !os.IsNotExist(err) {
+		t.Fatalf("item kept: %v", err)
+	}
+	if data, err := os.ReadFile(other); err != nil || string(data) != "shared data" {
+		t.Fatalf("other link reads %q, %v", data, err)
+	}
+	if len(warned) != 1 || warned[0] != linked {
+		t.Fatalf("warned about %q, want %s", warned, linked)
+	}
+}
+
+func TestTrashNamesStayInside(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, _ := newTestTrash(t, mem)
+	if err := fsys.WriteFile(mem, filepath.Join(testTrashRoot, "stray"), []byte("stray"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", ".", "..", "../user", "a/b", "stray", trash.BlobDirName} {
+		if err := tr.Purge(name, PurgeOptions{}); !errors.Is(err, ErrNotInTrash) {
+			t.Errorf("Purge(%q) = %v, want ErrNotInTrash", name, err)
+		}
+		if err := tr.Restore(name); !errors.Is(err, ErrNotInTrash) {
+			t.Errorf("Restore(%q) = %v, want ErrNotInTrash", name, err)
+		}
+	}
+	assertContent(t, mem, "/work/notes.txt", "some notes")
+	assertContent(t, mem, filepath.Join(testTrashRoot, "stray"), "stray")
+}
+
+func TestPermanentDeleteRemovesUnindexedFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	stray := filepath.Join(home, ".trash", "stray")
+	if err := os.MkdirAll(filepath.Dir(stray), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stray, []byte("stray"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Purge("stray", PurgeOptions{}); !errors.Is(err, ErrNotInTrash) {
+		t.Fatalf("Purge of an unindexed file = %v, want ErrNotInTrash", err)
+	}
+	if steps, err := PlanPermanentDelete(stray); err != nil || len(steps) != 1 || steps[0].Size != 5 {
+		t.Fatalf("PlanPermanentDelete = %+v, %v, want the file planned", steps, err)
+	}
+	if err := PermanentDelete(stray, PurgeOptions{}); err != nil {
+		t.Fatalf("PermanentDelete: %v", err)
+	}
+	if _, err := os.Lstat(stray); !os.IsNotExist(err) {
+		t.Fatalf("unindexed file kept: %v", err)
+	}
+}
+
+func TestFreeDesktopTrash(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	t.Setenv("HOME", t.TempDir())
+	const root = "/home/user/.local/share/Trash"
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	dir := t.TempDir()
+	tr, err := NewFreeDesktopTrash(root, TrashOptions{
+		FS:         mem,
+		Audit:      audit.NewLog(logPath, audit.LogOptions{}),
+		Hooks:      Hooks{HookPreDelete: writeHook(t, dir)},
+		Protection: &Protection{Rules: []string{"/work/project/src"}},
+	})
+	if err != nil {
+		t.Fatalf("NewFreeDesktopTrash: %v", err)
+	}
+
+	notes, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	assertContent(t, mem, filepath.Join(root, "files", "notes.txt"), "some notes")
+	if _, err := mem.Lstat(filepath.Join(root, "info", "notes.txt.trashinfo")); err != nil {
+		t.Fatalf("no .trashinfo record: %v", err)
+	}
+	if _, err := tr.Put("/work/project", DeleteOptions{}); !errors.Is(err, ErrProtectedPath) {
+		t.Fatalf("Put of a protected path = %v, want ErrProtectedPath", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "veto"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var hookErr *HookError
+	if _, err := tr.Put("/work/project/README", DeleteOptions{}); !errors.As(err, &hookErr) {
+		t.Fatalf("Put vetoed by the hook = %v, want HookError", err)
+	}
+	assertContent(t, mem, "/work/project/README", "readme")
+	if _, err := tr.Put("/work/project/README", DeleteOptions{Dedup: &DedupOptions{}}); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("Put with dedup = %v, want ErrUnsupportedOption", err)
+	}
+
+	if err := fsys.WriteFile(mem, filepath.Join(root, "files", "stray"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"..", "../info", "stray"} {
+		if err := tr.Purge(name, PurgeOptions{}); !errors.Is(err, ErrNotInTrash) {
+			t.Errorf("Purge(%q) = %v, want ErrNotInTrash", name, err)
+		}
+	}
+	if _, err := mem.Lstat(filepath.Join(root, "files", "stray")); err != nil {
+		t.Fatalf("unindexed file purged: %v", err)
+	}
+
+	if err := tr.Restore(notes.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertContent(t, mem, "/work/notes.txt", "some notes")
+	if entries, err := tr.List(); err != nil || len(entries) != 0 {
+		t.Fatalf("List after restore = %v, %v", entries, err)
+	}
+
+	records, err := audit.Read(logPath, audit.Query{})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	var got []string
+	for _, rec := range records {
+		got = append(got, rec.Op+" "+rec.Outcome)
+	}
+	want := "delete ok,delete failed,delete failed,delete failed,purge failed,purge failed,purge failed,restore ok"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("records %q, want %q", strings.Join(got, ","), want)
+	}
+
+	for _, opts := range []TrashOptions{{Quota: &QuotaOptions{}}, {Encrypt: &EncryptOptions{}}, {Store: trash.NewMemoryStore()}, {ReadOnly: true}} {
+		opts.FS = mem
+		if _, err := NewFreeDesktopTrash(root, opts); !errors.Is(err, ErrUnsupportedOption) {
+			t.Errorf("NewFreeDesktopTrash(%+v) = %v, want ErrUnsupportedOption", opts, err)
+		}
+	}
+}
+
+func TestMemoryTrash(t *testing.T) {
+	mem := fsys.NewMemFS()
+	writeTestTree(t, mem)
+	tr, err := NewMemoryTrash(TrashOptions{FS: mem, Protection: &Protection{Rules: []string{"/work/project/src"}}})
+	if err != nil {
+		t.Fatalf("NewMemoryTrash: %v", err)
+	}
+
+	project, err := tr.Put("/work/project/empty", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	notes, err := tr.Put("/work/notes.txt", DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	assertMissing(t, mem, "/work/notes.txt")
+	if _, err := tr.Put("/work/project", DeleteOptions{}); !errors.Is(err, ErrProtectedPath) {
+		t.Fatalf("Put of a protected path = %v, want ErrProtectedPath", err)
+	}
+
+	if err := fsys.WriteFile(mem, "/work/notes.txt", []byte("new notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Restore(notes.TrashName); !errors.Is(err, ErrRestoreConflict) {
+		t.Fatalf("Restore over an existing file = %v, want ErrRestoreConflict", err)
+	}
+	if err := mem.Remove("/work/notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Restore(notes.TrashName); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertContent(t, mem, "/work/notes.txt", "some notes")
+
+	if err := tr.Purge("missing", PurgeOptions{}); !errors.Is(err, ErrNotInTrash) {
+		t.Fatalf("Purge of a missing item = %v, want ErrNotInTrash", err)
+	}
+	if err := tr.Purge(project.TrashName, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if entries, err := tr.List(); err != nil || len(entries) != 0 {
+		t.Fatalf("List after purge = %v, %v", entries, err)
+	}
+
+	for _, opts := range []TrashOptions{{Audit: audit.NewLog(filepath.Join(t.TempDir(), "audit.log"), audit.LogOptions{})}, {Hooks: Hooks{HookPreDelete: "true"}}, {Quota: &QuotaOptions{}}} {
+		if _, err := NewMemoryTrash(opts); !errors.Is(err, ErrUnsupportedOption) {
+			t.Errorf("NewMemoryTrash(%+v) = %v, want ErrUnsupportedOption", opts, err)
+		}
+	}
+}
+
+func TestDefaultTrashesShareOneAuditLog(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer CloseDefaultTrash()
+	writable, err := DefaultTrash()
+	if err != nil {
+		t.Fatalf("DefaultTrash: %v", err)
+	}
+	readOnly, err := defaultTrash(true)
+	if err != nil {
+		t.Fatalf("read-only default trash: %v", err)
+	}
+	log := writable.(*dirTrash).auditLog
+	if log == nil || readOnly.(*dirTrash).auditLog != log {
+		t.Fatalf("audit logs %p and %p, want one shared log", log, readOnly.(*dirTrash).auditLog)
+	}
+
+	if err := CloseDefaultTrash(); err != nil {
+		t.Fatalf("CloseDefaultTrash: %v", err)
+	}
+	reopened, err := DefaultTrash()
+	if err != nil {
+		t.Fatalf("DefaultTrash after closing: %v", err)
+	}
+	if reopened == writable || reopened.(*dirTrash).auditLog == log {
+		t.Fatal("DefaultTrash kept the closed trash")
+	}
+}
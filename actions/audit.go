@@ -0,0 +1,73 @@
+package actions
+
+import (
+	"brm/audit"
+	"brm/config"
+	"brm/trash"
+	"path/filepath"
+)
+
+// defaultAuditLog is the audit log the configuration asks for, if any.
+// Paths stay out of it when the trash encrypts them. The default trashes
+// share one log per path until CloseDefaultTrash; the caller holds
+// defaultTrashes.
+func defaultAuditLog(cfg config.Config) *audit.Log {
+	if cfg.Audit.Disabled {
+		return nil
+	}
+	path, err := audit.DefaultPath()
+	if err != nil {
+		return nil
+	}
+	if log, ok := defaultTrashes.auditLogs[path]; ok {
+		return log
+	}
+	log := audit.NewLog(path, audit.LogOptions{
+		Syslog:    cfg.Audit.Syslog,
+		HidePaths: cfg.Encryption.Enabled && cfg.Encryption.EncryptPaths,
+	})
+	if defaultTrashes.auditLogs == nil {
+		defaultTrashes.auditLogs = make(map[string]*audit.Log)
+	}
+	defaultTrashes.auditLogs[path] = log
+	return log
+}
+
+// auditRecorder writes the audit records of a trash; without a log it
+// records nothing.
+type auditRecorder struct {
+	auditLog *audit.Log
+}
+
+// record appends op on entries to the audit log. The operation has happened
+// by then, so a log that cannot be written does not fail it.
+func (t auditRecorder) record(op string, entries []trash.TrashInfo, err error) {
+	if t.auditLog == nil {
+		return
+	}
+	rec := audit.Record{Op: op}
+	for _, entry := range entries {
+		if entry.TrashName != "" {
+			rec.TrashNames = append(rec.TrashNames, entry.TrashName)
+		}
+		if entry.OriginalPath != "" {
+			rec.Paths = append(rec.Paths, entry.OriginalPath)
+		}
+		if entry.Metadata != nil {
+			rec.Bytes += entry.Metadata.Size
+		}
+	}
+	_ = t.auditLog.Record(rec, err)
+}
+
+// recordPut records putting path, which failed before it had an entry when
+// err is set.
+func (t auditRecorder) recordPut(path string, entry trash.TrashInfo, err error) {
+	if err != nil && entry.OriginalPath == "" {
+		entry.OriginalPath = path
+		if absPath, absErr := filepath.Abs(path); absErr == nil {
+			entry.OriginalPath = absPath
+		}
+	}
+	t.record(audit.OpDelete, []trash.TrashInfo{entry}, err)
+}
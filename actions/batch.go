@@ -0,0 +1,155 @@
+package actions
+
+import (
+	"brm/trash"
+	"sync"
+	"time"
+)
+
+// A batch unlocks the index, letting other brm processes in, after every
+// batchChunkSize items and at least every batchChunkTime.
+const (
+	batchChunkSize = 256
+	batchChunkTime = 2 * time.Second
+)
+
+// Batcher is implemented by trashes that can put many items under few locks
+// of the index.
+type Batcher interface {
+	// PutBatch puts every path in turn and tells report how each went.
+	// A failing item does not stop the batch; the returned error is only
+	// about opening the index, and the paths not reported by then were
+	// left where they are.
+	PutBatch(paths []string, opts DeleteOptions, report func(path string, entry trash.TrashInfo, err error)) error
+}
+
+// PutBatch puts the batch in chunks, each under one lock of the index. Every
+// entry is written as soon as its item has moved, so a crash loses at most
+// the items moving at that moment, which --fsck recovers. With opts.Jobs
+// above one, items move concurrently while the index is written by one of
+// them at a time; report is still called in the order of paths.
+func (t *dirTrash) PutBatch(paths []string, opts DeleteOptions, report func(path string, entry trash.TrashInfo, err error)) error {
+	// One pre-delete hook decides for the whole batch.
+	if err := t.hooks.run(HookPreDelete, pathHookItems(paths...)); err != nil {
+		for _, path := range paths {
+			t.recordPut(path, trash.TrashInfo{}, err)
+			report(path, trash.TrashInfo{}, err)
+		}
+		return nil
+	}
+
+	var trashed []trash.TrashInfo
+	err := t.putBatch(paths, opts, currentDeleter(), func(path string, entry trash.TrashInfo, err error) {
+		if err == nil {
+			trashed = append(trashed, entry)
+		}
+		report(path, entry, err)
+	})
+	// Items put before a chunk failed are in the trash all the same.
+	t.hooks.runPost(HookPostDelete, trashed)
+	return err
+}
+
+func (t *dirTrash) putBatch(paths []string, opts DeleteOptions, who deleter, report func(path string, entry trash.TrashInfo, err error)) error {
+	bt := t
+	if opts.CopyRate > 0 {
+		throttled := *t
+		throttled.fs = throttledFS{t.fs, newRateLimiter(opts.CopyRate)}
+		bt = &throttled
+	}
+	for start := 0; start < len(paths); {
+		done, err := bt.putChunk(paths, start, opts, who, report)
+		if err != nil {
+			return err
+		}
+		start += done
+	}
+	return nil
+}
+
+// putChunk puts paths from start on under one lock of the index until
+// batchChunkSize items or batchChunkTime have gone by and releases the lock,
+// so other brm processes get their turn during a long batch. It returns how
+// many paths it took.
+func (t *dirTrash) putChunk(paths []string, start int, opts DeleteOptions, who deleter, report func(path string, entry trash.TrashInfo, err error)) (int, error) {
+	store, err := t.openStore()
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	if err := store.CheckWritable(); err != nil {
+		return 0, err
+	}
+
+	session := newPutSession(store)
+	end := min(start+batchChunkSize, len(paths))
+
+	type result struct {
+		index int
+		entry trash.TrashInfo
+		err   error
+	}
+	jobs := make(chan int)
+	results := make(chan result)
+	workers := min(max(opts.Jobs, 1), end-start)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				item, err := t.preparePut(paths[i], opts, who)
+				var entry trash.TrashInfo
+				if err == nil {
+					entry, err = t.put(session, item, opts)
+				}
+				t.recordPut(paths[i], entry, err)
+				results <- result{i, entry, err}
+			}
+		}()
+	}
+	deadline := time.Now().Add(batchChunkTime)
+	go func() {
+		// At least one item goes into every chunk.
+		for i := start; i < end && (i == start || time.Now().Before(deadline)); i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results come back in any order; hold them until their turn.
+	waiting := make(map[int]result)
+	next := start
+	for r := range results {
+		waiting[r.index] = r
+		for {
+			r, ok := waiting[next]
+			if !ok {
+				break
+			}
+			delete(waiting, next)
+			report(paths[next], r.entry, r.err)
+			next++
+		}
+	}
+	return next - start, nil
+}
+
+// SaveDeleteBatch trashes paths as one batch when the default trash
+// supports it and one by one otherwise.
+func SaveDeleteBatch(paths []string, opts DeleteOptions, report func(path string, entry trash.TrashInfo, err error)) error {
+	t, err := DefaultTrash()
+	if err != nil {
+		return err
+	}
+	if batcher, ok := t.(Batcher); ok {
+		return batcher.PutBatch(paths, opts, report)
+	}
+	for _, path := range paths {
+		entry, err := t.Put(path, opts)
+		report(path, entry, err)
+	}
+	return nil
+}
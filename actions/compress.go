@@ -0,0 +1,320 @@
+package actions
+
+import (
+	"archive/tar"
+	"brm/config"
+	"brm/crypt"
+	"brm/fsys"
+	"brm/trash"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+var ErrCompressUnsupported = errors.New("this trash cannot store compressed items")
+
+const archiveSuffix = ".tar.gz"
+
+// CompressPolicy selects the items a maintenance pass archives: those
+// deleted longer than OlderThan ago or at least MinSize bytes large.
+// Zero values disable the corresponding rule.
+type CompressPolicy struct {
+	OlderThan time.Duration
+	MinSize   int64
+}
+
+func (p CompressPolicy) Enabled() bool {
+	return p.OlderThan > 0 || p.MinSize > 0
+}
+
+func (p CompressPolicy) matches(entry trash.TrashInfo, now time.Time) bool {
+	if entry.Storage != trash.StoragePlain {
+		return false
+	}
+	if p.OlderThan > 0 && now.Sub(entry.DeletionDate) >= p.OlderThan {
+		return true
+	}
+	return p.MinSize > 0 && entry.Metadata != nil && entry.Metadata.Size >= p.MinSize
+}
+
+func DefaultCompressPolicy() (CompressPolicy, error) {
+	var policy CompressPolicy
+
+	cfg, err := config.Load()
+	if err != nil {
+		return policy, err
+	}
+	policy.OlderThan = time.Duration(cfg.Compress.OlderThanDays) * 24 * time.Hour
+	if cfg.Compress.MinSize != "" {
+		policy.MinSize, err = trash.ParseSize(cfg.Compress.MinSize)
+	}
+	return policy, err
+}
+
+// Compressor is implemented by trashes that can keep items as archives.
+type Compressor interface {
+	Compress(trashName string) (trash.TrashInfo, error)
+}
+
+// CompressTrash archives every item of t the policy selects and returns
+// their updated entries. Items that fail are reported but do not stop the pass.
+func CompressTrash(t Trash, policy CompressPolicy, now time.Time) ([]trash.TrashInfo, error) {
+	compressor, ok := t.(Compressor)
+	if !ok {
+		return nil, ErrCompressUnsupported
+	}
+	if !policy.Enabled() {
+		return nil, nil
+	}
+
+	entries, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed []trash.TrashInfo
+	var errs []error
+	for _, entry := range entries {
+		if !policy.matches(entry, now) {
+			continue
+		}
+		updated, err := compressor.Compress(entry.TrashName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.TrashName, err))
+			continue
+		}
+		compressed = append(compressed, updated)
+	}
+	return compressed, errors.Join(errs...)
+}
+
+func Compress(policy CompressPolicy) ([]trash.TrashInfo, error) {
+	t, err := DefaultTrash()
+	if err != nil {
+		return nil, err
+	}
+	return CompressTrash(t, policy, time.Now())
+}
+
+// writeArchive stores src as a gzipped tar at dst, encrypted with key
+// unless it is nil. The root of src is recorded as ".", so the archive can
+// be extracted under any name.
+func writeArchive(vfs fsys.FS, src, dst string, key *crypt.Key) (err error) {
+	output, err := vfs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := output.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = vfs.Remove(dst)
+		}
+	}()
+
+	var sealed io.WriteCloser = nopWriteCloser{output}
+	if key != nil {
+		if sealed, err = key.NewWriter(output); err != nil {
+			return err
+		}
+	}
+	gz := gzip.NewWriter(sealed)
+	tw := tar.NewWriter(gz)
+
+	err = fsys.WalkDir(vfs, src, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = vfs.Readlink(filePath); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			return fmt.Errorf("%s: unsupported file type %s", filePath, info.Mode().Type())
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		// PAX keeps sub-second modification times.
+		header.Format = tar.FormatPAX
+		header.Name = filepath.ToSlash(relPath)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		input, err := vfs.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer input.Close()
+		_, err = io.Copy(tw, input)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return sealed.Close()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// openArchive returns a tar reader for an archive written by writeArchive.
+func openArchive(vfs fsys.FS, src string, key *crypt.Key) (*tar.Reader, io.Closer, error) {
+	input, err := vfs.Open(src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var r io.Reader = input
+	if key != nil {
+		if r, err = key.NewReader(input); err != nil {
+			input.Close()
+			return nil, nil, err
+		}
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		input.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(gz), input, nil
+}
+
+// extractArchive recreates an archive written by writeArchive at dst with
+// the recorded modes, times and, where permitted, ownership.
+func extractArchive(vfs fsys.FS, src, dst string, key *crypt.Key) error {
+	tr, input, err := openArchive(vfs, src, key)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// Directories stay writable and keep their times until extraction ends.
+	var dirs []*tar.Header
+	var dirPaths []string
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		name := path.Clean(header.Name)
+		if name != "." && !filepath.IsLocal(name) {
+			return fmt.Errorf("%s: unsafe path in archive: %s", src, header.Name)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := vfs.Mkdir(target, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, header)
+			dirPaths = append(dirPaths, target)
+			continue
+		case tar.TypeSymlink:
+			// The os package cannot set times on a symlink itself.
+			if err := vfs.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(vfs, tr, target, header); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unsupported entry type in archive: %s", src, header.Name)
+		}
+		if err := restoreOwner(vfs, target, header); err != nil {
+			return err
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := vfs.Chmod(dirPaths[i], dirs[i].FileInfo().Mode().Perm()); err != nil {
+			return err
+		}
+		if err := vfs.Chtimes(dirPaths[i], accessTime(dirs[i]), dirs[i].ModTime); err != nil {
+			return err
+		}
+		if err := restoreOwner(vfs, dirPaths[i], dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(vfs fsys.FS, r io.Reader, target string, header *tar.Header) error {
+	mode := header.FileInfo().Mode().Perm()
+	output, err := vfs.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, r)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = vfs.Chmod(target, mode)
+	}
+	if err == nil {
+		err = vfs.Chtimes(target, accessTime(header), header.ModTime)
+	}
+	return err
+}
+
+func accessTime(header *tar.Header) time.Time {
+	if header.AccessTime.IsZero() {
+		return header.ModTime
+	}
+	return header.AccessTime
+}
+
+// restoreOwner gives the item back to its recorded owner. Only root may do
+// that for other users, so a permission error is not a failure.
+func restoreOwner(vfs fsys.FS, target string, header *tar.Header) error {
+	err := vfs.Lchown(target, header.Uid, header.Gid)
+	if errors.Is(err, fs.ErrPermission) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package actions
+
+import (
+	"brm/config"
+	"brm/fsys"
+	"brm/trash"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type DedupOptions struct {
+	// MinSize leaves smaller files in place; empty files are never deduplicated.
+	MinSize int64
+}
+
+// DefaultDedupOptions returns the deduplication settings from the config,
+// or nil when deduplication is not enabled there.
+func DefaultDedupOptions() *DedupOptions {
+	cfg, err := config.Load()
+	if err != nil || !cfg.Dedup.Enabled {
+		return nil
+	}
+	return &DedupOptions{MinSize: dedupMinSize(cfg)}
+}
+
+func dedupMinSize(cfg config.Config) int64 {
+	if cfg.Dedup.MinSize == "" {
+		return 0
+	}
+	size, err := trash.ParseSize(cfg.Dedup.MinSize)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// planBlobs hashes the regular files of the item at path that are worth
+// deduplicating. Nothing is changed yet, so the plan can be recorded in the
+// index before any file moves into the blob store.
+func planBlobs(vfs fsys.FS, path string, opts DedupOptions, md *trash.Metadata) ([]trash.Blob, error) {
+	var blobs []trash.Blob
+	err := fsys.WalkDir(vfs, path, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() == 0 || info.Size() < opts.MinSize {
+			return nil
+		}
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+
+		sum := ""
+		if relPath == "." && md != nil {
+			sum = md.SHA256
+		}
+		if sum == "" {
+			if sum, err = hashFile(vfs, filePath); err != nil {
+				return err
+			}
+		}
+
+		var owner trash.Metadata
+		fillOwnership(info, &owner)
+		blobs = append(blobs, trash.Blob{
+			Path:    relPath,
+			SHA256:  sum,
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+			UID:     owner.UID,
+			GID:     owner.GID,
+		})
+		return nil
+	})
+	return blobs, err
+}
+
+// storeBlobs moves the planned files of the item at itemPath into the blob
+// store, or drops them when an equal blob is already there.
+func storeBlobs(vfs fsys.FS, trashDir, itemPath string, blobs []trash.Blob) error {
+	for _, blob := range blobs {
+		filePath := filepath.Join(itemPath, blob.Path)
+		blobPath := trash.BlobPath(trashDir, blob.SHA256)
+
+		err := withWritableDir(vfs, filepath.Dir(filePath), func() error {
+			if info, err := vfs.Lstat(blobPath); err == nil {
+				if info.Size() != blob.Size {
+					return nil
+				}
+				return vfs.Remove(filePath)
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+			if err := vfs.MkdirAll(filepath.Dir(blobPath), 0700); err != nil {
+				return err
+			}
+			return vfs.Rename(filePath, blobPath)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// materializeBlobs puts back every file of the item at itemPath that lives
+// in the blob store. Files still present are kept, so an interrupted
+// storeBlobs or materializeBlobs can simply be repeated. refs counts the
+// references to each blob; the last one takes the blob instead of a copy.
+func materializeBlobs(vfs fsys.FS, trashDir, itemPath string, blobs []trash.Blob, refs map[string]int) error {
+	for _, blob := range blobs {
+		filePath := filepath.Join(itemPath, blob.Path)
+		blobPath := trash.BlobPath(trashDir, blob.SHA256)
+
+		if _, err := vfs.Lstat(filePath); err == nil {
+			refs[blob.SHA256]--
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		err := withWritableDir(vfs, filepath.Dir(filePath), func() error {
+			if refs[blob.SHA256] <= 1 {
+				return vfs.Rename(blobPath, filePath)
+			}
+			info, err := vfs.Lstat(blobPath)
+			if err != nil {
+				return err
+			}
+			return copyFile(vfs, blobPath, filePath, info)
+		})
+		if err != nil {
+			return err
+		}
+		refs[blob.SHA256]--
+
+		if err := vfs.Chmod(filePath, blob.Mode.Perm()); err != nil {
+			return err
+		}
+		if err := vfs.Chtimes(filePath, blob.ModTime, blob.ModTime); err != nil {
+			return err
+		}
+		if err := vfs.Lchown(filePath, int(blob.UID), int(blob.GID)); err != nil && !os.IsPermission(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropBlobs removes the blobs no entry in store refers to any more.
+func dropBlobs(vfs fsys.FS, store trash.Store, trashDir string, blobs []trash.Blob, opts PurgeOptions) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+	entries, err := store.All()
+	if err != nil {
+		return err
+	}
+	refs := trash.BlobRefs(entries)
+
+	for _, blob := range blobs {
+		if refs[blob.SHA256] > 0 {
+			continue
+		}
+		blobPath := trash.BlobPath(trashDir, blob.SHA256)
+		if _, err := vfs.Lstat(blobPath); os.IsNotExist(err) {
+			continue
+		}
+		if err := removeItem(vfs, blobPath, opts); err != nil {
+			return err
+		}
+		// The fan-out directory goes once its last blob does.
+		_ = vfs.Remove(filepath.Dir(blobPath))
+	}
+	return nil
+}
+
+// withWritableDir runs fn with dir temporarily writable by its owner, as
+// files of read-only directories move in and out of the blob store.
+func withWritableDir(vfs fsys.FS, dir string, fn func() error) error {
+	info, err := vfs.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	mode := info.Mode().Perm()
+	if mode&0200 != 0 {
+		return fn()
+	}
+
+	if err := vfs.Chmod(dir, mode|0700); err != nil {
+		return err
+	}
+	err = fn()
+	if chmodErr := vfs.Chmod(dir, mode); err == nil {
+		err = chmodErr
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package actions
+
+import "syscall"
+
+// diskSpace returns the size of the filesystem holding path and the bytes
+// available to unprivileged users on it.
+func diskSpace(path string) (total, free int64, ok bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, false
+	}
+	return int64(stat.Blocks) * int64(stat.Bsize), int64(stat.Bavail) * int64(stat.Bsize), true
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package actions
+
+func diskSpace(path string) (total, free int64, ok bool) {
+	return 0, 0, false
+}
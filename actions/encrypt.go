@@ -0,0 +1,191 @@
+package actions
+
+import (
+	"brm/config"
+	"brm/crypt"
+	"brm/trash"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyRequired        = errors.New("encrypted trash needs a passphrase or \"key_file\" in config")
+	ErrPassphraseMismatch = errors.New("the passphrases do not match")
+)
+
+const encryptedSuffix = ".enc"
+
+type EncryptOptions struct {
+	// EncryptPaths also keeps original paths, names and the deletion context
+	// out of the index, leaving only sizes and dates readable.
+	EncryptPaths bool
+}
+
+// PassphrasePrompt asks the user for the trash passphrase, or to repeat it
+// when confirm is set. Front ends set it; without it only a configured key
+// file can unlock encrypted items.
+var PassphrasePrompt func(confirm bool) ([]byte, error)
+
+var defaultKey struct {
+	sync.Mutex
+	key *crypt.Key
+}
+
+// DefaultKey unlocks encrypted items with the configured key file or else a
+// passphrase from PassphrasePrompt. The key is kept for the rest of the process.
+func DefaultKey() (*crypt.Key, error) {
+	defaultKey.Lock()
+	defer defaultKey.Unlock()
+	if defaultKey.key != nil {
+		return defaultKey.key, nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	paramsPath, err := crypt.GetParamsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var secret []byte
+	switch {
+	case cfg.Encryption.KeyFile != "":
+		secret, err = os.ReadFile(config.ExpandHome(cfg.Encryption.KeyFile))
+	case PassphrasePrompt != nil:
+		secret, err = readPassphrase(paramsPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, ErrKeyRequired
+	}
+
+	defaultKey.key, err = crypt.OpenKey(paramsPath, secret)
+	return defaultKey.key, err
+}
+
+// readPassphrase asks for the passphrase, and a second time when it is about
+// to create the key parameters at paramsPath: a typo there would lock away
+// everything encrypted with it.
+func readPassphrase(paramsPath string) ([]byte, error) {
+	secret, err := PassphrasePrompt(false)
+	if err != nil || len(secret) == 0 {
+		return secret, err
+	}
+	if _, err := os.Stat(paramsPath); !os.IsNotExist(err) {
+		return secret, nil
+	}
+	repeated, err := PassphrasePrompt(true)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(secret, repeated) {
+		return nil, ErrPassphraseMismatch
+	}
+	return secret, nil
+}
+
+func defaultEncryptOptions(cfg config.Config) *EncryptOptions {
+	if !cfg.Encryption.Enabled {
+		return nil
+	}
+	return &EncryptOptions{EncryptPaths: cfg.Encryption.EncryptPaths}
+}
+
+func (t *dirTrash) unlock() (*crypt.Key, error) {
+	if t.key == nil {
+		return nil, ErrKeyRequired
+	}
+	return t.key()
+}
+
+// putEncrypted writes an encrypted archive of the item and removes the item
+// only once the archive and its entry are in place.
+func (t *dirTrash) putEncrypted(s *putSession, item putItem, opts DeleteOptions) (trash.TrashInfo, error) {
+	key, err := t.unlock()
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	md := item.metadata
+	entry := trash.TrashInfo{
+		OriginalPath: item.absPath,
+		DeletionDate: time.Now(),
+		Metadata:     md,
+		Storage:      trash.StorageEncrypted,
+	}
+	// A plain hash would let anyone confirm a guess of the content.
+	md.SHA256 = ""
+
+	baseName := filepath.Base(item.absPath)
+	if t.encrypt.EncryptPaths {
+		if entry.EncryptedPath, err = key.SealString(item.absPath); err != nil {
+			return trash.TrashInfo{}, err
+		}
+		entry.OriginalPath = ""
+		md.SymlinkTarget, md.Cwd, md.CommandLine = "", "", nil
+
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return trash.TrashInfo{}, err
+		}
+		baseName = hex.EncodeToString(raw)
+	}
+
+	itemPath, err := s.begin(t, baseName, md.Size, true, opts)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	defer s.end(md.Size)
+	entry.TrashName = filepath.Base(itemPath)
+
+	storedPath := filepath.Join(t.root, entry.StoredName())
+	if err := writeArchive(t.fs, item.absPath, storedPath, key); err != nil {
+		return trash.TrashInfo{}, err
+	}
+	info, err := t.fs.Lstat(storedPath)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	entry.StoredSize = info.Size()
+
+	if err := s.add(entry); err != nil {
+		_ = t.fs.Remove(storedPath)
+		return trash.TrashInfo{}, err
+	}
+	return entry, t.fs.RemoveAll(item.absPath)
+}
+
+// originalPath returns where the item came from, decrypting it if needed.
+func (t *dirTrash) originalPath(entry trash.TrashInfo) (string, error) {
+	if entry.OriginalPath != "" || entry.EncryptedPath == "" {
+		return entry.OriginalPath, nil
+	}
+	key, err := t.unlock()
+	if err != nil {
+		return "", err
+	}
+	return key.OpenString(entry.EncryptedPath)
+}
+
+func (t *dirTrash) restoreEncrypted(storedPath string, entry trash.TrashInfo) error {
+	originalPath, err := t.originalPath(entry)
+	if err != nil {
+		return err
+	}
+	key, err := t.unlock()
+	if err != nil {
+		return err
+	}
+	return t.restoreArchive(storedPath, originalPath, key)
+}
@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The error texts are plain English; front ends translate them, see
+// flags.ErrorMessage.
+var (
+	ErrRemoveRoot      = errors.New("removing root directory is forbidden")
+	ErrRemoveTrashSelf = errors.New("path is inside the trash and can only be deleted permanently")
+	ErrProtectedPath   = errors.New("refusing to trash protected path")
+	ErrNotInTrash      = errors.New("path is not inside the trash")
+	ErrRestoreConflict = errors.New("restore target already exists")
+)
+
+// RuleGitRoot is the ProtectedPathError rule of a git repository root.
+const RuleGitRoot = "git-root"
+
+// ProtectedPathError refuses to delete Path. Err is ErrRemoveRoot,
+// ErrRemoveTrashSelf or ErrProtectedPath; Rule is the protection rule that
+// matched, if any.
+type ProtectedPathError struct {
+	Path string
+	Rule string
+	Err  error
+}
+
+func (e *ProtectedPathError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%v: %s", e.Err, e.Path)
+	}
+	return fmt.Sprintf("%v: %s (%s)", e.Err, e.Path, e.Rule)
+}
+
+func (e *ProtectedPathError) Unwrap() error { return e.Err }
+
+// ConflictError refuses to restore an item over Path, which already exists.
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrRestoreConflict, e.Path)
+}
+
+func (e *ConflictError) Unwrap() error { return ErrRestoreConflict }
+
+// NotInTrashError reports that Name, a trash name or path, is not an item of
+// the trash.
+type NotInTrashError struct {
+	Name string
+}
+
+func (e *NotInTrashError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrNotInTrash, e.Name)
+}
+
+func (e *NotInTrashError) Unwrap() error { return ErrNotInTrash }
+
+// CrossDeviceError reports that copying Source to Target on another
+// filesystem failed with Err. Source is left as it was.
+type CrossDeviceError struct {
+	Source string
+	Target string
+	Err    error
+}
+
+func (e *CrossDeviceError) Error() string {
+	return fmt.Sprintf("copying %s to %s across filesystems: %v", e.Source, e.Target, e.Err)
+}
+
+func (e *CrossDeviceError) Unwrap() error { return e.Err }
+
+// HookError reports that the Hook executable could not run or failed with
+// Err. From a pre-hook it vetoes the operation.
+type HookError struct {
+	Hook string
+	Err  error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook: %v", e.Hook, e.Err)
+}
+
+func (e *HookError) Unwrap() error { return e.Err }
@@ -0,0 +1,294 @@
+package actions
+
+import (
+	"brm/audit"
+	"brm/fsys"
+	"brm/trash"
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const trashInfoDateLayout = "2006-01-02T15:04:05"
+
+var errMissingPath = errors.New("missing Path")
+
+// freeDesktopTrash stores items following the FreeDesktop.org trash
+// specification: contents in files/ and a .trashinfo record in info/. It
+// honours hooks and the audit log; options that need brm's own index, such
+// as encryption and quotas, are refused.
+type freeDesktopTrash struct {
+	filesDir   string
+	infoDir    string
+	fs         fsys.FS
+	protection func() (*Protection, error)
+	hooks      Hooks
+	auditRecorder
+}
+
+func FreeDesktopTrashPath() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "Trash"), nil
+}
+
+func NewFreeDesktopTrash(root string, opts TrashOptions) (Trash, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkIndexOptions(opts); err != nil {
+		return nil, err
+	}
+
+	vfs := opts.FS
+	if vfs == nil {
+		vfs = fsys.OS{}
+	}
+
+	t := &freeDesktopTrash{
+		filesDir:      filepath.Join(absRoot, "files"),
+		infoDir:       filepath.Join(absRoot, "info"),
+		fs:            vfs,
+		protection:    protectionLoader(opts.Protection),
+		hooks:         opts.Hooks,
+		auditRecorder: auditRecorder{opts.Audit},
+	}
+	for _, dir := range []string{t.filesDir, t.infoDir} {
+		if err := vfs.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *freeDesktopTrash) Root() string {
+	return t.filesDir
+}
+
+func (t *freeDesktopTrash) infoPath(trashName string) string {
+	return filepath.Join(t.infoDir, trashName+".trashinfo")
+}
+
+// reserveName creates the .trashinfo file exclusively, which is how the
+// specification makes concurrent trashing of equally named files safe.
+func (t *freeDesktopTrash) reserveName(baseName string, entry trash.TrashInfo) (string, error) {
+	ext := filepath.Ext(baseName)
+	name := strings.TrimSuffix(baseName, ext)
+
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: entry.OriginalPath}).EscapedPath(), entry.DeletionDate.Format(trashInfoDateLayout))
+
+	trashName := baseName
+	for counter := 1; ; counter++ {
+		file, err := t.fs.OpenFile(t.infoPath(trashName), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = file.Write([]byte(content))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				t.fs.Remove(t.infoPath(trashName))
+				return "", err
+			}
+			if _, err := t.fs.Lstat(filepath.Join(t.filesDir, trashName)); err == nil {
+				t.fs.Remove(t.infoPath(trashName))
+			} else {
+				return trashName, nil
+			}
+		} else if !os.IsExist(err) {
+			return "", err
+		}
+		trashName = fmt.Sprintf("%s_%d%s", name, counter, ext)
+	}
+}
+
+func (t *freeDesktopTrash) Put(path string, opts DeleteOptions) (trash.TrashInfo, error) {
+	entry, err := t.put(path, opts)
+	t.recordPut(path, entry, err)
+	if err == nil {
+		t.hooks.runPost(HookPostDelete, []trash.TrashInfo{entry})
+	}
+	return entry, err
+}
+
+func (t *freeDesktopTrash) put(path string, opts DeleteOptions) (trash.TrashInfo, error) {
+	if opts.Dedup != nil {
+		return trash.TrashInfo{}, unsupportedOption("dedup")
+	}
+	if err := t.hooks.run(HookPreDelete, pathHookItems(path)); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	absSrcPath, err := filepath.Abs(path)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	if err := checkDeletable(t.fs, absSrcPath, t.filesDir, opts, t.protection); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	info, err := t.fs.Lstat(absSrcPath)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	entry := trash.TrashInfo{
+		OriginalPath: absSrcPath,
+		DeletionDate: time.Now(),
+	}
+	entry.TrashName, err = t.reserveName(filepath.Base(absSrcPath), entry)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	if err := moveItem(t.fs, absSrcPath, filepath.Join(t.filesDir, entry.TrashName), info); err != nil {
+		t.fs.Remove(t.infoPath(entry.TrashName))
+		return trash.TrashInfo{}, err
+	}
+	return entry, nil
+}
+
+func (t *freeDesktopTrash) Stat(trashName string) (trash.TrashInfo, error) {
+	if !validTrashName(trashName) {
+		return trash.TrashInfo{}, &NotInTrashError{Name: trashName}
+	}
+	file, err := t.fs.Open(t.infoPath(trashName))
+	if os.IsNotExist(err) {
+		return trash.TrashInfo{}, &NotInTrashError{Name: trashName}
+	} else if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	defer file.Close()
+
+	entry := trash.TrashInfo{TrashName: trashName}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			entry.OriginalPath, err = url.PathUnescape(value)
+			if err != nil {
+				return trash.TrashInfo{}, err
+			}
+		case "DeletionDate":
+			entry.DeletionDate, _ = time.ParseInLocation(trashInfoDateLayout, value, time.Local)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return trash.TrashInfo{}, err
+	}
+	if entry.OriginalPath == "" {
+		return trash.TrashInfo{}, &trash.IndexCorruptError{Path: t.infoPath(trashName), Err: errMissingPath}
+	}
+	return entry, nil
+}
+
+func (t *freeDesktopTrash) List() ([]trash.TrashInfo, error) {
+	dirEntries, err := t.fs.ReadDir(t.infoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []trash.TrashInfo
+	for _, dirEntry := range dirEntries {
+		trashName, ok := strings.CutSuffix(dirEntry.Name(), ".trashinfo")
+		if !ok {
+			continue
+		}
+		entry, err := t.Stat(trashName)
+		if errors.Is(err, trash.ErrIndexCorrupt) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (t *freeDesktopTrash) Restore(trashName string) error {
+	entry, err := t.Stat(trashName)
+	if err == nil {
+		err = t.hooks.run(HookPreRestore, hookItems([]trash.TrashInfo{entry}))
+	}
+	if err == nil {
+		err = t.restore(entry)
+	}
+	if entry.TrashName == "" {
+		entry.TrashName = trashName
+	}
+	t.record(audit.OpRestore, []trash.TrashInfo{entry}, err)
+	if err == nil {
+		t.hooks.runPost(HookPostRestore, []trash.TrashInfo{entry})
+	}
+	return err
+}
+
+func (t *freeDesktopTrash) restore(entry trash.TrashInfo) error {
+	trashName := entry.TrashName
+	trashFilePath := filepath.Join(t.filesDir, trashName)
+	info, err := t.fs.Lstat(trashFilePath)
+	if os.IsNotExist(err) {
+		return t.fs.Remove(t.infoPath(trashName))
+	} else if err != nil {
+		return err
+	}
+
+	if err := restoreItem(t.fs, trashFilePath, entry.OriginalPath, info); err != nil {
+		return err
+	}
+	return t.fs.Remove(t.infoPath(trashName))
+}
+
+// Purge deletes an item that has a .trashinfo record for good.
+func (t *freeDesktopTrash) Purge(trashName string, opts PurgeOptions) error {
+	entry, err := t.Stat(trashName)
+	if err == nil {
+		err = t.hooks.run(HookPrePurge, hookItems([]trash.TrashInfo{entry}))
+	}
+	if err == nil {
+		err = removeItem(t.fs, filepath.Join(t.filesDir, trashName), opts)
+	}
+	if err == nil {
+		err = t.fs.Remove(t.infoPath(trashName))
+	}
+	if entry.TrashName == "" {
+		entry.TrashName = trashName
+	}
+	t.record(audit.OpPurge, []trash.TrashInfo{entry}, err)
+	return err
+}
+
+func (t *freeDesktopTrash) Empty(opts PurgeOptions) error {
+	// List skips unreadable records, so the hook is not told about their
+	// files, which are deleted all the same.
+	entries, err := t.List()
+	if err == nil {
+		err = t.hooks.run(HookPrePurge, hookItems(entries))
+	}
+	if err == nil {
+		err = clearDir(t.fs, t.filesDir, opts)
+	}
+	if err == nil {
+		err = clearDir(t.fs, t.infoDir, PurgeOptions{})
+	}
+	t.record(audit.OpEmpty, entries, err)
+	return err
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package actions
+
+import "syscall"
+
+var filesystemKinds = map[int64]struct {
+	name string
+	kind int
+}{
+	0x9123683e: {"btrfs", fsCopyOnWrite},
+	0x2fc12fc1: {"zfs", fsCopyOnWrite},
+	0xca451a4e: {"bcachefs", fsCopyOnWrite},
+	0xf2f52010: {"f2fs", fsCopyOnWrite},
+	0x794c7630: {"overlayfs", fsCopyOnWrite},
+	0xef53:     {"ext3/ext4", fsJournaled},
+	0x58465342: {"xfs", fsJournaled},
+	0x3153464a: {"jfs", fsJournaled},
+	0x52654973: {"reiserfs", fsJournaled},
+	0x6969:     {"nfs", fsNetwork},
+	0xff534d42: {"cifs", fsNetwork},
+	0xfe534d42: {"smb2", fsNetwork},
+	0x65735546: {"fuse", fsNetwork},
+	0x01021994: {"tmpfs", fsInPlace},
+	0x4d44:     {"vfat", fsInPlace},
+}
+
+func filesystemKind(path string) (string, int) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", fsUnknown
+	}
+	if fsKind, ok := filesystemKinds[int64(stat.Type)]; ok {
+		return fsKind.name, fsKind.kind
+	}
+	return "", fsUnknown
+}
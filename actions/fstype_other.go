@@ -0,0 +1,7 @@
+//go:build !linux
+
+package actions
+
+func filesystemKind(path string) (string, int) {
+	return "", fsUnknown
+}
@@ -0,0 +1,124 @@
+package actions
+
+import (
+	"brm/config"
+	"brm/trash"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+var ErrUnknownHook = errors.New("unknown hook, expected pre-delete, post-delete, pre-restore, post-restore or pre-purge")
+
+const (
+	// HookPreDelete runs before items are moved to the trash.
+	HookPreDelete = "pre-delete"
+	// HookPostDelete runs after items were moved to the trash.
+	HookPostDelete = "post-delete"
+	// HookPreRestore runs before an item is restored.
+	HookPreRestore = "pre-restore"
+	// HookPostRestore runs after an item was restored.
+	HookPostRestore = "post-restore"
+	// HookPrePurge runs before items are deleted for good, by purge, empty,
+	// quota eviction or the expiry of the maintenance pass.
+	HookPrePurge = "pre-purge"
+)
+
+var hookNames = []string{HookPreDelete, HookPostDelete, HookPreRestore, HookPostRestore, HookPrePurge}
+
+// Hooks maps hook names to the executables run for them. A hook gets a
+// JSON description of the items on its standard input; a pre-hook that
+// fails vetoes the operation.
+type Hooks map[string]string
+
+// HookItem describes one item to a hook. Path is empty for items whose
+// original path is encrypted, TrashName before the item is in the trash.
+type HookItem struct {
+	Path      string `json:"path,omitempty"`
+	TrashName string `json:"trash_name,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+}
+
+type hookInput struct {
+	Hook  string     `json:"hook"`
+	Items []HookItem `json:"items"`
+}
+
+func defaultHooks(cfg config.Config) (Hooks, error) {
+	hooks := make(Hooks)
+	for name, command := range cfg.Hooks {
+		known := false
+		for _, hookName := range hookNames {
+			known = known || name == hookName
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownHook, name)
+		}
+		if command != "" {
+			hooks[name] = config.ExpandHome(command)
+		}
+	}
+	return hooks, nil
+}
+
+func hookItems(entries []trash.TrashInfo) []HookItem {
+	items := make([]HookItem, 0, len(entries))
+	for _, entry := range entries {
+		item := HookItem{Path: entry.OriginalPath, TrashName: entry.TrashName}
+		if entry.Metadata != nil {
+			item.Size = entry.Metadata.Size
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// pathHookItems describes paths about to be deleted.
+func pathHookItems(paths ...string) []HookItem {
+	items := make([]HookItem, 0, len(paths))
+	for _, path := range paths {
+		if absPath, err := filepath.Abs(path); err == nil {
+			path = absPath
+		}
+		items = append(items, HookItem{Path: path})
+	}
+	return items
+}
+
+// run runs the hook name, if there is one, on items. Its output goes to
+// standard error, so it never mixes with what brm prints. Hooks run while
+// the index is not locked, so they may call brm themselves; only the
+// pre-purge hook of a quota eviction runs in the middle of a deletion, with
+// the index locked.
+func (h Hooks) run(name string, items []HookItem) error {
+	command := h[name]
+	if command == "" || len(items) == 0 {
+		return nil
+	}
+	input, err := json.Marshal(hookInput{Hook: name, Items: items})
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "BRM_HOOK="+name)
+	if err := cmd.Run(); err != nil {
+		return &HookError{Hook: name, Err: err}
+	}
+	return nil
+}
+
+// runPost runs a post-hook. The operation is done by then, so a failing
+// hook does not fail it; the hook reports its own errors.
+func (h Hooks) runPost(name string, entries []trash.TrashInfo) {
+	if len(entries) > 0 {
+		_ = h.run(name, hookItems(entries))
+	}
+}
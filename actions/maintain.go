@@ -0,0 +1,130 @@
+package actions
+
+import (
+	"brm/config"
+	"brm/trash"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const DefaultMaintainInterval = time.Hour
+
+// MaintainPolicy is what a maintenance pass does besides checking the
+// index: purge items older than MaxAge and archive what Compress selects.
+// Interval is how often the daemon runs the pass. Repair lets the pass fix
+// the index as well; unattended runs should not rewrite it by default.
+type MaintainPolicy struct {
+	MaxAge   time.Duration
+	Compress CompressPolicy
+	Interval time.Duration
+	Repair   bool
+}
+
+type MaintainReport struct {
+	Fsck       trash.FsckReport
+	Expired    []trash.TrashInfo
+	Evicted    []trash.TrashInfo
+	Compressed []trash.TrashInfo
+	// Repaired is set when the problems in Fsck were fixed rather than
+	// only found.
+	Repaired bool
+}
+
+func DefaultMaintainPolicy() (MaintainPolicy, error) {
+	policy := MaintainPolicy{Interval: DefaultMaintainInterval}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return policy, err
+	}
+	policy.MaxAge = time.Duration(cfg.Retention.MaxAgeDays) * 24 * time.Hour
+	policy.Repair = cfg.Maintenance.Repair
+	if cfg.Maintenance.Interval != "" {
+		interval, err := time.ParseDuration(cfg.Maintenance.Interval)
+		if err != nil {
+			return policy, err
+		}
+		if interval <= 0 {
+			return policy, fmt.Errorf("invalid maintenance interval %q", cfg.Maintenance.Interval)
+		}
+		policy.Interval = interval
+	}
+	policy.Compress, err = DefaultCompressPolicy()
+	return policy, err
+}
+
+// MaintainTrash purges expired items, evicts items over the quota and then
+// compresses what is left. A failing step does not stop the others.
+func MaintainTrash(t Trash, policy MaintainPolicy, now time.Time) (MaintainReport, error) {
+	var report MaintainReport
+	var errs []error
+
+	if policy.MaxAge > 0 {
+		expired, err := expireTrash(t, policy.MaxAge, now)
+		report.Expired = expired
+		errs = append(errs, err)
+	}
+	if enforcer, ok := t.(QuotaEnforcer); ok {
+		evicted, err := enforcer.EnforceQuota()
+		report.Evicted = evicted
+		errs = append(errs, err)
+	}
+	if policy.Compress.Enabled() {
+		compressed, err := CompressTrash(t, policy.Compress, now)
+		report.Compressed = compressed
+		if !errors.Is(err, ErrCompressUnsupported) {
+			errs = append(errs, err)
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+func expireTrash(t Trash, maxAge time.Duration, now time.Time) ([]trash.TrashInfo, error) {
+	entries, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []trash.TrashInfo
+	var errs []error
+	for _, entry := range entries {
+		if now.Sub(entry.DeletionDate) < maxAge {
+			continue
+		}
+		if err := t.Purge(entry.TrashName, PurgeOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.TrashName, err))
+			continue
+		}
+		expired = append(expired, entry)
+	}
+	return expired, errors.Join(errs...)
+}
+
+// Maintain checks the index of the default trash like --fsck, repairing it
+// only when policy.Repair is set, and then runs MaintainTrash on it.
+func Maintain(policy MaintainPolicy) (MaintainReport, error) {
+	var report MaintainReport
+
+	trashPath, err := GetTrashPath()
+	if err != nil {
+		return report, err
+	}
+	trashInfoPath, err := trash.GetTrashInfoPath()
+	if err != nil {
+		return report, err
+	}
+	fsckReport, err := trash.Fsck(trashPath, trashInfoPath, policy.Repair)
+	if err != nil {
+		return report, err
+	}
+
+	t, err := DefaultTrash()
+	if err != nil {
+		return report, err
+	}
+	report, err = MaintainTrash(t, policy, time.Now())
+	report.Fsck = fsckReport
+	report.Repaired = policy.Repair
+	return report, err
+}
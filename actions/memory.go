@@ -0,0 +1,241 @@
+package actions
+
+import (
+	"brm/fsys"
+	"brm/trash"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryNode struct {
+	relPath string
+	mode    fs.FileMode
+	data    []byte
+	target  string
+}
+
+type memoryItem struct {
+	entry trash.TrashInfo
+	nodes []memoryNode
+}
+
+// memoryTrash keeps trashed content in memory. Nothing survives the process,
+// which makes it useful for tests and short-lived tools.
+type memoryTrash struct {
+	mu         sync.Mutex
+	items      map[string]memoryItem
+	fs         fsys.FS
+	protection func() (*Protection, error)
+}
+
+// NewMemoryTrash makes a trash that keeps items in memory. Of the options
+// only FS and Protection apply; the others are refused.
+func NewMemoryTrash(opts TrashOptions) (Trash, error) {
+	if err := checkIndexOptions(opts); err != nil {
+		return nil, err
+	}
+	if opts.Audit != nil {
+		return nil, unsupportedOption("audit")
+	}
+	if len(opts.Hooks) > 0 {
+		return nil, unsupportedOption("hooks")
+	}
+	vfs := opts.FS
+	if vfs == nil {
+		vfs = fsys.OS{}
+	}
+	return &memoryTrash{
+		items:      make(map[string]memoryItem),
+		fs:         vfs,
+		protection: protectionLoader(opts.Protection),
+	}, nil
+}
+
+func (t *memoryTrash) Root() string {
+	return ""
+}
+
+func snapshotTree(vfs fsys.FS, root string) ([]memoryNode, error) {
+	var nodes []memoryNode
+	err := fsys.WalkDir(vfs, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		node := memoryNode{relPath: relPath, mode: info.Mode()}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			node.target, err = vfs.Readlink(path)
+		case info.Mode().IsRegular():
+			node.data, err = fsys.ReadFile(vfs, path)
+		}
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, node)
+		return nil
+	})
+	return nodes, err
+}
+
+func writeTree(vfs fsys.FS, root string, nodes []memoryNode) error {
+	for _, node := range nodes {
+		path := filepath.Join(root, node.relPath)
+		var err error
+		switch {
+		case node.mode.IsDir():
+			err = vfs.MkdirAll(path, node.mode.Perm()|0700)
+		case node.mode&os.ModeSymlink != 0:
+			err = vfs.Symlink(node.target, path)
+		default:
+			err = fsys.WriteFile(vfs, path, node.data, node.mode.Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Directories were created writable so their children could be restored.
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if nodes[i].mode.IsDir() {
+			if err := vfs.Chmod(filepath.Join(root, nodes[i].relPath), nodes[i].mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *memoryTrash) uniqueName(baseName string) string {
+	ext := filepath.Ext(baseName)
+	name := strings.TrimSuffix(baseName, ext)
+
+	uniqueName := baseName
+	for counter := 1; ; counter++ {
+		if _, ok := t.items[uniqueName]; !ok {
+			return uniqueName
+		}
+		uniqueName = fmt.Sprintf("%s_%d%s", name, counter, ext)
+	}
+}
+
+func (t *memoryTrash) Put(path string, opts DeleteOptions) (trash.TrashInfo, error) {
+	absSrcPath, err := filepath.Abs(path)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	if opts.Dedup != nil {
+		return trash.TrashInfo{}, unsupportedOption("dedup")
+	}
+	if err := checkDeletable(t.fs, absSrcPath, "", opts, t.protection); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	metadata, err := collectMetadata(t.fs, absSrcPath, currentDeleter())
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	nodes, err := snapshotTree(t.fs, absSrcPath)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	if err := t.fs.RemoveAll(absSrcPath); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := trash.TrashInfo{
+		TrashName:    t.uniqueName(filepath.Base(absSrcPath)),
+		OriginalPath: absSrcPath,
+		DeletionDate: time.Now(),
+		Metadata:     metadata,
+	}
+	t.items[entry.TrashName] = memoryItem{entry: entry, nodes: nodes}
+	return entry, nil
+}
+
+func (t *memoryTrash) List() ([]trash.TrashInfo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := make([]trash.TrashInfo, 0, len(t.items))
+	for _, item := range t.items {
+		entries = append(entries, item.entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletionDate.Before(entries[j].DeletionDate)
+	})
+	return entries, nil
+}
+
+func (t *memoryTrash) Stat(trashName string) (trash.TrashInfo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, ok := t.items[trashName]
+	if !ok {
+		return trash.TrashInfo{}, &NotInTrashError{Name: trashName}
+	}
+	return item.entry, nil
+}
+
+func (t *memoryTrash) Restore(trashName string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, ok := t.items[trashName]
+	if !ok {
+		return &NotInTrashError{Name: trashName}
+	}
+
+	originalPath := item.entry.OriginalPath
+	if _, err := t.fs.Lstat(originalPath); err == nil {
+		return &ConflictError{Path: originalPath}
+	}
+	if err := t.fs.MkdirAll(filepath.Dir(originalPath), 0755); err != nil {
+		return err
+	}
+	if err := writeTree(t.fs, originalPath, item.nodes); err != nil {
+		return err
+	}
+
+	delete(t.items, trashName)
+	return nil
+}
+
+func (t *memoryTrash) Purge(trashName string, opts PurgeOptions) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.items[trashName]; !ok {
+		return &NotInTrashError{Name: trashName}
+	}
+	delete(t.items, trashName)
+	return nil
+}
+
+func (t *memoryTrash) Empty(opts PurgeOptions) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.items = make(map[string]memoryItem)
+	return nil
+}
@@ -0,0 +1,103 @@
+package actions
+
+import (
+	"brm/audit"
+	"brm/fsys"
+	"brm/trash"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+)
+
+// deleter is who deletes items, from where and with what command. It is the
+// same for every item of a run, so it is looked up once per Put or batch.
+type deleter struct {
+	user        string
+	hostname    string
+	cwd         string
+	commandLine []string
+}
+
+func currentDeleter() deleter {
+	who := deleter{commandLine: audit.CommandLine()}
+	if u, err := user.Current(); err == nil {
+		who.user = u.Username
+	}
+	who.hostname, _ = os.Hostname()
+	who.cwd, _ = os.Getwd()
+	return who
+}
+
+// collectMetadata describes the item at absPath, deleted by who. Only a
+// failing Lstat fails it, rather than keeping the item out of the trash: a
+// directory that cannot be walked completely gets the size of what could be
+// read with SizeUnknown set, and a file that cannot be read no hash.
+func collectMetadata(vfs fsys.FS, absPath string, who deleter) (*trash.Metadata, error) {
+	info, err := vfs.Lstat(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &trash.Metadata{
+		Size:        info.Size(),
+		FileCount:   1,
+		Mode:        info.Mode(),
+		ModTime:     info.ModTime(),
+		CommandLine: who.commandLine,
+		DeletedBy:   who.user,
+		Hostname:    who.hostname,
+		Cwd:         who.cwd,
+	}
+	fillOwnership(info, md)
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		md.SymlinkTarget, _ = vfs.Readlink(absPath)
+	case info.IsDir():
+		md.Size, md.FileCount, err = dirUsage(vfs, absPath)
+		md.SizeUnknown = err != nil
+	case info.Mode().IsRegular():
+		md.SHA256, _ = hashFile(vfs, absPath)
+	}
+
+	return md, nil
+}
+
+func dirUsage(vfs fsys.FS, dir string) (int64, int64, error) {
+	var size, count int64
+	err := fsys.WalkDir(vfs, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		count++
+		return nil
+	})
+	return size, count, err
+}
+
+// hashFile streams the file through the hash, so files of any size are
+// hashed in constant memory.
+func hashFile(vfs fsys.FS, path string) (string, error) {
+	file, err := vfs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package actions
+
+import (
+	"brm/trash"
+	"os"
+)
+
+func fillOwnership(info os.FileInfo, md *trash.Metadata) {}
+
+func linkCount(info os.FileInfo) uint64 {
+	return 1
+}
+
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package actions
+
+import (
+	"brm/trash"
+	"os"
+	"syscall"
+)
+
+func fillOwnership(info os.FileInfo, md *trash.Metadata) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	md.UID = stat.Uid
+	md.GID = stat.Gid
+	md.Inode = uint64(stat.Ino)
+	md.Device = uint64(stat.Dev)
+}
+
+// linkCount is how many hard links share the data of the file.
+func linkCount(info os.FileInfo) uint64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1
+	}
+	return uint64(stat.Nlink)
+}
+
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
@@ -0,0 +1,420 @@
+package actions
+
+import (
+	"brm/fsys"
+	"brm/trash"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrDryRunUnsupported = errors.New("this trash cannot plan a dry run")
+
+// Actions of plan steps.
+const (
+	PlanMove    = "move"
+	PlanCopy    = "copy"
+	PlanEncrypt = "encrypt"
+	PlanEvict   = "evict"
+	PlanRestore = "restore"
+	PlanPurge   = "purge"
+)
+
+// PlanStep is one change an operation would make. Size is the size of the
+// item and CopyBytes how much of it would be written anew rather than
+// renamed in place.
+type PlanStep struct {
+	Action    string
+	TrashName string
+	Source    string
+	Target    string
+	Size      int64
+	CopyBytes int64
+}
+
+// Planner is implemented by trashes that can work out what an operation
+// would do, running the same checks as the operation without changing
+// anything.
+type Planner interface {
+	PlanPut(path string, opts DeleteOptions) ([]PlanStep, error)
+	// PlanPuts starts planning the puts of one run.
+	PlanPuts() (PutPlan, error)
+	PlanRestore(trashName string) ([]PlanStep, error)
+	PlanPurge(trashName string) ([]PlanStep, error)
+	PlanEmpty() ([]PlanStep, error)
+}
+
+// PutPlan plans the puts of one run item by item. Each item sees the ones
+// planned before it, as it would in the run: they keep their trash names,
+// count against the quota and take free space when copied.
+type PutPlan interface {
+	PlanPut(path string, opts DeleteOptions) ([]PlanStep, error)
+}
+
+// PlanPut plans putting path on its own.
+func (t *dirTrash) PlanPut(path string, opts DeleteOptions) ([]PlanStep, error) {
+	plan, err := t.PlanPuts()
+	if err != nil {
+		return nil, err
+	}
+	return plan.PlanPut(path, opts)
+}
+
+// putPlan is the dry run of a putSession. It works on a copy of the index:
+// planned entries are added to it and planned evictions removed.
+type putPlan struct {
+	t        dirTrash
+	store    trash.Store
+	reserved map[string]bool
+	copied   int64
+}
+
+func (t *dirTrash) PlanPuts() (PutPlan, error) {
+	store, err := t.openStoreReadOnly()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := store.CheckWritable(); err != nil {
+		return nil, err
+	}
+	entries, err := store.All()
+	if err != nil {
+		return nil, err
+	}
+	planned := trash.NewMemoryStore()
+	if err := planned.Replace(entries); err != nil {
+		return nil, err
+	}
+
+	p := &putPlan{t: *t, store: planned, reserved: make(map[string]bool)}
+	p.t.space = func(path string) (int64, int64, bool) {
+		total, free, ok := t.space(path)
+		return total, free - p.copied, ok
+	}
+	return p, nil
+}
+
+func (p *putPlan) PlanPut(path string, opts DeleteOptions) ([]PlanStep, error) {
+	t := &p.t
+	absSrcPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDeletable(t.fs, absSrcPath, t.root, opts, t.protection); err != nil {
+		return nil, err
+	}
+	info, err := t.fs.Lstat(absSrcPath)
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if info.IsDir() {
+		if size, _, err = dirUsage(t.fs, absSrcPath); err != nil {
+			return nil, err
+		}
+	}
+
+	needsCopy := t.needsCopy(info)
+	victims, err := t.roomVictims(p.store, size, needsCopy)
+	if len(victims) == 0 && err != nil {
+		return nil, err
+	}
+	var steps []PlanStep
+	var evicted []string
+	for _, victim := range victims {
+		steps = append(steps, PlanStep{
+			Action:    PlanEvict,
+			TrashName: victim.TrashName,
+			Source:    filepath.Join(t.root, victim.StoredName()),
+			Size:      storedSize(victim),
+		})
+		evicted = append(evicted, victim.TrashName)
+	}
+
+	dstPath, err := uniquePath(t.fs, t.root, filepath.Base(absSrcPath), func(name string) bool { return p.reserved[name] })
+	if err != nil {
+		return nil, err
+	}
+	step := PlanStep{
+		Action:    PlanMove,
+		TrashName: filepath.Base(dstPath),
+		Source:    absSrcPath,
+		Target:    dstPath,
+		Size:      size,
+	}
+	switch {
+	case t.encrypt != nil:
+		step.Action, step.Target, step.CopyBytes = PlanEncrypt, dstPath+encryptedSuffix, size
+	case needsCopy:
+		step.Action, step.CopyBytes = PlanCopy, size
+	}
+
+	if err := p.store.Remove(evicted...); err != nil {
+		return nil, err
+	}
+	err = p.store.Add(trash.TrashInfo{
+		TrashName:    step.TrashName,
+		OriginalPath: absSrcPath,
+		DeletionDate: time.Now(),
+		Metadata:     &trash.Metadata{Size: size},
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.reserved[step.TrashName] = true
+	if needsCopy {
+		p.copied += size
+	}
+	return append(steps, step), nil
+}
+
+func (t *dirTrash) PlanRestore(trashName string) ([]PlanStep, error) {
+	store, err := t.openStoreReadOnly()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	entry, err := lookup(store, trashName)
+	if err != nil {
+		return nil, err
+	}
+	originalPath, err := t.originalPath(entry)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.fs.Lstat(originalPath); err == nil {
+		return nil, &ConflictError{Path: originalPath}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	storedPath := filepath.Join(t.root, entry.StoredName())
+	step := PlanStep{
+		Action:    PlanRestore,
+		TrashName: entry.TrashName,
+		Source:    storedPath,
+		Target:    originalPath,
+	}
+	if step.Size, err = t.entrySize(entry); err != nil {
+		return nil, err
+	}
+
+	switch entry.Storage {
+	case trash.StorageTarGzip, trash.StorageEncrypted:
+		step.CopyBytes = step.Size
+	case trash.StorageDedup:
+		for _, blob := range entry.Blobs {
+			step.CopyBytes += blob.Size
+		}
+	default:
+		if t.crossesDevice(storedPath, originalPath) {
+			step.CopyBytes = step.Size
+		}
+	}
+	return []PlanStep{step}, nil
+}
+
+func (t *dirTrash) PlanPurge(trashName string) ([]PlanStep, error) {
+	store, err := t.openStoreReadOnly()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	entry, err := lookup(store, trashName)
+	if err != nil {
+		return nil, err
+	}
+	return []PlanStep{{
+		Action:    PlanPurge,
+		TrashName: entry.TrashName,
+		Source:    filepath.Join(t.root, entry.StoredName()),
+		Size:      storedSize(entry),
+	}}, nil
+}
+
+// PlanEmpty lists everything in the trash directory, since Empty removes
+// items that are missing from the index as well. The blob store is not an
+// item; its blobs go with the items that use them.
+func (t *dirTrash) PlanEmpty() ([]PlanStep, error) {
+	dirEntries, err := t.fs.ReadDir(t.root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	steps := make([]PlanStep, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if dirEntry.Name() == trash.BlobDirName {
+			continue
+		}
+		itemPath := filepath.Join(t.root, dirEntry.Name())
+		size, _, err := dirUsage(t.fs, itemPath)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, PlanStep{
+			Action:    PlanPurge,
+			TrashName: dirEntry.Name(),
+			Source:    itemPath,
+			Size:      size,
+		})
+	}
+	return steps, nil
+}
+
+// entrySize is the size of the item as it was deleted, measured in the
+// trash for entries without metadata.
+func (t *dirTrash) entrySize(entry trash.TrashInfo) (int64, error) {
+	if entry.Metadata != nil {
+		return entry.Metadata.Size, nil
+	}
+	size, _, err := t.measure(entry)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// crossesDevice reports whether moving the item at src to dst would copy
+// it. dst does not need to exist; its closest existing parent is checked.
+func (t *dirTrash) crossesDevice(src, dst string) bool {
+	srcInfo, err := t.fs.Lstat(src)
+	if err != nil {
+		return false
+	}
+	dir := filepath.Dir(dst)
+	dirInfo, err := t.fs.Stat(dir)
+	for err != nil && os.IsNotExist(err) && dir != filepath.Dir(dir) {
+		dir = filepath.Dir(dir)
+		dirInfo, err = t.fs.Stat(dir)
+	}
+	if err != nil {
+		return false
+	}
+	srcDevice, ok := deviceOf(srcInfo)
+	dirDevice, dirOK := deviceOf(dirInfo)
+	return ok && dirOK && srcDevice != dirDevice
+}
+
+// defaultPlanner opens the default trash read-only, so that a dry run
+// creates, locks and upgrades nothing.
+func defaultPlanner() (Planner, Trash, error) {
+	t, err := defaultTrash(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	planner, ok := t.(Planner)
+	if !ok {
+		return nil, nil, ErrDryRunUnsupported
+	}
+	return planner, t, nil
+}
+
+// PlanDelete is the dry run of SaveDelete.
+func PlanDelete(srcPath string, opts DeleteOptions) ([]PlanStep, error) {
+	return new(DeletePlan).Plan(srcPath, opts)
+}
+
+// DeletePlan is the dry run of SaveDelete for every path of one run, e.g.
+// "brm -n a/x b/x", which plans distinct trash names for the two. The zero
+// value is ready to use; the trash is opened on the first Plan.
+type DeletePlan struct {
+	plan   PutPlan
+	err    error
+	opened bool
+}
+
+func (p *DeletePlan) Plan(srcPath string, opts DeleteOptions) ([]PlanStep, error) {
+	if !p.opened {
+		p.opened = true
+		var planner Planner
+		if planner, _, p.err = defaultPlanner(); p.err == nil {
+			p.plan, p.err = planner.PlanPuts()
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.plan.PlanPut(srcPath, opts)
+}
+
+// PlanRestoreItem is the dry run of RestoreItem.
+func PlanRestoreItem(name string) ([]PlanStep, error) {
+	planner, t, err := defaultPlanner()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := FindInTrash(t, name)
+	if err != nil {
+		return nil, err
+	}
+	return planner.PlanRestore(entry.TrashName)
+}
+
+// PlanPurgeItem is the dry run of PurgeItem.
+func PlanPurgeItem(name string) ([]PlanStep, error) {
+	planner, t, err := defaultPlanner()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := FindInTrash(t, name)
+	if err != nil {
+		return nil, err
+	}
+	return planner.PlanPurge(entry.TrashName)
+}
+
+// PlanEmptyTrash is the dry run of EmptyTrash.
+func PlanEmptyTrash() ([]PlanStep, error) {
+	planner, _, err := defaultPlanner()
+	if err != nil {
+		return nil, err
+	}
+	return planner.PlanEmpty()
+}
+
+// PlanPermanentDelete is the dry run of PermanentDelete.
+func PlanPermanentDelete(path string) ([]PlanStep, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	planner, t, err := defaultPlanner()
+	if err != nil {
+		return nil, err
+	}
+
+	if absPath == t.Root() {
+		return planner.PlanEmpty()
+	}
+	if !isAncestor(t.Root(), absPath) {
+		return nil, &NotInTrashError{Name: path}
+	}
+	relPath, err := filepath.Rel(t.Root(), absPath)
+	if err != nil {
+		return nil, err
+	}
+	if strings.SplitN(relPath, string(filepath.Separator), 2)[0] == trash.BlobDirName {
+		return nil, &NotInTrashError{Name: path}
+	}
+	if !strings.ContainsRune(relPath, filepath.Separator) {
+		// As in PermanentDelete, files the index has lost are deleted by
+		// path.
+		steps, err := planner.PlanPurge(relPath)
+		var notInTrash *NotInTrashError
+		if !errors.As(err, &notInTrash) {
+			return steps, err
+		}
+	}
+
+	size, _, err := dirUsage(fsys.OS{}, absPath)
+	if err != nil {
+		return nil, err
+	}
+	return []PlanStep{{Action: PlanPurge, Source: absPath, Size: size}}, nil
+}
@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"archive/tar"
+	"brm/crypt"
+	"brm/trash"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrNotAFile = errors.New("only files can be previewed")
+
+// Opener is implemented by trashes that can read a trashed file in place,
+// whatever form it is stored in.
+type Opener interface {
+	Open(trashName string) (io.ReadCloser, error)
+}
+
+type archiveFile struct {
+	io.Reader
+	io.Closer
+}
+
+func (t *dirTrash) Open(trashName string) (io.ReadCloser, error) {
+	store, err := t.openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	entry, err := lookup(store, trashName)
+	if err != nil {
+		return nil, err
+	}
+	storedPath := filepath.Join(t.root, entry.StoredName())
+
+	switch entry.Storage {
+	case trash.StorageTarGzip, trash.StorageEncrypted:
+		var key *crypt.Key
+		if entry.Storage == trash.StorageEncrypted {
+			if key, err = t.unlock(); err != nil {
+				return nil, err
+			}
+		}
+		tr, closer, err := openArchive(t.fs, storedPath, key)
+		if err != nil {
+			return nil, err
+		}
+		header, err := tr.Next()
+		if err == nil && header.Typeflag != tar.TypeReg {
+			err = ErrNotAFile
+		}
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+		return archiveFile{tr, closer}, nil
+
+	case trash.StorageDedup:
+		if _, err := t.fs.Lstat(storedPath); os.IsNotExist(err) {
+			for _, blob := range entry.Blobs {
+				if blob.Path == "." {
+					return t.fs.Open(trash.BlobPath(t.root, blob.SHA256))
+				}
+			}
+		}
+	}
+
+	info, err := t.fs.Lstat(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, ErrNotAFile
+	}
+	return t.fs.Open(storedPath)
+}
+
+// Preview returns up to limit bytes from the start of a trashed file,
+// decompressing or decrypting it as needed.
+func Preview(trashName string, limit int64) ([]byte, error) {
+	t, err := DefaultTrash()
+	if err != nil {
+		return nil, err
+	}
+	opener, ok := t.(Opener)
+	if !ok {
+		return nil, ErrNotAFile
+	}
+
+	file, err := opener.Open(trashName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, limit))
+}
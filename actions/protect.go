@@ -0,0 +1,187 @@
+package actions
+
+import (
+	"brm/config"
+	"brm/fsys"
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var systemDirs = []string{
+	"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/opt", "/proc",
+	"/root", "/run", "/sbin", "/srv", "/sys", "/usr", "/var",
+}
+
+var mountEscapes = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+func defaultProtectedPaths() []string {
+	paths := append([]string{}, systemDirs...)
+
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, home)
+	}
+	if stateDir, err := config.GetStateDir(); err == nil {
+		paths = append(paths, stateDir)
+	}
+
+	return append(paths, mountPoints()...)
+}
+
+func mountPoints() []string {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var mounts []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		mounts = append(mounts, mountEscapes.Replace(fields[1]))
+	}
+	return mounts
+}
+
+// errGitRootFound stops the walk in findGitRoot.
+var errGitRootFound = errors.New("git root found")
+
+// findGitRoot returns the root of a git repository at or inside path, so
+// trashing a directory never takes a repository with it. Unreadable
+// directories are skipped.
+func findGitRoot(vfs fsys.FS, path string) (string, bool) {
+	var root string
+	err := fsys.WalkDir(vfs, path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d == nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if _, err := vfs.Lstat(filepath.Join(p, ".git")); err == nil {
+			root = p
+			return errGitRootFound
+		}
+		return nil
+	})
+	return root, err == errGitRootFound
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func isAncestor(dir, path string) bool {
+	if dir == "/" {
+		return path != "/"
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, string(filepath.Separator))
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, string(filepath.Separator))
+}
+
+// mayContainMatch reports whether a match of pattern could lie inside dir:
+// each component of dir matches the pattern component at its depth.
+func mayContainMatch(dir, pattern string) bool {
+	dirParts, patternParts := splitPath(dir), splitPath(pattern)
+	if len(dirParts) >= len(patternParts) {
+		return false
+	}
+	for i, part := range dirParts {
+		if ok, _ := filepath.Match(patternParts[i], part); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchProtected returns the rule protecting absPath. A plain rule protects
+// its path and every ancestor; a glob rule protects its matches and every
+// directory a match could be inside, so ~/secrets/*.key protects ~/secrets.
+func matchProtected(absPath string, rules []string) (string, bool) {
+	for _, rule := range rules {
+		if isGlob(rule) {
+			if ok, _ := filepath.Match(rule, absPath); ok || mayContainMatch(absPath, rule) {
+				return rule, true
+			}
+			continue
+		}
+		if absPath == rule || isAncestor(absPath, rule) {
+			return rule, true
+		}
+	}
+	return "", false
+}
+
+// Protection is the set of paths brm refuses to trash. Load it once per run
+// with DefaultProtection; the zero value protects nothing.
+type Protection struct {
+	// Rules are absolute paths or globs.
+	Rules []string
+	// GitRoots protects git repository roots and their ancestors.
+	GitRoots bool
+}
+
+// DefaultProtection reads the protection rules from the config: the
+// configured ones and, unless disabled, the system directories, the home
+// and state directories, mount points and git repository roots.
+func DefaultProtection() (*Protection, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	p := &Protection{}
+	if !cfg.DisableDefaultProtection {
+		p.Rules = defaultProtectedPaths()
+		p.GitRoots = true
+	}
+	for _, rule := range cfg.Protected {
+		p.Rules = append(p.Rules, filepath.Clean(config.ExpandHome(rule)))
+	}
+	return p, nil
+}
+
+// Check returns a ProtectedPathError when absPath or anything inside it is
+// protected.
+func (p *Protection) Check(vfs fsys.FS, absPath string) error {
+	if rule, ok := matchProtected(absPath, p.Rules); ok {
+		return &ProtectedPathError{Path: absPath, Rule: rule, Err: ErrProtectedPath}
+	}
+	if p.GitRoots {
+		if root, ok := findGitRoot(vfs, absPath); ok {
+			return &ProtectedPathError{Path: root, Rule: RuleGitRoot, Err: ErrProtectedPath}
+		}
+	}
+	return nil
+}
+
+// protectionLoader returns how a trash gets its protection: p when given,
+// otherwise the configured one, loaded when first needed.
+func protectionLoader(p *Protection) func() (*Protection, error) {
+	if p != nil {
+		return func() (*Protection, error) { return p, nil }
+	}
+	return sync.OnceValues(DefaultProtection)
+}
+
+func CheckProtected(absPath string) error {
+	p, err := DefaultProtection()
+	if err != nil {
+		return err
+	}
+	return p.Check(fsys.OS{}, absPath)
+}
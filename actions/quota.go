@@ -0,0 +1,248 @@
+package actions
+
+import (
+	"brm/audit"
+	"brm/config"
+	"brm/trash"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("trash quota exceeded")
+	ErrNoSpace       = errors.New("not enough free space in the trash filesystem")
+	ErrQuotaPolicy   = errors.New("unknown quota policy, expected evict, refuse or prompt")
+)
+
+const (
+	// QuotaEvict purges the oldest entries until the new item fits.
+	QuotaEvict = "evict"
+	// QuotaRefuse leaves the trash alone and fails the deletion.
+	QuotaRefuse = "refuse"
+	// QuotaPrompt asks DeleteOptions.ConfirmEvict before evicting.
+	QuotaPrompt = "prompt"
+)
+
+// QuotaOptions cap the size of a trash. With both limits set the smaller
+// one wins; zero values disable the corresponding limit.
+type QuotaOptions struct {
+	Limit   int64
+	Percent float64
+	Policy  string
+}
+
+// ParseQuota parses a quota limit such as "10G" or "20%".
+func ParseQuota(s string) (QuotaOptions, error) {
+	var quota QuotaOptions
+	if percent, ok := strings.CutSuffix(strings.TrimSpace(s), "%"); ok {
+		value, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || value <= 0 || value > 100 {
+			return quota, fmt.Errorf("invalid quota %q", s)
+		}
+		quota.Percent = value
+		return quota, nil
+	}
+
+	var err error
+	quota.Limit, err = trash.ParseSize(s)
+	return quota, err
+}
+
+func ParseQuotaPolicy(s string) (string, error) {
+	switch s {
+	case "":
+		return QuotaRefuse, nil
+	case QuotaEvict, QuotaRefuse, QuotaPrompt:
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrQuotaPolicy, s)
+}
+
+func defaultQuotaOptions(cfg config.Config) (*QuotaOptions, error) {
+	if cfg.Quota.Limit == "" {
+		return nil, nil
+	}
+	quota, err := ParseQuota(cfg.Quota.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if quota.Policy, err = ParseQuotaPolicy(cfg.Quota.Policy); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// storedSize is the space an entry takes in the trash apart from its blobs.
+func storedSize(entry trash.TrashInfo) int64 {
+	if entry.StoredSize > 0 {
+		return entry.StoredSize
+	}
+	if entry.Metadata == nil {
+		return 0
+	}
+	size := entry.Metadata.Size
+	for _, blob := range entry.Blobs {
+		size -= blob.Size
+	}
+	return size
+}
+
+// trashUsage adds up the stored size of entries, counting shared blobs once.
+func trashUsage(entries []trash.TrashInfo) int64 {
+	var usage int64
+	blobs := make(map[string]int64)
+	for _, entry := range entries {
+		usage += storedSize(entry)
+		for _, blob := range entry.Blobs {
+			blobs[blob.SHA256] = blob.Size
+		}
+	}
+	for _, size := range blobs {
+		usage += size
+	}
+	return usage
+}
+
+// makeRoom checks before anything is moved that an item of size bytes fits
+// into the quota and, when it has to be copied, into the free space of the
+// trash filesystem. Depending on the quota policy it evicts the oldest
+// entries to make room or fails. The pre-purge hook can veto the eviction,
+// which then fails the item as well.
+func (t *dirTrash) makeRoom(store trash.Store, size int64, needsCopy bool, opts DeleteOptions) error {
+	victims, cause := t.roomVictims(store, size, needsCopy)
+	if len(victims) == 0 {
+		return cause
+	}
+	if t.quota.Policy == QuotaPrompt && (opts.ConfirmEvict == nil || !opts.ConfirmEvict(victims)) {
+		return cause
+	}
+	if err := t.hooks.run(HookPrePurge, hookItems(victims)); err != nil {
+		t.record(audit.OpPurge, victims, err)
+		return err
+	}
+
+	for _, victim := range victims {
+		if err := t.purgeEntry(store, victim, PurgeOptions{}); err != nil {
+			return err
+		}
+		if opts.OnEvict != nil {
+			opts.OnEvict(victim)
+		}
+	}
+	return nil
+}
+
+// roomVictims returns the entries that have to be evicted for an item of
+// size bytes to fit together with the error the item fails with unless they
+// are. Without victims a nil error means the item fits as it is. It changes
+// nothing.
+func (t *dirTrash) roomVictims(store trash.Store, size int64, needsCopy bool) ([]trash.TrashInfo, error) {
+	total, free, haveSpace := t.space(t.root)
+
+	var entries []trash.TrashInfo
+	var quotaNeed, spaceNeed int64
+	if limit := t.quotaLimit(total, haveSpace); limit > 0 {
+		var err error
+		if entries, err = store.All(); err != nil {
+			return nil, err
+		}
+		if size > limit {
+			return nil, fmt.Errorf("%w: %s > %s", ErrQuotaExceeded, trash.FormatSize(size), trash.FormatSize(limit))
+		}
+		quotaNeed = trashUsage(entries) + size - limit
+	}
+	if needsCopy && haveSpace {
+		spaceNeed = size - free
+	}
+	if quotaNeed <= 0 && spaceNeed <= 0 {
+		return nil, nil
+	}
+
+	cause := fmt.Errorf("%w: %s > %s", ErrNoSpace, trash.FormatSize(size), trash.FormatSize(free))
+	if quotaNeed > 0 {
+		cause = fmt.Errorf("%w: %s", ErrQuotaExceeded, trash.FormatSize(quotaNeed))
+	}
+	if t.quota == nil || t.quota.Policy == QuotaRefuse {
+		return nil, cause
+	}
+
+	if entries == nil {
+		var err error
+		if entries, err = store.All(); err != nil {
+			return nil, err
+		}
+	}
+	victims, ok := evictionVictims(entries, max(quotaNeed, spaceNeed))
+	if !ok {
+		return nil, cause
+	}
+	return victims, cause
+}
+
+func (t *dirTrash) quotaLimit(total int64, haveSpace bool) int64 {
+	if t.quota == nil {
+		return 0
+	}
+	limit := t.quota.Limit
+	if t.quota.Percent > 0 && haveSpace {
+		byPercent := int64(float64(total) * t.quota.Percent / 100)
+		if limit == 0 || byPercent < limit {
+			limit = byPercent
+		}
+	}
+	return limit
+}
+
+// evictionVictims picks the oldest entries that together free at least need
+// bytes. Blobs still shared with surviving entries are not counted as freed.
+func evictionVictims(entries []trash.TrashInfo, need int64) ([]trash.TrashInfo, bool) {
+	sorted := append([]trash.TrashInfo(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].DeletionDate.Before(sorted[j].DeletionDate)
+	})
+
+	refs := trash.BlobRefs(entries)
+	var victims []trash.TrashInfo
+	var freed int64
+	for _, entry := range sorted {
+		if freed >= need {
+			break
+		}
+		victims = append(victims, entry)
+		freed += storedSize(entry)
+		for _, blob := range entry.Blobs {
+			if refs[blob.SHA256]--; refs[blob.SHA256] == 0 {
+				freed += blob.Size
+			}
+		}
+	}
+	return victims, freed >= need
+}
+
+// QuotaEnforcer is implemented by trashes that can bring themselves back
+// under their quota outside of a deletion, e.g. after the quota was lowered.
+type QuotaEnforcer interface {
+	EnforceQuota() ([]trash.TrashInfo, error)
+}
+
+// EnforceQuota evicts the oldest entries while the trash is over its quota.
+// Only the evict policy lets it purge anything.
+func (t *dirTrash) EnforceQuota() ([]trash.TrashInfo, error) {
+	if t.quota == nil || t.quota.Policy != QuotaEvict {
+		return nil, nil
+	}
+	store, err := t.openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	var evicted []trash.TrashInfo
+	err = t.makeRoom(store, 0, false, DeleteOptions{
+		OnEvict: func(entry trash.TrashInfo) { evicted = append(evicted, entry) },
+	})
+	return evicted, err
+}
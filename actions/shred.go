@@ -0,0 +1,201 @@
+package actions
+
+import (
+	"brm/config"
+	"brm/fsys"
+	"brm/localization"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var ErrShredPattern = errors.New("unknown shred pattern, expected random or zero")
+
+const (
+	ShredPatternRandom = "random"
+	ShredPatternZero   = "zero"
+)
+
+type ShredOptions struct {
+	Passes  int
+	Pattern string
+	// OnLinked is told about every file unlinked without being overwritten
+	// because other hard links still share its data.
+	OnLinked func(path string)
+}
+
+type PurgeOptions struct {
+	// Shred overwrites file contents before unlinking when set.
+	Shred *ShredOptions
+}
+
+const shredChunkSize = 64 << 10
+
+const (
+	fsUnknown = iota
+	fsInPlace
+	fsCopyOnWrite
+	fsJournaled
+	fsNetwork
+)
+
+func removeItem(vfs fsys.FS, path string, opts PurgeOptions) error {
+	if opts.Shred == nil {
+		return vfs.RemoveAll(path)
+	}
+	return shredTree(vfs, path, *opts.Shred)
+}
+
+func shredTree(vfs fsys.FS, root string, opts ShredOptions) error {
+	var paths []string
+	err := fsys.WalkDir(vfs, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			// Overwriting would destroy the data the other links still show.
+			if linkCount(info) > 1 {
+				if opts.OnLinked != nil {
+					opts.OnLinked(path)
+				}
+				return nil
+			}
+			return shredFile(vfs, path, info, opts)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Children come after their parents in walk order, so unlink in reverse.
+	for i := len(paths) - 1; i >= 0; i-- {
+		obscured, err := obscureName(vfs, paths[i])
+		if err != nil {
+			return err
+		}
+		if err := vfs.Remove(obscured); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shredFile(vfs fsys.FS, path string, info fs.FileInfo, opts ShredOptions) error {
+	if info.Mode().Perm()&0200 == 0 {
+		if err := vfs.Chmod(path, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+	}
+
+	passes := opts.Passes
+	if passes < 1 {
+		passes = 1
+	}
+	for pass := 0; pass < passes; pass++ {
+		if err := overwrite(vfs, path, info.Size(), opts.Pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func overwrite(vfs fsys.FS, path string, size int64, pattern string) error {
+	file, err := vfs.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, shredChunkSize)
+	for written := int64(0); written < size && err == nil; {
+		chunk := buf[:min(int64(len(buf)), size-written)]
+		if pattern != ShredPatternZero {
+			if _, err = rand.Read(chunk); err != nil {
+				break
+			}
+		}
+		var n int
+		n, err = file.Write(chunk)
+		written += int64(n)
+	}
+	if syncer, ok := file.(interface{ Sync() error }); ok && err == nil {
+		err = syncer.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// obscureName renames path to a random name of the same length so the
+// original name does not linger in the directory after unlinking.
+func obscureName(vfs fsys.FS, path string) (string, error) {
+	nameLen := len(filepath.Base(path))
+	raw := make([]byte, (nameLen+1)/2)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	obscured := filepath.Join(filepath.Dir(path), hex.EncodeToString(raw)[:nameLen])
+	if _, err := vfs.Lstat(obscured); err == nil {
+		return path, nil
+	}
+	if err := vfs.Rename(path, obscured); err != nil {
+		return "", err
+	}
+	return obscured, nil
+}
+
+const defaultShredPasses = 3
+
+// DefaultShredOptions returns the shred settings from the config file,
+// falling back to three random passes.
+func DefaultShredOptions() ShredOptions {
+	opts := ShredOptions{Passes: defaultShredPasses, Pattern: ShredPatternRandom}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return opts
+	}
+	if cfg.Shred.Passes > 0 {
+		opts.Passes = cfg.Shred.Passes
+	}
+	if pattern, err := ParseShredPattern(cfg.Shred.Pattern); err == nil {
+		opts.Pattern = pattern
+	}
+	return opts
+}
+
+// ShredWarning explains why shredding under path may leave recoverable data,
+// or returns "" when the filesystem overwrites in place.
+func ShredWarning(path string) string {
+	name, kind := filesystemKind(path)
+	switch kind {
+	case fsCopyOnWrite:
+		return localization.GetMessage("shred_warning_cow", name)
+	case fsJournaled:
+		return localization.GetMessage("shred_warning_journaled", name)
+	case fsNetwork:
+		return localization.GetMessage("shred_warning_network", name)
+	}
+	return ""
+}
+
+func ParseShredPattern(pattern string) (string, error) {
+	switch pattern {
+	case "", ShredPatternRandom:
+		return ShredPatternRandom, nil
+	case ShredPatternZero:
+		return ShredPatternZero, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrShredPattern, pattern)
+}
@@ -0,0 +1,204 @@
+package actions
+
+import (
+	"brm/trash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Keys of the groups items without a usable path or extension fall into.
+const (
+	StatsEncrypted = "(encrypted)"
+	StatsDirectory = "(directory)"
+	StatsNoExt     = "(none)"
+)
+
+// StatsGroup is the number and total size of items sharing a key.
+type StatsGroup struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+type StatsItem struct {
+	TrashName    string    `json:"trash_name"`
+	OriginalPath string    `json:"original_path"`
+	Size         int64     `json:"size"`
+	DeletionDate time.Time `json:"deletion_date"`
+}
+
+// TrashStats describes what the trash holds. TotalSize is the size of the
+// items as they were deleted, StoredSize what they take in the trash after
+// compression and deduplication.
+type TrashStats struct {
+	Items       int          `json:"items"`
+	Files       int64        `json:"files"`
+	TotalSize   int64        `json:"total_size"`
+	StoredSize  int64        `json:"stored_size"`
+	ByDirectory []StatsGroup `json:"by_directory"`
+	ByExtension []StatsGroup `json:"by_extension"`
+	ByAge       []StatsGroup `json:"by_age"`
+	Largest     []StatsItem  `json:"largest"`
+}
+
+var ageBuckets = []struct {
+	key    string
+	before time.Duration
+}{
+	{"<1d", 24 * time.Hour},
+	{"1-7d", 7 * 24 * time.Hour},
+	{"7-30d", 30 * 24 * time.Hour},
+	{"30-90d", 90 * 24 * time.Hour},
+	{">90d", 0},
+}
+
+// measurer is implemented by trashes that can size an item from the
+// filesystem when its entry has no metadata.
+type measurer interface {
+	measure(entry trash.TrashInfo) (size, count int64, err error)
+}
+
+func (t *dirTrash) measure(entry trash.TrashInfo) (int64, int64, error) {
+	return dirUsage(t.fs, filepath.Join(t.root, entry.StoredName()))
+}
+
+// StatsTrash computes the statistics of t, listing the largest items up to
+// largest of them.
+func StatsTrash(t Trash, now time.Time, largest int) (TrashStats, error) {
+	var stats TrashStats
+
+	entries, err := t.List()
+	if err != nil {
+		return stats, err
+	}
+	home, _ := os.UserHomeDir()
+	m, canMeasure := t.(measurer)
+
+	byDirectory := make(map[string]*StatsGroup)
+	byExtension := make(map[string]*StatsGroup)
+	byAge := make(map[string]*StatsGroup)
+	for _, entry := range entries {
+		var size, count int64
+		isDir := false
+		if md := entry.Metadata; md != nil {
+			size, count, isDir = md.Size, md.FileCount, md.Mode.IsDir()
+		} else if canMeasure {
+			if size, count, err = m.measure(entry); err != nil && !os.IsNotExist(err) {
+				return stats, err
+			}
+		}
+
+		stats.Items++
+		stats.Files += count
+		stats.TotalSize += size
+		addToGroup(byDirectory, topLevelDir(entry, home), size)
+		addToGroup(byExtension, extensionKey(entry, isDir), size)
+		addToGroup(byAge, ageKey(now.Sub(entry.DeletionDate)), size)
+		stats.Largest = append(stats.Largest, StatsItem{
+			TrashName:    entry.TrashName,
+			OriginalPath: entry.OriginalPath,
+			Size:         size,
+			DeletionDate: entry.DeletionDate,
+		})
+	}
+	stats.StoredSize = trashUsage(entries)
+
+	stats.ByDirectory = sortedGroups(byDirectory)
+	stats.ByExtension = sortedGroups(byExtension)
+	for _, bucket := range ageBuckets {
+		group := StatsGroup{Key: bucket.key}
+		if g, ok := byAge[bucket.key]; ok {
+			group = *g
+		}
+		stats.ByAge = append(stats.ByAge, group)
+	}
+
+	sort.SliceStable(stats.Largest, func(i, j int) bool {
+		return stats.Largest[i].Size > stats.Largest[j].Size
+	})
+	if len(stats.Largest) > largest {
+		stats.Largest = stats.Largest[:largest]
+	}
+	return stats, nil
+}
+
+func Stats(largest int) (TrashStats, error) {
+	t, err := DefaultTrash()
+	if err != nil {
+		return TrashStats{}, err
+	}
+	return StatsTrash(t, time.Now(), largest)
+}
+
+func addToGroup(groups map[string]*StatsGroup, key string, size int64) {
+	group, ok := groups[key]
+	if !ok {
+		group = &StatsGroup{Key: key}
+		groups[key] = group
+	}
+	group.Count++
+	group.Size += size
+}
+
+// sortedGroups orders groups by size, largest first.
+func sortedGroups(groups map[string]*StatsGroup) []StatsGroup {
+	sorted := make([]StatsGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Size != sorted[j].Size {
+			return sorted[i].Size > sorted[j].Size
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// topLevelDir is the first directory of the original path below the home
+// directory, written as "~/name", or below the root for other paths.
+func topLevelDir(entry trash.TrashInfo, home string) string {
+	if entry.OriginalPath == "" {
+		return StatsEncrypted
+	}
+	dir := filepath.Dir(entry.OriginalPath)
+	prefix := string(filepath.Separator)
+	if home != "" && (dir == home || isAncestor(home, dir)) {
+		rel, _ := filepath.Rel(home, dir)
+		dir, prefix = rel, "~/"
+		if dir == "." {
+			return "~"
+		}
+	}
+	first := strings.SplitN(strings.TrimPrefix(dir, string(filepath.Separator)), string(filepath.Separator), 2)[0]
+	if first == "" {
+		return prefix
+	}
+	return prefix + first
+}
+
+func extensionKey(entry trash.TrashInfo, isDir bool) string {
+	switch {
+	case entry.OriginalPath == "":
+		return StatsEncrypted
+	case isDir:
+		return StatsDirectory
+	}
+	ext := strings.ToLower(filepath.Ext(entry.OriginalPath))
+	if ext == "" || ext == filepath.Base(entry.OriginalPath) {
+		return StatsNoExt
+	}
+	return ext
+}
+
+func ageKey(age time.Duration) string {
+	for _, bucket := range ageBuckets {
+		if bucket.before == 0 || age < bucket.before {
+			return bucket.key
+		}
+	}
+	return ageBuckets[len(ageBuckets)-1].key
+}
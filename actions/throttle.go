@@ -0,0 +1,60 @@
+package actions
+
+import (
+	"brm/fsys"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// rateLimiter spreads writes so that all its users together write at most
+// rate bytes per second.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate}
+}
+
+// wait blocks until n more bytes may be written.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// throttledFS limits how fast files opened for writing are written, so
+// copies across filesystems do not saturate a slow disk. Renames are free.
+type throttledFS struct {
+	fsys.FS
+	limiter *rateLimiter
+}
+
+func (f throttledFS) OpenFile(name string, flag int, perm fs.FileMode) (fsys.File, error) {
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return file, err
+	}
+	return throttledFile{file, f.limiter}, nil
+}
+
+type throttledFile struct {
+	fsys.File
+	limiter *rateLimiter
+}
+
+func (f throttledFile) Write(p []byte) (int, error) {
+	f.limiter.wait(len(p))
+	return f.File.Write(p)
+}
@@ -0,0 +1,673 @@
+package actions
+
+import (
+	"brm/audit"
+	"brm/config"
+	"brm/crypt"
+	"brm/fsys"
+	"brm/trash"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trash is a place deleted items can be moved to and brought back from.
+// Items are addressed by their trash name, which is unique within one Trash.
+type Trash interface {
+	Root() string
+	Put(path string, opts DeleteOptions) (trash.TrashInfo, error)
+	List() ([]trash.TrashInfo, error)
+	Stat(trashName string) (trash.TrashInfo, error)
+	Restore(trashName string) error
+	Purge(trashName string, opts PurgeOptions) error
+	Empty(opts PurgeOptions) error
+}
+
+type TrashOptions struct {
+	// IndexPath is where the trash index lives; defaults to
+	// ~/.brm/trash.json for ~/.trash and to a file under ~/.brm/trashes
+	// named after the root for any other trash.
+	IndexPath string
+	// Store replaces the on-disk index at IndexPath, e.g. trash.NewMemoryStore().
+	Store trash.Store
+	// FS is the filesystem items are moved on; defaults to the real one.
+	FS fsys.FS
+	// Encrypt stores new items encrypted when set.
+	Encrypt *EncryptOptions
+	// Key unlocks encrypted items; it is only called when one is touched.
+	Key func() (*crypt.Key, error)
+	// Quota caps the trash size when set.
+	Quota *QuotaOptions
+	// Audit records every delete, restore and purge when set.
+	Audit *audit.Log
+	// Hooks run around deleting, restoring and purging items.
+	Hooks Hooks
+	// Protection is what Put refuses to trash; defaults to the configured
+	// rules, loaded when first needed.
+	Protection *Protection
+	// ReadOnly creates neither the trash directory nor the index and opens
+	// the index without locking, migrating or compacting it, for planning.
+	// Only lookups and plans work; everything else fails with
+	// trash.ErrReadOnly before touching any item.
+	ReadOnly bool
+}
+
+// ErrUnsupportedOption refuses an option a trash cannot honour.
+var ErrUnsupportedOption = errors.New("this trash does not support the option")
+
+func unsupportedOption(name string) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedOption, name)
+}
+
+// checkIndexOptions refuses the TrashOptions only a trash with its own
+// index honours.
+func checkIndexOptions(opts TrashOptions) error {
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"index", opts.IndexPath != "" || opts.Store != nil},
+		{"encryption", opts.Encrypt != nil || opts.Key != nil},
+		{"quota", opts.Quota != nil},
+		{"read-only", opts.ReadOnly},
+	} {
+		if option.set {
+			return unsupportedOption(option.name)
+		}
+	}
+	return nil
+}
+
+type dirTrash struct {
+	root      string
+	indexPath string
+	store     trash.Store
+	fs        fsys.FS
+	encrypt   *EncryptOptions
+	key       func() (*crypt.Key, error)
+	quota     *QuotaOptions
+	auditRecorder
+	hooks      Hooks
+	protection func() (*Protection, error)
+	readOnly   bool
+	space      func(path string) (total, free int64, ok bool)
+}
+
+func NewDirTrash(root string, opts TrashOptions) (Trash, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	vfs := opts.FS
+	if vfs == nil {
+		vfs = fsys.OS{}
+	}
+	if !opts.ReadOnly {
+		if err := vfs.MkdirAll(absRoot, 0750); err != nil {
+			return nil, err
+		}
+	}
+
+	indexPath := opts.IndexPath
+	if indexPath == "" && opts.Store == nil {
+		if indexPath, err = defaultIndexPath(absRoot, opts.ReadOnly); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dirTrash{
+		root:          absRoot,
+		indexPath:     indexPath,
+		store:         opts.Store,
+		fs:            vfs,
+		encrypt:       opts.Encrypt,
+		key:           opts.Key,
+		quota:         opts.Quota,
+		auditRecorder: auditRecorder{opts.Audit},
+		hooks:         opts.Hooks,
+		protection:    protectionLoader(opts.Protection),
+		readOnly:      opts.ReadOnly,
+		space:         diskSpace,
+	}, nil
+}
+
+// defaultIndexPath is where the index of the trash at root lives when
+// TrashOptions leave it open. Only ~/.trash uses trash.json; every other
+// root gets its own index, so trashes never see each other's entries.
+func defaultIndexPath(root string, readOnly bool) (string, error) {
+	if defaultRoot, err := trashDir(); err == nil && root == defaultRoot {
+		if readOnly {
+			return trash.TrashInfoPath()
+		}
+		return trash.GetTrashInfoPath()
+	}
+	stateDir, err := config.GetStateDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(stateDir, "trashes", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// needsCopy reports whether putting the item takes new space in the trash:
+// encrypted items are always written anew, others only across filesystems.
+func (t *dirTrash) needsCopy(info fs.FileInfo) bool {
+	if t.encrypt != nil {
+		return true
+	}
+	rootInfo, err := t.fs.Stat(t.root)
+	if err != nil {
+		return false
+	}
+	itemDevice, ok := deviceOf(info)
+	rootDevice, rootOK := deviceOf(rootInfo)
+	return ok && rootOK && itemDevice != rootDevice
+}
+
+type sharedStore struct {
+	trash.Store
+}
+
+func (sharedStore) Close() error {
+	return nil
+}
+
+func (t *dirTrash) openStore() (trash.Store, error) {
+	if t.readOnly {
+		return nil, trash.ErrReadOnly
+	}
+	if t.store != nil {
+		return sharedStore{t.store}, nil
+	}
+	return trash.OpenStoreAt(t.indexPath)
+}
+
+// openStoreReadOnly opens the index for lookups that must not write, such
+// as planning a dry run.
+func (t *dirTrash) openStoreReadOnly() (trash.Store, error) {
+	if t.store != nil {
+		return sharedStore{t.store}, nil
+	}
+	return trash.OpenStoreReadOnly(t.indexPath)
+}
+
+// openLookupStore opens the index for List and Stat, read-only in a trash
+// opened with TrashOptions.ReadOnly.
+func (t *dirTrash) openLookupStore() (trash.Store, error) {
+	if t.readOnly {
+		return t.openStoreReadOnly()
+	}
+	return t.openStore()
+}
+
+// Holder is implemented by trashes that can keep their index open across a
+// run of operations, so that restoring many items loads it once rather than
+// once per item.
+type Holder interface {
+	// Hold returns the trash bound to one open index, which stays locked
+	// until release is called.
+	Hold() (held Trash, release func() error, err error)
+}
+
+// Hold keeps the index open unless hooks are configured: they may call brm
+// themselves, which must not wait for a lock brm holds.
+func (t *dirTrash) Hold() (Trash, func() error, error) {
+	if t.store != nil || len(t.hooks) > 0 {
+		return t, func() error { return nil }, nil
+	}
+	store, err := t.openLookupStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	held := *t
+	held.store = store
+	return &held, store.Close, nil
+}
+
+// holdTrash holds the index of t when it supports that and otherwise
+// leaves t as it is.
+func holdTrash(t Trash) (Trash, func() error, error) {
+	if holder, ok := t.(Holder); ok {
+		return holder.Hold()
+	}
+	return t, func() error { return nil }, nil
+}
+
+func (t *dirTrash) Root() string {
+	return t.root
+}
+
+// putItem is an item checked and measured for Put before the index is locked.
+type putItem struct {
+	absPath  string
+	info     fs.FileInfo
+	metadata *trash.Metadata
+	blobs    []trash.Blob
+}
+
+func (t *dirTrash) preparePut(path string, opts DeleteOptions, who deleter) (putItem, error) {
+	absSrcPath, err := filepath.Abs(path)
+	if err != nil {
+		return putItem{}, err
+	}
+
+	if err := checkDeletable(t.fs, absSrcPath, t.root, opts, t.protection); err != nil {
+		return putItem{}, err
+	}
+
+	info, err := t.fs.Lstat(absSrcPath)
+	if err != nil {
+		return putItem{}, err
+	}
+
+	metadata, err := collectMetadata(t.fs, absSrcPath, who)
+	if err != nil {
+		return putItem{}, err
+	}
+
+	var blobs []trash.Blob
+	if opts.Dedup != nil && t.encrypt == nil {
+		blobs, err = planBlobs(t.fs, absSrcPath, *opts.Dedup, metadata)
+		if err != nil {
+			return putItem{}, err
+		}
+	}
+	return putItem{absPath: absSrcPath, info: info, metadata: metadata, blobs: blobs}, nil
+}
+
+func (t *dirTrash) Put(path string, opts DeleteOptions) (trash.TrashInfo, error) {
+	entry, err := t.putPath(path, opts)
+	t.recordPut(path, entry, err)
+	if err == nil {
+		t.hooks.runPost(HookPostDelete, []trash.TrashInfo{entry})
+	}
+	return entry, err
+}
+
+func (t *dirTrash) putPath(path string, opts DeleteOptions) (trash.TrashInfo, error) {
+	if err := t.hooks.run(HookPreDelete, pathHookItems(path)); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	item, err := t.preparePut(path, opts, currentDeleter())
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	store, err := t.openStore()
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	defer store.Close()
+
+	if err := store.CheckWritable(); err != nil {
+		return trash.TrashInfo{}, err
+	}
+	return t.put(newPutSession(store), item, opts)
+}
+
+// putSession is what the items put together share: the index, the space
+// they are about to take and the trash names they chose. Items of a
+// parallel batch take turns at it; their files move concurrently.
+type putSession struct {
+	mu       sync.Mutex
+	store    trash.Store
+	inFlight int64
+	reserved map[string]bool
+}
+
+func newPutSession(store trash.Store) *putSession {
+	return &putSession{store: store, reserved: make(map[string]bool)}
+}
+
+// begin makes room for an item of size bytes and reserves a trash name for
+// it. The caller must call end with the same size once the item is in.
+func (s *putSession) begin(t *dirTrash, baseName string, size int64, needsCopy bool, opts DeleteOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Items still moving do not show in the index yet but will take space.
+	if err := t.makeRoom(s.store, size+s.inFlight, needsCopy, opts); err != nil {
+		return "", err
+	}
+	dstPath, err := uniquePath(t.fs, t.root, baseName, func(name string) bool { return s.reserved[name] })
+	if err != nil {
+		return "", err
+	}
+	s.reserved[filepath.Base(dstPath)] = true
+	s.inFlight += size
+	return dstPath, nil
+}
+
+func (s *putSession) end(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight -= size
+}
+
+func (s *putSession) add(entry trash.TrashInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Add(entry)
+}
+
+func (t *dirTrash) put(s *putSession, item putItem, opts DeleteOptions) (trash.TrashInfo, error) {
+	if t.encrypt != nil {
+		return t.putEncrypted(s, item, opts)
+	}
+
+	size := item.metadata.Size
+	dstPath, err := s.begin(t, filepath.Base(item.absPath), size, t.needsCopy(item.info), opts)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	defer s.end(size)
+
+	if err := moveItem(t.fs, item.absPath, dstPath, item.info); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	entry := trash.TrashInfo{
+		TrashName:    filepath.Base(dstPath),
+		OriginalPath: item.absPath,
+		DeletionDate: time.Now(),
+		Metadata:     item.metadata,
+	}
+	if len(item.blobs) > 0 {
+		entry.Storage = trash.StorageDedup
+		entry.Blobs = item.blobs
+	}
+	if err := s.add(entry); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	// The item is safely in the trash at this point; files that fail to
+	// move into the blob store just stay where they are.
+	_ = storeBlobs(t.fs, t.root, dstPath, entry.Blobs)
+	return entry, nil
+}
+
+func (t *dirTrash) List() ([]trash.TrashInfo, error) {
+	store, err := t.openLookupStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.All()
+}
+
+// validTrashName reports whether name can name an item: one path element,
+// so a trash name never reaches outside the trash.
+func validTrashName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsRune(name, filepath.Separator)
+}
+
+// lookup finds the entry for a trash name or for the name an archived or
+// encrypted item is stored under, as seen when browsing the trash directory.
+func lookup(store trash.Store, name string) (trash.TrashInfo, error) {
+	if !validTrashName(name) {
+		return trash.TrashInfo{}, &NotInTrashError{Name: name}
+	}
+	entry, ok, err := store.Get(name)
+	if err != nil || ok {
+		return entry, err
+	}
+	for _, suffix := range []string{archiveSuffix, encryptedSuffix} {
+		trashName, cut := strings.CutSuffix(name, suffix)
+		if !cut {
+			continue
+		}
+		entry, ok, err = store.Get(trashName)
+		if err != nil || (ok && entry.StoredName() == name) {
+			return entry, err
+		}
+	}
+	return trash.TrashInfo{}, &NotInTrashError{Name: name}
+}
+
+func (t *dirTrash) Stat(trashName string) (trash.TrashInfo, error) {
+	store, err := t.openLookupStore()
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	defer store.Close()
+	return lookup(store, trashName)
+}
+
+func (t *dirTrash) Restore(trashName string) error {
+	entry, err := t.Stat(trashName)
+	if err == nil {
+		err = t.hooks.run(HookPreRestore, hookItems([]trash.TrashInfo{entry}))
+	}
+	if err == nil {
+		entry, err = t.restore(trashName)
+	}
+	if entry.TrashName == "" {
+		entry.TrashName = trashName
+	}
+	t.record(audit.OpRestore, []trash.TrashInfo{entry}, err)
+	if err == nil {
+		t.hooks.runPost(HookPostRestore, []trash.TrashInfo{entry})
+	}
+	return err
+}
+
+func (t *dirTrash) restore(trashName string) (trash.TrashInfo, error) {
+	store, err := t.openStore()
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	defer store.Close()
+
+	entry, err := lookup(store, trashName)
+	if err != nil {
+		return entry, err
+	}
+
+	trashFilePath := filepath.Join(t.root, entry.StoredName())
+	if entry.Storage == trash.StorageDedup {
+		if _, err := t.fs.Lstat(entry.OriginalPath); err == nil {
+			return entry, &ConflictError{Path: entry.OriginalPath}
+		}
+		entries, err := store.All()
+		if err != nil {
+			return entry, err
+		}
+		if err := materializeBlobs(t.fs, t.root, trashFilePath, entry.Blobs, trash.BlobRefs(entries)); err != nil {
+			return entry, err
+		}
+	}
+
+	info, err := t.fs.Lstat(trashFilePath)
+	if os.IsNotExist(err) {
+		return entry, store.Remove(entry.TrashName)
+	} else if err != nil {
+		return entry, err
+	}
+
+	switch entry.Storage {
+	case trash.StorageTarGzip:
+		err = t.restoreArchive(trashFilePath, entry.OriginalPath, nil)
+	case trash.StorageEncrypted:
+		err = t.restoreEncrypted(trashFilePath, entry)
+	default:
+		err = restoreItem(t.fs, trashFilePath, entry.OriginalPath, info)
+	}
+	if err != nil {
+		return entry, err
+	}
+	if err := store.Remove(entry.TrashName); err != nil {
+		return entry, err
+	}
+	return entry, dropBlobs(t.fs, store, t.root, entry.Blobs, PurgeOptions{})
+}
+
+// restoreArchive extracts an archived item next to the archive, so a failed
+// extraction never leaves a partial item at the original path.
+func (t *dirTrash) restoreArchive(archivePath, originalPath string, key *crypt.Key) error {
+	if _, err := t.fs.Lstat(originalPath); err == nil {
+		return &ConflictError{Path: originalPath}
+	}
+
+	stagingPath, err := getUniquePath(t.fs, t.root, "."+filepath.Base(originalPath)+".restore")
+	if err != nil {
+		return err
+	}
+	if err := extractArchive(t.fs, archivePath, stagingPath, key); err != nil {
+		_ = t.fs.RemoveAll(stagingPath)
+		return err
+	}
+
+	info, err := t.fs.Lstat(stagingPath)
+	if err == nil {
+		err = restoreItem(t.fs, stagingPath, originalPath, info)
+	}
+	if err != nil {
+		_ = t.fs.RemoveAll(stagingPath)
+		return err
+	}
+	return t.fs.Remove(archivePath)
+}
+
+// Compress replaces an item with a gzipped tar archive of it. The index is
+// updated before the original is removed, so an interruption leaves at
+// worst a leftover copy for fsck to report.
+func (t *dirTrash) Compress(trashName string) (trash.TrashInfo, error) {
+	store, err := t.openStore()
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	defer store.Close()
+
+	entry, err := lookup(store, trashName)
+	if err != nil || entry.Storage != trash.StoragePlain {
+		return entry, err
+	}
+
+	itemPath := filepath.Join(t.root, entry.TrashName)
+	entry.Storage = trash.StorageTarGzip
+	archivePath := filepath.Join(t.root, entry.StoredName())
+	if err := writeArchive(t.fs, itemPath, archivePath, nil); err != nil {
+		return trash.TrashInfo{}, err
+	}
+
+	info, err := t.fs.Lstat(archivePath)
+	if err != nil {
+		return trash.TrashInfo{}, err
+	}
+	entry.StoredSize = info.Size()
+	if err := store.Add(entry); err != nil {
+		_ = t.fs.Remove(archivePath)
+		return trash.TrashInfo{}, err
+	}
+	return entry, t.fs.RemoveAll(itemPath)
+}
+
+// Purge deletes an indexed item for good. Files the index has lost are
+// only deleted by PermanentDelete, which is given their path.
+func (t *dirTrash) Purge(trashName string, opts PurgeOptions) error {
+	if t.hooks[HookPrePurge] != "" {
+		entry, err := t.Stat(trashName)
+		if err == nil {
+			err = t.hooks.run(HookPrePurge, hookItems([]trash.TrashInfo{entry}))
+		}
+		if err != nil {
+			t.record(audit.OpPurge, []trash.TrashInfo{{TrashName: trashName}}, err)
+			return err
+		}
+	}
+
+	store, err := t.openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entry, err := lookup(store, trashName)
+	if err != nil {
+		t.record(audit.OpPurge, []trash.TrashInfo{{TrashName: trashName}}, err)
+		return err
+	}
+	return t.purgeEntry(store, entry, opts)
+}
+
+// purgePath deletes a file or directory inside an item for good.
+func (t *dirTrash) purgePath(absPath string, opts PurgeOptions) error {
+	entries := []trash.TrashInfo{{OriginalPath: absPath}}
+	err := t.hooks.run(HookPrePurge, hookItems(entries))
+	if err == nil {
+		err = removeItem(t.fs, absPath, opts)
+	}
+	t.record(audit.OpPurge, entries, err)
+	return err
+}
+
+func (t *dirTrash) purgeEntry(store trash.Store, entry trash.TrashInfo, opts PurgeOptions) error {
+	err := t.removeEntry(store, entry, opts)
+	t.record(audit.OpPurge, []trash.TrashInfo{entry}, err)
+	return err
+}
+
+func (t *dirTrash) removeEntry(store trash.Store, entry trash.TrashInfo, opts PurgeOptions) error {
+	itemPath := filepath.Join(t.root, entry.StoredName())
+	if _, err := t.fs.Lstat(itemPath); err == nil || entry.Storage != trash.StorageDedup {
+		if err := removeItem(t.fs, itemPath, opts); err != nil {
+			return err
+		}
+	}
+	if err := store.Remove(entry.TrashName); err != nil {
+		return err
+	}
+	return dropBlobs(t.fs, store, t.root, entry.Blobs, opts)
+}
+
+func (t *dirTrash) Empty(opts PurgeOptions) error {
+	if t.hooks[HookPrePurge] != "" {
+		// The hook cannot be asked about items an unreadable index hides.
+		entries, err := t.List()
+		if err == nil {
+			err = t.hooks.run(HookPrePurge, hookItems(entries))
+		}
+		if err != nil {
+			t.record(audit.OpEmpty, entries, err)
+			return err
+		}
+	}
+
+	store, err := t.openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// An unreadable index leaves the record without items, not the trash
+	// full.
+	entries, _ := store.All()
+	err = clearDir(t.fs, t.root, opts)
+	if err == nil {
+		err = store.Replace(nil)
+	}
+	t.record(audit.OpEmpty, entries, err)
+	return err
+}
+
+func restoreItem(vfs fsys.FS, trashFilePath, originalPath string, info fs.FileInfo) error {
+	if _, err := vfs.Lstat(originalPath); err == nil {
+		return &ConflictError{Path: originalPath}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := vfs.MkdirAll(filepath.Dir(originalPath), 0755); err != nil {
+		return err
+	}
+	return moveItem(vfs, trashFilePath, originalPath, info)
+}
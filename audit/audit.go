@@ -0,0 +1,241 @@
+package audit
+
+import (
+	"brm/config"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations recorded in the log.
+const (
+	OpDelete  = "delete"
+	OpRestore = "restore"
+	OpPurge   = "purge"
+	OpEmpty   = "empty"
+)
+
+// Outcomes of a recorded operation.
+const (
+	OutcomeOK     = "ok"
+	OutcomeFailed = "failed"
+)
+
+// Record is one line of the audit log: an operation on one item, or on the
+// whole trash for OpEmpty, and the process that ran it.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Op         string    `json:"op"`
+	User       string    `json:"user"`
+	UID        int       `json:"uid"`
+	Host       string    `json:"host,omitempty"`
+	PID        int       `json:"pid"`
+	Cwd        string    `json:"cwd,omitempty"`
+	Argv       []string  `json:"argv,omitempty"`
+	Paths      []string  `json:"paths,omitempty"`
+	TrashNames []string  `json:"trash_names,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type LogOptions struct {
+	// Syslog also sends every record to syslog or journald over the local
+	// socket.
+	Syslog bool
+	// HidePaths leaves paths and the command line out of the records, for
+	// trashes that encrypt the original paths.
+	HidePaths bool
+}
+
+// Log appends records to a JSON lines file. The file is opened on the first
+// record and kept in append mode, so concurrent brm processes interleave
+// whole lines.
+type Log struct {
+	path   string
+	opts   LogOptions
+	mu     sync.Mutex
+	file   *os.File
+	syslog syslogSender
+
+	processOnce sync.Once
+	process     Record
+}
+
+func NewLog(path string, opts LogOptions) *Log {
+	return &Log{path: path, opts: opts}
+}
+
+// DefaultPath is the audit log under the state directory, ~/.brm/audit.log.
+func DefaultPath() (string, error) {
+	dir, err := config.GetStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record fills in the process fields of rec, sets Outcome from err and
+// appends it to the log.
+func (l *Log) Record(rec Record, err error) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	l.processOnce.Do(func() { l.process = currentProcess() })
+	rec.User, rec.UID, rec.Host = l.process.User, l.process.UID, l.process.Host
+	rec.PID, rec.Cwd, rec.Argv = l.process.PID, l.process.Cwd, l.process.Argv
+	rec.Outcome = OutcomeOK
+	if err != nil {
+		rec.Outcome = OutcomeFailed
+		rec.Error = err.Error()
+	}
+	if l.opts.HidePaths {
+		rec.Paths, rec.Argv, rec.Error = nil, nil, ""
+	}
+
+	line, marshalErr := json.Marshal(rec)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	writeErr := l.appendLine(line)
+	if l.opts.Syslog {
+		return errors.Join(writeErr, l.syslog.send(line, err != nil))
+	}
+	return writeErr
+}
+
+// Close closes the log file and the syslog connection. A later record opens
+// them again.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if l.file != nil {
+		err = l.file.Close()
+		l.file = nil
+	}
+	return errors.Join(err, l.syslog.close())
+}
+
+// currentProcess describes the running process. It does not change between
+// records, so a Log asks for it once.
+func currentProcess() Record {
+	rec := Record{UID: os.Getuid(), PID: os.Getpid(), Argv: CommandLine()}
+	if u, err := user.Current(); err == nil {
+		rec.User = u.Username
+	}
+	rec.Host, _ = os.Hostname()
+	rec.Cwd, _ = os.Getwd()
+	return rec
+}
+
+// maxCommandLineArgs keeps a bulk deletion, which writes a record and an
+// index entry per item, from storing the whole argv in every one of them.
+const maxCommandLineArgs = 16
+
+// CommandLine is the argv of brm as records and index entries keep it, cut
+// short after maxCommandLineArgs arguments.
+func CommandLine() []string {
+	if len(os.Args) <= maxCommandLineArgs {
+		return os.Args
+	}
+	args := append([]string{}, os.Args[:maxCommandLineArgs]...)
+	return append(args, fmt.Sprintf("... (+%d more)", len(os.Args)-maxCommandLineArgs))
+}
+
+// appendLine writes line with a single write, so it cannot be torn apart by
+// another writer appending at the same time.
+func (l *Log) appendLine(line []byte) error {
+	if l.file == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		l.file = file
+	}
+	_, err := l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Query selects records. Zero fields match everything.
+type Query struct {
+	// Since and Until bound the time of a record; Until is exclusive.
+	Since time.Time
+	Until time.Time
+	// Names match a record by trash name, or by path when one of its paths
+	// is the name or lies below it.
+	Names []string
+}
+
+func (q Query) Match(rec Record) bool {
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !rec.Time.Before(q.Until) {
+		return false
+	}
+	if len(q.Names) == 0 {
+		return true
+	}
+	for _, name := range q.Names {
+		for _, trashName := range rec.TrashNames {
+			if trashName == name {
+				return true
+			}
+		}
+		absName, err := filepath.Abs(name)
+		if err != nil {
+			continue
+		}
+		for _, path := range rec.Paths {
+			if path == absName || strings.HasPrefix(path, absName+string(filepath.Separator)) || absName == "/" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Read returns the records of the log at path that match q, oldest first.
+// A missing log has no records. Lines that do not parse, such as one cut
+// short by a crash, are skipped.
+func Read(path string, q Query) ([]Record, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if q.Match(rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package audit
+
+import "errors"
+
+type syslogSender struct{}
+
+func (s *syslogSender) send(line []byte, failed bool) error {
+	return errors.New("syslog is not supported on this system")
+}
+
+func (s *syslogSender) close() error {
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package audit
+
+import "log/syslog"
+
+// syslogSender sends records to the local syslog socket, which journald
+// also listens on. It connects on the first record.
+type syslogSender struct {
+	w *syslog.Writer
+}
+
+func (s *syslogSender) send(line []byte, failed bool) error {
+	if s.w == nil {
+		w, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, "brm")
+		if err != nil {
+			return err
+		}
+		s.w = w
+	}
+	if failed {
+		return s.w.Warning(string(line))
+	}
+	return s.w.Info(string(line))
+}
+
+func (s *syslogSender) close() error {
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	return err
+}
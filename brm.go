@@ -4,19 +4,28 @@ import (
 	"brm/actions"
 	"brm/flags"
 	"brm/localization"
+	"brm/trash"
 	"brm/tui/browser"
+	"errors"
 	"fmt"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
+	"io"
 	"log"
 	"os"
 	"strings"
 )
 
+// promptInput is the terminal prompts read from when standard input
+// carries a list of paths.
+var promptInput io.ReadCloser
+
 func confirmPrompt(label string) (bool, error) {
 	prompt := promptui.Prompt{
 		Label:     label,
 		IsConfirm: true,
+		Stdin:     promptInput,
 	}
 
 	result, err := prompt.Run()
@@ -28,63 +37,255 @@ func confirmPrompt(label string) (bool, error) {
 	return answer == "y" || answer == "", nil
 }
 
-func deleteWithConfirmation(args []string, opts flags.Options) {
+func promptPassphrase(confirm bool) ([]byte, error) {
+	label := localization.GetMessage("passphrase_prompt")
+	if confirm {
+		label = localization.GetMessage("passphrase_confirm_prompt")
+	}
+	prompt := promptui.Prompt{
+		Label: label,
+		Mask:  '*',
+		Stdin: promptInput,
+	}
+
+	result, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
+
+func deleteWithConfirmation(args []string, opts flags.Options) flags.Results {
+	var res flags.Results
+	if opts.DryRun {
+		var plan actions.DeletePlan
+		var totals flags.PlanTotals
+		for _, arg := range args {
+			res.Add(planFile(arg, opts, &plan, &totals))
+		}
+		flags.PrintPlanSummary(totals)
+		return res
+	}
 	if opts.InteractiveOnce && len(args) > 3 {
 		confirmed, err := confirmPrompt(localization.GetMessage("confirm_delete_files", len(args)))
 		if err != nil {
 			fmt.Println(localization.GetMessage("delete_cancelled"))
-			return
 		}
-		if !confirmed {
-			fmt.Println(localization.GetMessage("delete_cancelled"))
-			return
+		if err != nil || !confirmed {
+			res.Add(flags.ErrCancelled)
+			return res
 		}
 		for _, arg := range args {
-			deleteFile(arg, opts.Verbose)
+			res.Add(deleteFile(arg, opts))
 		}
-	} else {
-		for _, arg := range args {
-			if opts.IFlag {
-				confirmed, err := confirmPrompt(localization.GetMessage("confirm_delete_file", arg))
-				if err != nil {
-					fmt.Println(localization.GetMessage("delete_cancelled"))
-					return
-				}
-				if !confirmed {
-					fmt.Println(localization.GetMessage("delete_cancelled"))
-					return
-				}
+		return res
+	}
+
+	for _, arg := range args {
+		if opts.IFlag {
+			confirmed, err := confirmPrompt(localization.GetMessage("confirm_delete_file", arg))
+			if err != nil || !confirmed {
+				fmt.Println(localization.GetMessage("delete_cancelled"))
+				res.Add(flags.ErrCancelled)
+				return res
 			}
-			deleteFile(arg, opts.Verbose)
 		}
+		res.Add(deleteFile(arg, opts))
 	}
+	return res
 }
 
-func deleteFile(arg string, verbose bool) {
-	err := actions.SaveDelete(arg)
+func permanentDeleteFile(arg string, opts flags.Options) error {
+	if err := flags.ConfirmPermanent(arg, opts); err != nil {
+		return err
+	}
+
+	// Dispatch has already rejected malformed shred options.
+	purgeOpts, _ := opts.PurgeOptions()
+	err := actions.PermanentDelete(arg, purgeOpts)
 	if err != nil {
-		log.Printf(localization.GetMessage("error_moving_to_trash"), arg, err)
-	} else {
-		if verbose {
-			fmt.Println(localization.GetMessage("file_deleted_verbose", arg))
+		log.Println(localization.GetMessage("error_deleting_file", arg, flags.ErrorMessage(err)))
+	} else if opts.Verbose {
+		fmt.Println(localization.GetMessage("file_deleted_permanently_verbose", arg))
+	}
+	return err
+}
+
+// planFile prints what deleteFile would do with arg as part of plan and adds
+// it to totals.
+func planFile(arg string, opts flags.Options, plan *actions.DeletePlan, totals *flags.PlanTotals) error {
+	var steps []actions.PlanStep
+	var err error
+	errorMessage := "error_deleting_file"
+	inTrash, inTrashErr := actions.IsInTrash(arg)
+	switch {
+	case inTrashErr == nil && inTrash:
+		steps, err = actions.PlanPermanentDelete(arg)
+	default:
+		steps, err = plan.Plan(arg, opts.DeleteOptions())
+		errorMessage = "error_moving_to_trash"
+	}
+	if err != nil {
+		log.Println(localization.GetMessage(errorMessage, arg, flags.ErrorMessage(err)))
+		return err
+	}
+	flags.PrintPlan(steps, totals)
+	return nil
+}
+
+func deleteFile(arg string, opts flags.Options) error {
+	if inTrash, err := actions.IsInTrash(arg); err == nil && inTrash {
+		return permanentDeleteFile(arg, opts)
+	}
+
+	err := actions.SaveDelete(arg, deleteOptions(opts, arg))
+	reportDelete(arg, err, opts)
+	return err
+}
+
+// deleteOptions adds reporting and confirming evictions to the options
+// target, a path or a batch of them, is deleted with.
+func deleteOptions(opts flags.Options, target string) actions.DeleteOptions {
+	deleteOpts := opts.DeleteOptions()
+	deleteOpts.OnEvict = func(evicted trash.TrashInfo) {
+		size := evicted.StoredSize
+		if size == 0 && evicted.Metadata != nil {
+			size = evicted.Metadata.Size
+		}
+		fmt.Fprintln(os.Stderr, localization.GetMessage("evicted_entry", evicted.TrashName,
+			trash.FormatSize(size), evicted.DeletionDate.Local().Format("2006-01-02 15:04")))
+	}
+	if promptInput != nil || isatty.IsTerminal(os.Stdin.Fd()) {
+		deleteOpts.ConfirmEvict = func(evict []trash.TrashInfo) bool {
+			for _, entry := range evict {
+				fmt.Println(entry.TrashName)
+			}
+			confirmed, err := confirmPrompt(localization.GetMessage("confirm_evict", len(evict), target))
+			return err == nil && confirmed
 		}
 	}
+	return deleteOpts
 }
 
-func main() {
-	opts := flags.ParseFlags()
-	args := flags.Args()
+func reportDelete(arg string, err error, opts flags.Options) {
+	if err != nil {
+		log.Println(localization.GetMessage("error_moving_to_trash", arg, flags.ErrorMessage(err)))
+		if errors.Is(err, actions.ErrProtectedPath) {
+			fmt.Fprintln(os.Stderr, localization.GetMessage("protected_path_hint"))
+		}
+	} else if opts.Verbose {
+		fmt.Println(localization.GetMessage("file_deleted_verbose", arg))
+	}
+}
 
-	if len(args) == 0 && !opts.ShowHelp && !opts.ShowVersion && !opts.EmptyTrash {
+// deleteBatch handles the paths of --from-stdin, --files-from and -j: one
+// confirmation for all of them and one batch for the trash index.
+func deleteBatch(paths []string, opts flags.Options) flags.Results {
+	var res flags.Results
+	if opts.DryRun {
+		var plan actions.DeletePlan
+		var totals flags.PlanTotals
+		for _, path := range paths {
+			res.Add(planFile(path, opts, &plan, &totals))
+		}
+		flags.PrintPlanSummary(totals)
+		return res
+	}
+	if (opts.IFlag || opts.InteractiveOnce) && len(paths) > 0 {
+		confirmed, err := confirmPrompt(localization.GetMessage("confirm_delete_files", len(paths)))
+		if err != nil || !confirmed {
+			fmt.Println(localization.GetMessage("delete_cancelled"))
+			res.Add(flags.ErrCancelled)
+			return res
+		}
+	}
 
-		p := tea.NewProgram(browser.NewModel(""))
-		if _, err := p.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error starting program: %v\n", err)
-			os.Exit(1)
+	toTrash := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if inTrash, err := actions.IsInTrash(path); err == nil && inTrash {
+			res.Add(permanentDeleteFile(path, opts))
+		} else {
+			toTrash = append(toTrash, path)
 		}
+	}
+	if len(toTrash) == 0 {
+		return res
+	}
 
-		return
+	target := localization.GetMessage("batch_items", len(toTrash))
+	reported := 0
+	err := actions.SaveDeleteBatch(toTrash, deleteOptions(opts, target), func(path string, _ trash.TrashInfo, err error) {
+		reported++
+		res.Add(err)
+		reportDelete(path, err, opts)
+	})
+	if err != nil {
+		// The items reported on are settled; the rest were never moved.
+		log.Println(flags.ErrorMessage(err))
+		for range toTrash[reported:] {
+			res.Add(err)
+		}
 	}
+	return res
+}
 
-	deleteWithConfirmation(args, opts)
+// runRemove moves args, and the paths read with --from-stdin or
+// --files-from, to the trash.
+func runRemove(opts flags.Options, args []string) error {
+	if opts.ReadsList() {
+		paths, err := opts.InputPaths()
+		if err != nil {
+			return err
+		}
+		args = append(args, paths...)
+		if opts.FromStdin || opts.FilesFrom == "-" {
+			if tty, err := os.Open("/dev/tty"); err == nil {
+				defer tty.Close()
+				promptInput = tty
+			}
+		}
+	}
+	if len(args) == 0 {
+		return &flags.UsageError{Err: flags.ErrNoItems}
+	}
+
+	if opts.Shred {
+		if trashPath, err := actions.GetTrashPath(); err == nil {
+			flags.PrintShredWarning(trashPath)
+		}
+	}
+
+	var res flags.Results
+	if opts.Batch() {
+		res = deleteBatch(args, opts)
+	} else {
+		res = deleteWithConfirmation(args, opts)
+	}
+	return res.Finish()
+}
+
+func runTUI(opts flags.Options, args []string) error {
+	p := tea.NewProgram(browser.NewModel(""))
+	_, err := p.Run()
+	return err
+}
+
+// newCLI is the command line of brm with the commands this package
+// implements.
+func newCLI() *flags.CLI {
+	return flags.NewCLI(
+		flags.Command{Name: flags.CommandRemove, Args: "FILE...", Summary: "command_rm", Run: runRemove},
+		flags.Command{Name: flags.CommandTUI, Summary: "command_tui", Run: runTUI, NoArgs: true},
+	)
+}
+
+func main() {
+	actions.PassphrasePrompt = promptPassphrase
+	flags.Confirm = confirmPrompt
+	err := newCLI().Dispatch(os.Args[1:])
+	flags.PrintError(err)
+	if err := actions.CloseDefaultTrash(); err != nil {
+		log.Println(flags.ErrorMessage(err))
+	}
+	os.Exit(flags.ExitCode(err))
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"brm/actions"
+	"brm/flags"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExitCodes runs brm on real files and checks the exit code each kind
+// of outcome ends it with.
+func TestExitCodes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer actions.CloseDefaultTrash()
+	file := func(name string) string {
+		path := filepath.Join(home, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	missing := filepath.Join(home, "missing")
+	trashDir := filepath.Join(home, ".trash")
+	if err := os.MkdirAll(trashDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	inTrash := filepath.Join(trashDir, "old")
+	if err := os.WriteFile(inTrash, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"deleted", []string{file("a")}, flags.ExitOK},
+		{"several deleted", []string{file("b"), file("c")}, flags.ExitOK},
+		{"missing", []string{missing}, flags.ExitFailure},
+		{"some missing", []string{file("d"), missing}, flags.ExitPartial},
+		{"in the trash without --permanent", []string{inTrash}, flags.ExitProtected},
+		{"protected and missing", []string{inTrash, missing}, flags.ExitFailure},
+		{"unknown flag", []string{"--no-such-flag"}, flags.ExitUsage},
+		{"no items", []string{"restore"}, flags.ExitUsage},
+		{"restore of an unknown item", []string{"restore", "nope"}, flags.ExitFailure},
+	} {
+		if got := flags.ExitCode(newCLI().Dispatch(test.args)); got != test.want {
+			t.Errorf("%s: brm %q exited with %d, want %d", test.name, test.args, got, test.want)
+		}
+	}
+	if _, err := os.Lstat(inTrash); err != nil {
+		t.Fatalf("refused item is gone: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Config struct {
+	Protected                []string        `json:"protected"`
+	DisableDefaultProtection bool            `json:"disable_default_protection"`
+	Shred                    ShredConfig     `json:"shred"`
+	Compress                 CompressConfig  `json:"compress"`
+	Dedup                    DedupConfig     `json:"dedup"`
+	Encryption               EncryptConfig   `json:"encryption"`
+	Quota                    QuotaConfig     `json:"quota"`
+	Retention                RetentionConfig `json:"retention"`
+	Maintenance              MaintainConfig  `json:"maintenance"`
+	Audit                    AuditConfig     `json:"audit"`
+	// Hooks maps hook names such as pre-delete to executables.
+	Hooks map[string]string `json:"hooks"`
+}
+
+type ShredConfig struct {
+	Passes  int    `json:"passes"`
+	Pattern string `json:"pattern"`
+}
+
+// CompressConfig selects trash items the maintenance pass archives. Zero
+// values disable the corresponding rule.
+type CompressConfig struct {
+	OlderThanDays int    `json:"older_than_days"`
+	MinSize       string `json:"min_size"`
+}
+
+type DedupConfig struct {
+	Enabled bool   `json:"enabled"`
+	MinSize string `json:"min_size"`
+}
+
+// EncryptConfig turns on encryption of newly trashed items. Without a
+// KeyFile brm asks for a passphrase.
+type EncryptConfig struct {
+	Enabled      bool   `json:"enabled"`
+	KeyFile      string `json:"key_file"`
+	EncryptPaths bool   `json:"encrypt_paths"`
+}
+
+// QuotaConfig limits the trash size. Limit is a size such as "10G" or a
+// share of the filesystem such as "20%"; Policy is evict, refuse or prompt.
+type QuotaConfig struct {
+	Limit  string `json:"limit"`
+	Policy string `json:"policy"`
+}
+
+// RetentionConfig makes the maintenance pass purge items deleted more than
+// MaxAgeDays ago. Zero keeps items forever.
+type RetentionConfig struct {
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+// MaintainConfig sets how often the daemon and the installed timer run the
+// maintenance pass, as a duration such as "1h" or "30m". The pass only
+// checks the index unless Repair lets it fix it like --fsck.
+type MaintainConfig struct {
+	Interval string `json:"interval"`
+	Repair   bool   `json:"repair"`
+}
+
+// AuditConfig controls the audit log under the state directory, which is
+// written unless Disabled. Syslog also sends every record to syslog or
+// journald.
+type AuditConfig struct {
+	Disabled bool `json:"disabled"`
+	Syslog   bool `json:"syslog"`
+}
+
+func GetStateDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.New("cannot determine user home directory")
+	}
+	return filepath.Join(home, ".brm"), nil
+}
+
+func GetConfigPath() (string, error) {
+	dir, err := GetStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+func Load() (Config, error) {
+	var cfg Config
+
+	path, err := GetConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
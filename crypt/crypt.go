@@ -0,0 +1,167 @@
+package crypt
+
+import (
+	"brm/config"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrWrongKey = errors.New("wrong passphrase or key file")
+	ErrCorrupt  = errors.New("encrypted data is corrupt or was modified")
+)
+
+const (
+	keySize           = 32
+	saltSize          = 16
+	defaultIterations = 600000
+	checkPlaintext    = "brm"
+)
+
+// Params are the key derivation parameters shared by all encrypted items of
+// a user. Check is a known value sealed with the key, so a wrong passphrase
+// is detected before anything is decrypted.
+type Params struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Check      string `json:"check"`
+}
+
+// Key seals item contents and index fields. Every stream and string gets its
+// own subkey or nonce, so one Key can be used for any number of items.
+type Key struct {
+	master []byte
+	aead   cipher.AEAD
+}
+
+func GetParamsPath() (string, error) {
+	dir, err := config.GetStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "encryption.json"), nil
+}
+
+// OpenKey derives the key from secret, a passphrase or the contents of a key
+// file. The first call creates the parameters at path; later calls verify
+// secret against them.
+func OpenKey(path string, secret []byte) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return createKey(path, secret)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var params Params
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(secret, params)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := key.OpenString(params.Check); err != nil || check != checkPlaintext {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
+
+func createKey(path string, secret []byte) (*Key, error) {
+	params := Params{Salt: make([]byte, saltSize), Iterations: defaultIterations}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(secret, params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Check, err = key.SealString(checkPlaintext); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		// Another brm created the parameters first; use those.
+		return OpenKey(path, secret)
+	} else if err != nil {
+		return nil, err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return key, nil
+}
+
+func deriveKey(secret []byte, params Params) (*Key, error) {
+	master, err := pbkdf2.Key(sha256.New, string(secret), params.Salt, params.Iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{master: master, aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// subkey derives an independent AES-GCM key for one stream.
+func (k *Key) subkey(salt []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, k.master, salt, "brm stream", keySize)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key)
+}
+
+// SealString encrypts s into base64 text suitable for the index.
+func (k *Key) SealString(s string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(s), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Key) OpenString(s string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	nonceSize := k.aead.NonceSize()
+	plain, err := k.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
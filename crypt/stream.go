@@ -0,0 +1,159 @@
+package crypt
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Streams are split into chunks sealed with AES-GCM under a per-stream
+// subkey. The nonce is the chunk counter plus a final-chunk flag, so chunks
+// cannot be reordered, and truncating the stream is detected.
+const (
+	streamMagic = "BRMENC1\n"
+	chunkSize   = 64 << 10
+)
+
+type writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewWriter returns a writer that encrypts to w. Close must be called to
+// write the final chunk; it does not close w.
+func (k *Key) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := k.subkey(salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, streamMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encrypting writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == chunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) flush(final bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.counter, final), w.buf, nil)
+	w.counter++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+type reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	sealed  []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+// NewReader returns a reader that decrypts a stream written by NewWriter.
+// It fails with ErrCorrupt if the stream was modified or cut short.
+func (k *Key) NewReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, len(streamMagic)+saltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrCorrupt
+	}
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return nil, ErrCorrupt
+	}
+	aead, err := k.subkey(header[len(streamMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &reader{
+		r:      bufio.NewReaderSize(r, chunkSize+aead.Overhead()),
+		aead:   aead,
+		sealed: make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.r, r.sealed)
+	if err == io.EOF {
+		return ErrCorrupt
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	final := n < len(r.sealed)
+	if !final {
+		if _, err := r.r.Peek(1); err == io.EOF {
+			final = true
+		}
+	}
+
+	plain, err := r.aead.Open(r.sealed[:0:0], chunkNonce(r.counter, final), r.sealed[:n], nil)
+	if err != nil {
+		return ErrCorrupt
+	}
+	r.counter++
+	r.plain = plain
+	r.done = final
+	return nil
+}
+
+func chunkNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,295 @@
+package flags
+
+import (
+	"brm/actions"
+	"brm/localization"
+	"brm/trash"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+// Exit codes of brm.
+const (
+	ExitOK        = 0
+	ExitFailure   = 1
+	ExitUsage     = 2
+	ExitPartial   = 3
+	ExitCancelled = 4
+	ExitProtected = 5
+)
+
+// Names of the commands the main package implements.
+const (
+	CommandRemove = "rm"
+	CommandTUI    = "tui"
+)
+
+var (
+	ErrCancelled       = errors.New("operation cancelled by user")
+	ErrNoItems         = errors.New("no items given")
+	ErrBandwidthLimit  = errors.New("invalid --bwlimit, expected a size such as 20M")
+	ErrCompletionShell = errors.New("unknown shell, expected bash, zsh or fish")
+	ErrExtraArgs       = errors.New("command takes no arguments")
+)
+
+// Command is a subcommand of brm. Run gets the parsed options and the
+// arguments left after the flags and the command name; it reports failures
+// with its error and never exits.
+type Command struct {
+	Name string
+	// Args is the synopsis of the arguments, e.g. "ITEM...".
+	Args string
+	// Summary is the localization key of the one-line description.
+	Summary string
+	Run     func(opts Options, args []string) error
+	// NoArgs commands refuse arguments, so a file named like one of them
+	// is never taken for the command with the files after it ignored.
+	NoArgs bool
+	// Hidden commands serve the completion scripts and are not listed.
+	Hidden bool
+}
+
+// CLI maps a command line to one of its commands.
+type CLI struct {
+	Commands []Command
+}
+
+// NewCLI returns the command line of brm. remove and tui are implemented by
+// the main package; remove runs for a bare "brm FILE...", tui without any
+// arguments.
+func NewCLI(remove, tui Command) *CLI {
+	c := &CLI{}
+	c.Commands = []Command{
+		remove,
+		{Name: "ls", Summary: "command_ls", Run: runList, NoArgs: true},
+		{Name: "restore", Args: "ITEM...", Summary: "command_restore", Run: runRestore},
+		{Name: "purge", Args: "ITEM...", Summary: "command_purge", Run: runPurge},
+		{Name: "empty", Summary: "command_empty", Run: runEmpty, NoArgs: true},
+		{Name: "log", Args: "[ITEM...]", Summary: "command_log", Run: runLog},
+		tui,
+		{Name: "stats", Summary: "command_stats", Run: runStats, NoArgs: true},
+		{Name: "fsck", Summary: "command_fsck", Run: runFsck, NoArgs: true},
+		{Name: "compress", Summary: "command_compress", Run: runCompress, NoArgs: true},
+		{Name: "maintain", Summary: "command_maintain", Run: runMaintain, NoArgs: true},
+		{Name: "daemon", Summary: "command_daemon", Run: runDaemon, NoArgs: true},
+		{Name: "install-units", Summary: "command_install_units", Run: runInstallUnits, NoArgs: true},
+		{Name: "completion", Args: "bash|zsh|fish", Summary: "command_completion", Run: c.runCompletion},
+		{Name: completeRestoreCommand, Run: runCompleteRestore, Hidden: true},
+	}
+	return c
+}
+
+func (c *CLI) command(name string) (Command, bool) {
+	for _, command := range c.Commands {
+		if command.Name == name {
+			return command, true
+		}
+	}
+	return Command{}, false
+}
+
+func (c *CLI) visibleCommands() []Command {
+	var commands []Command
+	for _, command := range c.Commands {
+		if !command.Hidden {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// Dispatch parses args, the command line without the program name, and runs
+// the command it names. A first argument that is not a command, one after
+// "--" or one that names an existing file is a file to delete; --command
+// names the command whatever files exist, for scripts.
+func (c *CLI) Dispatch(args []string) error {
+	var opts Options
+	fs := newFlagSet(&opts)
+	if err := fs.Parse(args); err != nil {
+		return &UsageError{Err: err}
+	}
+
+	switch {
+	case opts.ShowHelp:
+		c.printUsage(os.Stdout, fs)
+		return nil
+	case opts.ShowVersion:
+		fmt.Println("brm " + Version)
+		return nil
+	case opts.GenerateMan != "":
+		return c.generateMan(opts.GenerateMan)
+	}
+	if opts.BandwidthLimit != "" {
+		if rate, err := trash.ParseSize(opts.BandwidthLimit); err != nil || rate <= 0 {
+			return &UsageError{Err: fmt.Errorf("%w: %q", ErrBandwidthLimit, opts.BandwidthLimit)}
+		}
+	}
+	if _, err := opts.PurgeOptions(); err != nil {
+		return &UsageError{Err: err}
+	}
+
+	rest := fs.Args()
+	name := impliedCommand(opts, len(rest))
+	switch {
+	case opts.Command != "":
+		name = opts.Command
+	case len(rest) > 0 && fs.ArgsLenAtDash() != 0:
+		if _, ok := c.command(rest[0]); ok && !pathExists(rest[0]) {
+			name, rest = rest[0], rest[1:]
+		}
+	}
+	command, ok := c.command(name)
+	if !ok {
+		return &UsageError{Err: fmt.Errorf("unknown command %q", name)}
+	}
+	if command.NoArgs && len(rest) > 0 {
+		return &UsageError{Err: fmt.Errorf("%w: %s %q", ErrExtraArgs, command.Name, rest)}
+	}
+	return command.Run(opts, rest)
+}
+
+// pathExists reports whether a command line argument names a file, which
+// brm deletes rather than running the command of the same name.
+func pathExists(arg string) bool {
+	_, err := os.Lstat(arg)
+	return err == nil
+}
+
+// impliedCommand maps the mode flags of earlier versions to their commands.
+// Otherwise the arguments are deleted or, without any, the browser opens.
+func impliedCommand(opts Options, nArgs int) string {
+	switch {
+	case opts.EmptyTrash:
+		return "empty"
+	case opts.List:
+		return "ls"
+	case opts.Restore:
+		return "restore"
+	case opts.Purge:
+		return "purge"
+	case opts.Stats:
+		return "stats"
+	case opts.Compress:
+		return "compress"
+	case opts.Fsck:
+		return "fsck"
+	case nArgs == 0 && !opts.ReadsList():
+		return CommandTUI
+	}
+	return CommandRemove
+}
+
+func (c *CLI) printUsage(w io.Writer, fs *pflag.FlagSet) {
+	fmt.Fprintln(w, localization.GetMessage("usage_header", filepath.Base(os.Args[0])))
+	fmt.Fprintf(w, "\n%s\n", localization.GetMessage("usage_commands"))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, command := range c.visibleCommands() {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", command.Name, command.Args, localization.GetMessage(command.Summary))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%s\n", localization.GetMessage("usage_options"))
+	fmt.Fprint(w, fs.FlagUsages())
+}
+
+// UsageError is a command line brm cannot run.
+type UsageError struct {
+	Err error
+}
+
+func (e *UsageError) Error() string { return e.Err.Error() }
+
+func (e *UsageError) Unwrap() error { return e.Err }
+
+// ExitError ends brm with Code after a command has already reported why,
+// e.g. that some of its items failed.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
+// ExitCode is the exit status of brm after a command returned err.
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	var usageErr *UsageError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	case errors.As(err, &usageErr):
+		return ExitUsage
+	case errors.Is(err, ErrCancelled):
+		return ExitCancelled
+	}
+	return ExitFailure
+}
+
+// PrintError reports err on stderr unless the command already did.
+func PrintError(err error) {
+	var exitErr *ExitError
+	if err == nil || errors.As(err, &exitErr) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "brm: %s\n", ErrorMessage(err))
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintln(os.Stderr, localization.GetMessage("usage_hint", filepath.Base(os.Args[0])))
+	}
+}
+
+// Results counts how the items of a command went, to print the summary line
+// and pick the exit code.
+type Results struct {
+	Succeeded int
+	Failed    int
+	Protected int
+	Cancelled bool
+}
+
+func (r *Results) Add(err error) {
+	var protected *actions.ProtectedPathError
+	switch {
+	case err == nil:
+		r.Succeeded++
+	case errors.Is(err, ErrCancelled):
+		r.Cancelled = true
+	case errors.As(err, &protected):
+		r.Protected++
+		r.Failed++
+	default:
+		r.Failed++
+	}
+}
+
+func (r Results) ExitCode() int {
+	switch {
+	case r.Failed == 0 && r.Cancelled:
+		return ExitCancelled
+	case r.Failed == 0:
+		return ExitOK
+	case r.Protected == r.Failed:
+		return ExitProtected
+	case r.Succeeded > 0:
+		return ExitPartial
+	}
+	return ExitFailure
+}
+
+// Finish prints the summary after several items or any failure and returns
+// the error that ends brm with the matching exit code.
+func (r Results) Finish() error {
+	if r.Succeeded+r.Failed > 1 || r.Failed > 0 {
+		fmt.Fprintln(os.Stderr, localization.GetMessage("summary_line", r.Succeeded, r.Failed))
+	}
+	if code := r.ExitCode(); code != ExitOK {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package flags
+
+import (
+	"brm/actions"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type dispatched struct {
+	name string
+	args []string
+	opts Options
+}
+
+// newTestCLI returns a CLI whose commands only record how they were run.
+func newTestCLI(ran *[]dispatched) *CLI {
+	c := &CLI{}
+	for _, name := range []string{CommandRemove, "ls", "restore", "purge", "empty", CommandTUI, "stats", "fsck", "compress", "maintain", "daemon"} {
+		name := name
+		c.Commands = append(c.Commands, Command{Name: name, Run: func(opts Options, args []string) error {
+			*ran = append(*ran, dispatched{name, args, opts})
+			return nil
+		}, NoArgs: name != CommandRemove && name != "restore" && name != "purge"})
+	}
+	return c
+}
+
+func dispatch(t *testing.T, args ...string) dispatched {
+	t.Helper()
+	var ran []dispatched
+	if err := newTestCLI(&ran).Dispatch(args); err != nil {
+		t.Fatalf("Dispatch(%q): %v", args, err)
+	}
+	if len(ran) != 1 {
+		t.Fatalf("Dispatch(%q) ran %d commands, want 1", args, len(ran))
+	}
+	return ran[0]
+}
+
+func assertDispatch(t *testing.T, args []string, wantName string, wantArgs []string) dispatched {
+	t.Helper()
+	got := dispatch(t, args...)
+	if got.name != wantName || !reflect.DeepEqual(got.args, wantArgs) {
+		t.Errorf("Dispatch(%q) ran %s %q, want %s %q", args, got.name, got.args, wantName, wantArgs)
+	}
+	return got
+}
+
+func TestDispatchCommands(t *testing.T) {
+	assertDispatch(t, nil, CommandTUI, []string{})
+	assertDispatch(t, []string{"ls"}, "ls", []string{})
+	assertDispatch(t, []string{"restore", "a", "b"}, "restore", []string{"a", "b"})
+	assertDispatch(t, []string{"empty"}, "empty", []string{})
+
+	if got := assertDispatch(t, []string{"-v", "ls"}, "ls", []string{}); !got.opts.Verbose {
+		t.Error("flag before the command was lost")
+	}
+	if got := assertDispatch(t, []string{"purge", "-n", "x"}, "purge", []string{"x"}); !got.opts.DryRun {
+		t.Error("flag after the command was lost")
+	}
+}
+
+func TestDispatchBareFilesAreRemoved(t *testing.T) {
+	assertDispatch(t, []string{"a", "b"}, CommandRemove, []string{"a", "b"})
+	// Only the first argument names a command; "--" or rm deletes a file
+	// called like one.
+	assertDispatch(t, []string{"a", "ls"}, CommandRemove, []string{"a", "ls"})
+	assertDispatch(t, []string{"--", "ls"}, CommandRemove, []string{"ls"})
+	assertDispatch(t, []string{"rm", "tui"}, CommandRemove, []string{"tui"})
+	assertDispatch(t, []string{"--from-stdin"}, CommandRemove, []string{})
+}
+
+func TestDispatchExistingFileIsNotACommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, name := range []string{"empty", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// What "brm *" expands to.
+	assertDispatch(t, []string{"empty", "notes.txt"}, CommandRemove, []string{"empty", "notes.txt"})
+	assertDispatch(t, []string{"empty"}, CommandRemove, []string{"empty"})
+	// --command always names the command.
+	assertDispatch(t, []string{"--command", "empty"}, "empty", []string{})
+	assertDispatch(t, []string{"--command=restore", "--", "empty", "-x"}, "restore", []string{"empty", "-x"})
+}
+
+func TestDispatchModeFlags(t *testing.T) {
+	assertDispatch(t, []string{"-e"}, "empty", []string{})
+	assertDispatch(t, []string{"-l"}, "ls", []string{})
+	assertDispatch(t, []string{"--restore", "x"}, "restore", []string{"x"})
+	assertDispatch(t, []string{"--purge", "x"}, "purge", []string{"x"})
+	assertDispatch(t, []string{"--stats", "--json"}, "stats", []string{})
+}
+
+func TestDispatchUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--bogus"},
+		{"--bwlimit", "fast", "f"},
+		{"--shred", "--shred-pattern", "nope", "--purge", "f"},
+		{"empty", "x"},
+		{"daemon", "x"},
+		{"-e", "x"},
+		{"--command", "bogus"},
+		{"--command", "empty", "x"},
+	} {
+		var ran []dispatched
+		err := newTestCLI(&ran).Dispatch(args)
+		var usageErr *UsageError
+		if !errors.As(err, &usageErr) || ExitCode(err) != ExitUsage {
+			t.Errorf("Dispatch(%q) = %v, want a usage error", args, err)
+		}
+		if len(ran) != 0 {
+			t.Errorf("Dispatch(%q) ran %v", args, ran)
+		}
+	}
+	if !errors.Is(newTestCLI(new([]dispatched)).Dispatch([]string{"--bwlimit", "0", "f"}), ErrBandwidthLimit) {
+		t.Error("zero --bwlimit accepted")
+	}
+}
+
+func TestDispatchReturnsCommandError(t *testing.T) {
+	failure := errors.New("failure")
+	c := &CLI{Commands: []Command{{Name: "ls", Run: func(Options, []string) error { return failure }}}}
+	if err := c.Dispatch([]string{"ls"}); err != failure {
+		t.Fatalf("Dispatch = %v, want %v", err, failure)
+	}
+	if code := ExitCode(failure); code != ExitFailure {
+		t.Errorf("ExitCode = %d, want %d", code, ExitFailure)
+	}
+}
+
+func TestResultsExitCode(t *testing.T) {
+	failure := errors.New("failure")
+	protected := &actions.ProtectedPathError{Path: "/", Err: actions.ErrRemoveRoot}
+	for _, test := range []struct {
+		errs []error
+		want int
+	}{
+		{nil, ExitOK},
+		{[]error{nil, nil}, ExitOK},
+		{[]error{nil, failure}, ExitPartial},
+		{[]error{failure}, ExitFailure},
+		{[]error{protected}, ExitProtected},
+		{[]error{nil, ErrCancelled}, ExitCancelled},
+	} {
+		var res Results
+		for _, err := range test.errs {
+			res.Add(err)
+		}
+		if got := res.ExitCode(); got != test.want {
+			t.Errorf("Results of %v: exit code %d, want %d", test.errs, got, test.want)
+		}
+	}
+}
+
+func TestPurgeOfTheTrashNeedsPermanent(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	trashDir := filepath.Join(home, ".trash")
+	file := filepath.Join(trashDir, "file")
+	if err := os.MkdirAll(trashDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := runPurge(Options{}, []string{trashDir})
+	if code := ExitCode(err); code != ExitProtected {
+		t.Fatalf("purge of the trash without --permanent: %v, exit code %d, want %d", err, code, ExitProtected)
+	}
+	if _, err := os.Lstat(file); err != nil {
+		t.Fatalf("trash emptied without --permanent: %v", err)
+	}
+
+	if err := runPurge(Options{Permanent: true}, []string{trashDir}); err != nil {
+		t.Fatalf("purge of the trash with --permanent: %v", err)
+	}
+	if _, err := os.Lstat(file); !os.IsNotExist(err) {
+		t.Fatalf("trash kept with --permanent: %v", err)
+	}
+}
+
+func TestFsckDryRunRepairsNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	trashDir := filepath.Join(home, ".trash")
+	if err := os.MkdirAll(trashDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(trashDir, "orphan"), []byte("orphan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runFsck(Options{DryRun: true}, nil); err != nil {
+		t.Fatalf("fsck -n: %v", err)
+	}
+	if entries, err := actions.ListTrash(); err != nil || len(entries) != 0 {
+		t.Fatalf("entries after fsck -n: %v, %v", entries, err)
+	}
+	if err := runFsck(Options{}, nil); err != nil {
+		t.Fatalf("fsck: %v", err)
+	}
+	if entries, err := actions.ListTrash(); err != nil || len(entries) != 1 {
+		t.Fatalf("entries after fsck: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,268 @@
+package flags
+
+import (
+	"brm/actions"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// completeRestoreCommand is the hidden subcommand the completion scripts run
+// to complete the items of restore and purge.
+const completeRestoreCommand = "__complete-restore"
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// flagChoices are the values offered after flags with a fixed set of them.
+var flagChoices = map[string][]string{
+	"shred-pattern": {actions.ShredPatternRandom, actions.ShredPatternZero},
+}
+
+// fileFlags take a file name.
+var fileFlags = map[string]bool{
+	"files-from": true,
+}
+
+type completionFlag struct {
+	name      string
+	shorthand string
+	usage     string
+	takesArg  bool
+}
+
+// completionFlags lists the flags brm registers, so the scripts never miss
+// one.
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	newFlagSet(&Options{}).VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden {
+			return
+		}
+		_, usage := pflag.UnquoteUsage(flag)
+		flags = append(flags, completionFlag{
+			name:      flag.Name,
+			shorthand: flag.Shorthand,
+			usage:     usage,
+			takesArg:  flag.Value.Type() != "bool",
+		})
+	})
+	return flags
+}
+
+// runCompletion prints the completion script for the shell named by args.
+func (c *CLI) runCompletion(opts Options, args []string) error {
+	if len(args) != 1 {
+		return &UsageError{Err: ErrCompletionShell}
+	}
+	var commands []string
+	for _, command := range c.visibleCommands() {
+		commands = append(commands, command.Name)
+	}
+
+	flags := completionFlags()
+	switch args[0] {
+	case "bash":
+		return writeBashCompletion(os.Stdout, flags, commands)
+	case "zsh":
+		return writeZshCompletion(os.Stdout, flags, commands)
+	case "fish":
+		return writeFishCompletion(os.Stdout, flags, commands)
+	}
+	return &UsageError{Err: fmt.Errorf("%w: %q", ErrCompletionShell, args[0])}
+}
+
+func runCompleteRestore(opts Options, args []string) error {
+	prefix := ""
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+	// Completion must stay quiet, so errors only mean no candidates.
+	_ = completeRestore(prefix, os.Stdout)
+	return nil
+}
+
+// completeRestore prints the trash names and original paths starting with
+// prefix, one per line. Encrypted paths are skipped rather than prompting
+// for the passphrase in the middle of a completion.
+func completeRestore(prefix string, w io.Writer) error {
+	t, err := actions.DefaultTrash()
+	if err != nil {
+		return err
+	}
+	entries, err := t.List()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, entry := range entries {
+		for _, candidate := range []string{entry.TrashName, entry.OriginalPath} {
+			if candidate != "" && !seen[candidate] && strings.HasPrefix(candidate, prefix) {
+				seen[candidate] = true
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		fmt.Fprintln(w, candidate)
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag, commands []string) error {
+	var words, valueFlags, fileFlagNames []string
+	var choices strings.Builder
+	for _, flag := range flags {
+		names := []string{"--" + flag.name}
+		if flag.shorthand != "" {
+			names = append(names, "-"+flag.shorthand)
+		}
+		words = append(words, names...)
+		switch {
+		case flagChoices[flag.name] != nil:
+			fmt.Fprintf(&choices, "\t\t%s)\n\t\t\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n\t\t\treturn\n\t\t\t;;\n",
+				strings.Join(names, "|"), strings.Join(flagChoices[flag.name], " "))
+		case fileFlags[flag.name]:
+			fileFlagNames = append(fileFlagNames, names...)
+		case flag.takesArg:
+			valueFlags = append(valueFlags, names...)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `# bash completion for brm, generated by "brm completion bash"
+_brm() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+	case "$prev" in
+%s		%s)
+			mapfile -t COMPREPLY < <(compgen -f -- "$cur")
+			return
+			;;
+		%s)
+			return
+			;;
+		completion)
+			COMPREPLY=($(compgen -W "%s" -- "$cur"))
+			return
+			;;
+	esac
+
+	if [[ "$cur" == -* ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+		return
+	fi
+
+	local word
+	for word in "${COMP_WORDS[@]:1:COMP_CWORD-1}"; do
+		if [[ "$word" == --restore || "$word" == --purge || ( $COMP_CWORD -gt 1 && ( "${COMP_WORDS[1]}" == restore || "${COMP_WORDS[1]}" == purge ) ) ]]; then
+			mapfile -t COMPREPLY < <(brm --command %s -- "$cur" 2>/dev/null)
+			return
+		fi
+	done
+
+	mapfile -t COMPREPLY < <(compgen -f -- "$cur")
+	if [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY+=($(compgen -W "%s" -- "$cur"))
+	fi
+}
+complete -o filenames -F _brm brm
+`, choices.String(), strings.Join(fileFlagNames, "|"), strings.Join(valueFlags, "|"),
+		strings.Join(completionShells, " "), strings.Join(words, " "),
+		completeRestoreCommand, strings.Join(commands, " "))
+	return err
+}
+
+var zshEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `:`, `\:`, `'`, `'\''`)
+
+func writeZshCompletion(w io.Writer, flags []completionFlag, commands []string) error {
+	var specs strings.Builder
+	for _, flag := range flags {
+		action := ""
+		switch {
+		case flagChoices[flag.name] != nil:
+			action = fmt.Sprintf(":%s:(%s)", flag.name, strings.Join(flagChoices[flag.name], " "))
+		case fileFlags[flag.name]:
+			action = fmt.Sprintf(":%s:_files", flag.name)
+		case flag.takesArg:
+			action = fmt.Sprintf(":%s: ", flag.name)
+		}
+		usage := zshEscaper.Replace(flag.usage)
+		long := "--" + flag.name
+		if flag.takesArg {
+			long += "="
+		}
+		if flag.shorthand != "" {
+			fmt.Fprintf(&specs, "\t\t'(-%s --%s)'{-%s,%s}'[%s]%s' \\\n", flag.shorthand, flag.name, flag.shorthand, long, usage, action)
+		} else {
+			fmt.Fprintf(&specs, "\t\t'%s[%s]%s' \\\n", long, usage, action)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `#compdef brm
+# zsh completion for brm, generated by "brm completion zsh"
+
+_brm_restore() {
+	local -a items
+	items=("${(@f)$(brm --command %s -- "$PREFIX" 2>/dev/null)}")
+	compadd -a items
+}
+
+_brm() {
+	if (( ${words[(I)--restore]} || ${words[(I)--purge]} )) || [[ ${words[2]} == (restore|purge) && $CURRENT -gt 2 ]]; then
+		_brm_restore
+		return
+	fi
+	if [[ ${words[2]} == completion ]]; then
+		_values shell %s
+		return
+	fi
+
+	_arguments -s \
+%s		'1: :{_alternative "commands:command:(%s)" "files:file:_files"}' \
+		'*:file:_files'
+}
+
+compdef _brm brm
+`, completeRestoreCommand, strings.Join(completionShells, " "), specs.String(), strings.Join(commands, " "))
+	return err
+}
+
+var fishEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func writeFishCompletion(w io.Writer, flags []completionFlag, commands []string) error {
+	if _, err := fmt.Fprintln(w, `# fish completion for brm, generated by "brm completion fish"`); err != nil {
+		return err
+	}
+
+	for _, flag := range flags {
+		line := "complete -c brm"
+		if flag.shorthand != "" {
+			line += " -s " + flag.shorthand
+		}
+		line += " -l " + flag.name
+		switch {
+		case flagChoices[flag.name] != nil:
+			line += fmt.Sprintf(" -x -a '%s'", strings.Join(flagChoices[flag.name], " "))
+		case fileFlags[flag.name]:
+			line += " -r -F"
+		case flag.takesArg:
+			line += " -x"
+		}
+		line += fmt.Sprintf(" -d '%s'", fishEscaper.Replace(flag.usage))
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `complete -c brm -n '__fish_use_subcommand' -a '%s'
+complete -c brm -n '__fish_seen_subcommand_from completion' -f -a '%s'
+complete -c brm -n '__fish_seen_argument -l restore -l purge; or __fish_seen_subcommand_from restore purge' -f -a '(brm --command %s -- (commandline -ct) 2>/dev/null)'
+`, strings.Join(commands, " "), strings.Join(completionShells, " "), completeRestoreCommand)
+	return err
+}
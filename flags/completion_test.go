@@ -0,0 +1,127 @@
+package flags
+
+import (
+	"brm/actions"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// completionScript is the script brm completion prints for shell.
+func completionScript(t *testing.T, shell string) string {
+	t.Helper()
+	c := NewCLI(Command{Name: CommandRemove}, Command{Name: CommandTUI})
+	var commands []string
+	for _, command := range c.visibleCommands() {
+		commands = append(commands, command.Name)
+	}
+	writers := map[string]func(*bytes.Buffer) error{
+		"bash": func(w *bytes.Buffer) error { return writeBashCompletion(w, completionFlags(), commands) },
+		"zsh":  func(w *bytes.Buffer) error { return writeZshCompletion(w, completionFlags(), commands) },
+		"fish": func(w *bytes.Buffer) error { return writeFishCompletion(w, completionFlags(), commands) },
+	}
+	var script bytes.Buffer
+	if err := writers[shell](&script); err != nil {
+		t.Fatalf("%s completion: %v", shell, err)
+	}
+	return script.String()
+}
+
+func TestCompletionScriptsOfferEveryFlagAndCommand(t *testing.T) {
+	for _, shell := range completionShells {
+		script := completionScript(t, shell)
+		for _, flag := range completionFlags() {
+			want := "--" + flag.name
+			if shell == "fish" {
+				want = "-l " + flag.name
+			}
+			if !strings.Contains(script, want) {
+				t.Errorf("%s completion lacks %s", shell, want)
+			}
+		}
+		for _, command := range []string{"restore", "purge", "maintain", "completion"} {
+			if !strings.Contains(script, command) {
+				t.Errorf("%s completion lacks the %s command", shell, command)
+			}
+		}
+		if !strings.Contains(script, "brm --command "+completeRestoreCommand+" -- ") {
+			t.Errorf("%s completion does not ask brm for items with --command", shell)
+		}
+	}
+}
+
+// TestCompletionScriptsParse checks the scripts with the shells installed
+// here; the others are skipped.
+func TestCompletionScriptsParse(t *testing.T) {
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				t.Skipf("%s is not installed", shell)
+			}
+			script := filepath.Join(t.TempDir(), "brm."+shell)
+			if err := os.WriteFile(script, []byte(completionScript(t, shell)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(path, "-n", script).CombinedOutput(); err != nil {
+				t.Fatalf("%s -n: %v\n%s", shell, err, out)
+			}
+		})
+	}
+}
+
+func TestBashCompletionOfRestoreAsksBrm(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	// brm stands in for the real one and answers with how it was run.
+	shell := completionScript(t, "bash") + `
+brm() { printf '%s\n' "$*"; }
+COMP_WORDS=(brm restore no)
+COMP_CWORD=2
+_brm
+printf '%s\n' "${COMPREPLY[@]}"
+`
+	out, err := exec.Command(bash, "-c", shell).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash: %v\n%s", err, out)
+	}
+	if want := "--command " + completeRestoreCommand + " -- no\n"; string(out) != want {
+		t.Fatalf("completion of restore offered %q, want %q", out, want)
+	}
+}
+
+func TestCompleteRestoreListsItems(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer actions.CloseDefaultTrash()
+	notes := filepath.Join(home, "notes.txt")
+	if err := os.WriteFile(notes, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := actions.DefaultTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := tr.Put(notes, actions.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := completeRestore("", &out); err != nil {
+		t.Fatalf("completeRestore: %v", err)
+	}
+	// Candidates are sorted, and the absolute path sorts first.
+	if want := notes + "\n" + entry.TrashName + "\n"; out.String() != want {
+		t.Fatalf("candidates %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	if err := completeRestore("/", &out); err != nil || out.String() != notes+"\n" {
+		t.Fatalf("candidates for / %q, %v, want only the original path", out.String(), err)
+	}
+}
@@ -0,0 +1,104 @@
+package flags
+
+import (
+	"brm/actions"
+	"brm/crypt"
+	"brm/localization"
+	"brm/trash"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sentinelMessages translates the sentinel errors of the lower packages and
+// of the command line, whose own texts are English.
+var sentinelMessages = []struct {
+	err error
+	key string
+}{
+	{actions.ErrRemoveRoot, "err_remove_root"},
+	{actions.ErrRemoveTrashSelf, "err_remove_trash_self"},
+	{actions.ErrProtectedPath, "err_protected_path"},
+	{actions.ErrNotInTrash, "err_not_in_trash"},
+	{actions.ErrRestoreConflict, "err_restore_conflict"},
+	{actions.ErrQuotaExceeded, "err_quota_exceeded"},
+	{actions.ErrNoSpace, "err_no_space"},
+	{actions.ErrQuotaPolicy, "err_quota_policy"},
+	{actions.ErrShredPattern, "err_shred_pattern"},
+	{actions.ErrUnknownHook, "err_unknown_hook"},
+	{actions.ErrKeyRequired, "err_key_required"},
+	{actions.ErrPassphraseMismatch, "err_passphrase_mismatch"},
+	{actions.ErrNotAFile, "err_not_a_file"},
+	{actions.ErrCompressUnsupported, "err_compress_unsupported"},
+	{actions.ErrDryRunUnsupported, "err_dry_run_unsupported"},
+	{actions.ErrUnsupportedOption, "err_unsupported_option"},
+	{trash.ErrIndexTooNew, "err_index_too_new"},
+	{trash.ErrReadOnly, "err_index_read_only"},
+	{crypt.ErrWrongKey, "err_wrong_key"},
+	{crypt.ErrCorrupt, "err_encrypted_corrupt"},
+	{ErrCancelled, "delete_cancelled"},
+	{ErrNoItems, "err_no_items"},
+	{ErrBandwidthLimit, "err_bwlimit"},
+	{ErrCompletionShell, "err_completion_shell"},
+	{ErrExtraArgs, "err_extra_args"},
+	{ErrTimeSpec, "err_time_spec"},
+	{ErrCronInterval, "err_cron_interval"},
+}
+
+// ErrorMessage renders err in the user's language. The typed errors of
+// actions and trash are rebuilt from their fields; the text of a known
+// sentinel is translated in place, keeping the context around it.
+func ErrorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+
+	var protected *actions.ProtectedPathError
+	var conflict *actions.ConflictError
+	var notInTrash *actions.NotInTrashError
+	var crossDevice *actions.CrossDeviceError
+	var hook *actions.HookError
+	var corrupt *trash.IndexCorruptError
+	switch {
+	case errors.As(err, &protected):
+		text := fmt.Sprintf("%s: %s", ErrorMessage(protected.Err), protected.Path)
+		switch protected.Rule {
+		case "":
+		case actions.RuleGitRoot:
+			text += fmt.Sprintf(" (%s)", localization.GetMessage("protected_rule_git_root"))
+		default:
+			text += fmt.Sprintf(" (%s)", protected.Rule)
+		}
+		return strings.Replace(msg, protected.Error(), text, 1)
+	case errors.As(err, &conflict):
+		text := fmt.Sprintf("%s: %s", localization.GetMessage("err_restore_conflict"), conflict.Path)
+		return strings.Replace(msg, conflict.Error(), text, 1)
+	case errors.As(err, &notInTrash):
+		text := fmt.Sprintf("%s: %s", localization.GetMessage("err_not_in_trash"), notInTrash.Name)
+		return strings.Replace(msg, notInTrash.Error(), text, 1)
+	case errors.As(err, &crossDevice):
+		text := localization.GetMessage("err_cross_device", crossDevice.Source, crossDevice.Target, ErrorMessage(crossDevice.Err))
+		return strings.Replace(msg, crossDevice.Error(), text, 1)
+	case errors.As(err, &hook):
+		text := localization.GetMessage("err_hook", hook.Hook, hook.Err)
+		return strings.Replace(msg, hook.Error(), text, 1)
+	case errors.As(err, &corrupt):
+		text := localization.GetMessage("err_index_corrupt")
+		if corrupt.Path != "" {
+			text += ": " + corrupt.Path
+		}
+		if corrupt.Line > 0 {
+			text += fmt.Sprintf(":%d", corrupt.Line)
+		}
+		text += ": " + corrupt.Err.Error()
+		return strings.Replace(msg, corrupt.Error(), text, 1)
+	}
+
+	for _, sentinel := range sentinelMessages {
+		if errors.Is(err, sentinel.err) {
+			return strings.Replace(msg, sentinel.err.Error(), localization.GetMessage(sentinel.key), 1)
+		}
+	}
+	return msg
+}
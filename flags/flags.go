@@ -3,10 +3,18 @@ package flags
 import (
 	"brm/actions"
 	"brm/localization"
+	"brm/trash"
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/pflag"
+	"io"
 	"os"
-	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 type Options struct {
@@ -16,54 +24,503 @@ type Options struct {
 	IFlag           bool
 	InteractiveOnce bool
 	EmptyTrash      bool
+	ForceProtected  bool
+	Permanent       bool
+	Fsck            bool
+	List            bool
+	Stats           bool
+	Restore         bool
+	DryRun          bool
+	FromStdin       bool
+	NullSeparated   bool
+	FilesFrom       string
+	Jobs            int
+	BandwidthLimit  string
+	JSON            bool
+	Purge           bool
+	Shred           bool
+	ShredPasses     int
+	ShredPattern    string
+	Compress        bool
+	CompressAfter   int
+	CompressMinSize string
+	Dedup           bool
+	GenerateMan     string
+	Since           string
+	Until           string
+	Command         string
 }
 
-func ParseFlags() Options {
-	var opts Options
+func (o Options) PurgeOptions() (actions.PurgeOptions, error) {
+	if !o.Shred {
+		return actions.PurgeOptions{}, nil
+	}
+	pattern, err := actions.ParseShredPattern(o.ShredPattern)
+	if err != nil {
+		return actions.PurgeOptions{}, err
+	}
+	return actions.PurgeOptions{Shred: &actions.ShredOptions{Passes: o.ShredPasses, Pattern: pattern, OnLinked: printLinkedWarning}}, nil
+}
+
+func printLinkedWarning(path string) {
+	fmt.Fprintln(os.Stderr, localization.GetMessage("shred_warning_linked", path))
+}
+
+func (o Options) DeleteOptions() actions.DeleteOptions {
+	dedup := actions.DefaultDedupOptions()
+	if o.Dedup && dedup == nil {
+		dedup = &actions.DedupOptions{}
+	}
+	deleteOpts := actions.DeleteOptions{ForceProtected: o.ForceProtected, Dedup: dedup, Jobs: o.Jobs}
+	if o.BandwidthLimit != "" {
+		// Dispatch has already rejected malformed limits.
+		deleteOpts.CopyRate, _ = trash.ParseSize(o.BandwidthLimit)
+	}
+	return deleteOpts
+}
+
+// ReadsList reports whether paths are read with --from-stdin or --files-from.
+func (o Options) ReadsList() bool {
+	return o.FromStdin || o.FilesFrom != ""
+}
+
+// Batch reports whether paths are trashed as one batch: when they are read
+// from a list, or moved by several jobs unless -i asks about each of them.
+func (o Options) Batch() bool {
+	return o.ReadsList() || (o.Jobs > 1 && !o.IFlag)
+}
+
+// InputPaths reads the paths given with --from-stdin or --files-from,
+// separated by newlines or, with -0, by NUL bytes as "find -print0" writes.
+func (o Options) InputPaths() ([]string, error) {
+	var input io.Reader = os.Stdin
+	if o.FilesFrom != "" && o.FilesFrom != "-" {
+		file, err := os.Open(o.FilesFrom)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	separator := byte('\n')
+	if o.NullSeparated {
+		separator = 0
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, separator); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	var paths []string
+	for scanner.Scan() {
+		path := scanner.Text()
+		if separator == '\n' {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// newFlagSet registers the flags of brm, described in the current locale,
+// on a new set that stores them into opts.
+func newFlagSet(opts *Options) *pflag.FlagSet {
+	fs := pflag.NewFlagSet("brm", pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	shredDefaults := actions.DefaultShredOptions()
+
+	fs.BoolVarP(&opts.IFlag, "interactive-each", "i", false, localization.GetMessage("flag_interactive_i"))
+	fs.BoolVarP(&opts.InteractiveOnce, "interactive-once", "I", false, localization.GetMessage("flag_interactive_I"))
+	fs.BoolVarP(&opts.Verbose, "verbose", "v", false, localization.GetMessage("flag_verbose"))
+	fs.BoolVarP(&opts.ShowHelp, "help", "h", false, localization.GetMessage("flag_help"))
+	fs.BoolVar(&opts.ShowVersion, "version", false, localization.GetMessage("flag_version"))
+	fs.BoolVarP(&opts.EmptyTrash, "empty-trash", "e", false, localization.GetMessage("flag_empty_trash"))
+	fs.BoolVar(&opts.Purge, "purge", false, localization.GetMessage("flag_purge"))
+	fs.BoolVar(&opts.Shred, "shred", false, localization.GetMessage("flag_shred"))
+	fs.IntVar(&opts.ShredPasses, "shred-passes", shredDefaults.Passes, localization.GetMessage("flag_shred_passes"))
+	fs.StringVar(&opts.ShredPattern, "shred-pattern", shredDefaults.Pattern, localization.GetMessage("flag_shred_pattern"))
+	fs.BoolVar(&opts.Dedup, "dedup", false, localization.GetMessage("flag_dedup"))
+	fs.BoolVar(&opts.Compress, "compress", false, localization.GetMessage("flag_compress"))
+	fs.IntVar(&opts.CompressAfter, "compress-older-than", 0, localization.GetMessage("flag_compress_older_than"))
+	fs.StringVar(&opts.CompressMinSize, "compress-min-size", "", localization.GetMessage("flag_compress_min_size"))
+	fs.BoolVar(&opts.Restore, "restore", false, localization.GetMessage("flag_restore"))
+	fs.BoolVarP(&opts.DryRun, "dry-run", "n", false, localization.GetMessage("flag_dry_run"))
+	fs.BoolVar(&opts.FromStdin, "from-stdin", false, localization.GetMessage("flag_from_stdin"))
+	fs.BoolVarP(&opts.NullSeparated, "null", "0", false, localization.GetMessage("flag_null"))
+	fs.StringVar(&opts.FilesFrom, "files-from", "", localization.GetMessage("flag_files_from"))
+	fs.IntVarP(&opts.Jobs, "jobs", "j", 1, localization.GetMessage("flag_jobs"))
+	fs.StringVar(&opts.BandwidthLimit, "bwlimit", "", localization.GetMessage("flag_bwlimit"))
+	fs.BoolVarP(&opts.List, "list", "l", false, localization.GetMessage("flag_list"))
+	fs.BoolVar(&opts.Stats, "stats", false, localization.GetMessage("flag_stats"))
+	fs.BoolVar(&opts.JSON, "json", false, localization.GetMessage("flag_json"))
+	fs.StringVar(&opts.Since, "since", "", localization.GetMessage("flag_since"))
+	fs.StringVar(&opts.Until, "until", "", localization.GetMessage("flag_until"))
+	fs.BoolVar(&opts.Fsck, "fsck", false, localization.GetMessage("flag_fsck"))
+	fs.BoolVar(&opts.Permanent, "permanent", false, localization.GetMessage("flag_permanent"))
+	fs.BoolVar(&opts.ForceProtected, "force-protected", false, localization.GetMessage("flag_force_protected"))
+	fs.StringVar(&opts.GenerateMan, "generate-man", "", localization.GetMessage("flag_generate_man"))
+	fs.StringVar(&opts.Command, "command", "", localization.GetMessage("flag_command"))
+	fs.Lookup("generate-man").NoOptDefVal = "."
+	return fs
+}
+
+func runEmpty(opts Options, args []string) error {
+	if opts.DryRun {
+		steps, err := actions.PlanEmptyTrash()
+		if err != nil {
+			return err
+		}
+		var totals PlanTotals
+		PrintPlan(steps, &totals)
+		PrintPlanSummary(totals)
+		return nil
+	}
+
+	purgeOpts, err := opts.PurgeOptions()
+	if err != nil {
+		return err
+	}
+	if purgeOpts.Shred != nil {
+		if trashPath, err := actions.GetTrashPath(); err == nil {
+			PrintShredWarning(trashPath)
+		}
+	}
+	return actions.EmptyTrash(purgeOpts)
+}
+
+// runRestore restores the items named by args, trash names or original
+// paths.
+func runRestore(opts Options, args []string) error {
+	if len(args) == 0 {
+		return &UsageError{Err: ErrNoItems}
+	}
+	var res Results
+	report := func(arg string, err error) {
+		res.Add(err)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, localization.GetMessage("error_restoring", arg, ErrorMessage(err)))
+		} else if opts.Verbose && !opts.DryRun {
+			fmt.Println(localization.GetMessage("restored_verbose", arg))
+		}
+	}
+	if !opts.DryRun {
+		if err := actions.RestoreItems(args, report); err != nil {
+			return err
+		}
+		return res.Finish()
+	}
+
+	var totals PlanTotals
+	for _, arg := range args {
+		steps, err := actions.PlanRestoreItem(arg)
+		PrintPlan(steps, &totals)
+		report(arg, err)
+	}
+	PrintPlanSummary(totals)
+	return res.Finish()
+}
+
+// runPurge deletes the items named by args for good: trash names, original
+// paths or paths inside the trash. Paths given with --from-stdin or
+// --files-from are purged as well.
+func runPurge(opts Options, args []string) error {
+	if opts.ReadsList() {
+		paths, err := opts.InputPaths()
+		if err != nil {
+			return err
+		}
+		args = append(args, paths...)
+	}
+	if len(args) == 0 {
+		return &UsageError{Err: ErrNoItems}
+	}
+	purgeOpts, err := opts.PurgeOptions()
+	if err != nil {
+		return err
+	}
+	if purgeOpts.Shred != nil {
+		if trashPath, err := actions.GetTrashPath(); err == nil {
+			PrintShredWarning(trashPath)
+		}
+	}
 
-	pflag.BoolVarP(&opts.IFlag, "interactive-each", "i", false, localization.GetMessage("flag_interactive_i"))
-	pflag.BoolVarP(&opts.InteractiveOnce, "interactive-once", "I", false, localization.GetMessage("flag_interactive_I"))
-	pflag.BoolVarP(&opts.Verbose, "verbose", "v", false, localization.GetMessage("flag_verbose"))
-	pflag.BoolVar(&opts.ShowHelp, "help", false, localization.GetMessage("flag_help"))
-	pflag.BoolVar(&opts.ShowVersion, "version", false, localization.GetMessage("flag_version"))
-	pflag.BoolVarP(&opts.EmptyTrash, "empty-trash", "e", false, localization.GetMessage("flag_empty_trash"))
+	var res Results
+	var totals PlanTotals
+	for _, arg := range args {
+		inTrash, inTrashErr := actions.IsInTrash(arg)
+		byPath := inTrashErr == nil && inTrash
+		var err error
+		switch {
+		case opts.DryRun && byPath:
+			var steps []actions.PlanStep
+			steps, err = actions.PlanPermanentDelete(arg)
+			PrintPlan(steps, &totals)
+		case opts.DryRun:
+			var steps []actions.PlanStep
+			steps, err = actions.PlanPurgeItem(arg)
+			PrintPlan(steps, &totals)
+		case byPath:
+			if err = ConfirmPermanent(arg, opts); err != nil {
+				// The gate has said why.
+				res.Add(err)
+				continue
+			}
+			err = actions.PermanentDelete(arg, purgeOpts)
+		default:
+			err = actions.PurgeItem(arg, purgeOpts)
+		}
+		res.Add(err)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, localization.GetMessage("error_deleting_file", arg, ErrorMessage(err)))
+		} else if opts.Verbose && !opts.DryRun {
+			fmt.Println(localization.GetMessage("file_deleted_permanently_verbose", arg))
+		}
+	}
+	if opts.DryRun {
+		PrintPlanSummary(totals)
+	}
+	return res.Finish()
+}
+
+// Confirm asks the user a yes or no question. Front ends set it; without it
+// nothing that needs confirming is done.
+var Confirm func(label string) (bool, error)
+
+// ConfirmPermanent is the gate before arg, the trash or a path inside it, is
+// deleted for good, whether by rm or purge. --permanent lets it through;
+// otherwise the user is asked, and without a terminal to ask on it is
+// refused.
+func ConfirmPermanent(arg string, opts Options) error {
+	if opts.Permanent {
+		return nil
+	}
+	if Confirm == nil || !isatty.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintln(os.Stderr, localization.GetMessage("error_deleting_file", arg, ErrorMessage(actions.ErrRemoveTrashSelf)))
+		fmt.Fprintln(os.Stderr, localization.GetMessage("permanent_required_hint"))
+		return &actions.ProtectedPathError{Path: arg, Err: actions.ErrRemoveTrashSelf}
+	}
+	confirmed, err := Confirm(localization.GetMessage("confirm_permanent_delete", arg))
+	if err != nil || !confirmed {
+		fmt.Println(localization.GetMessage("delete_cancelled"))
+		return ErrCancelled
+	}
+	return nil
+}
+
+// PlanTotals adds up the steps of a dry run for PrintPlanSummary.
+type PlanTotals struct {
+	Steps     int
+	CopyBytes int64
+}
 
-	pflag.Usage = func() {
-		msg := localization.GetMessage("usage_header", filepath.Base(os.Args[0]))
-		fmt.Fprintln(os.Stderr, msg)
-		pflag.PrintDefaults()
+// PrintPlan prints what a dry run found an operation would do and adds it
+// to totals.
+func PrintPlan(steps []actions.PlanStep, totals *PlanTotals) {
+	for _, step := range steps {
+		size := trash.FormatSize(step.Size)
+		var line string
+		switch step.Action {
+		case actions.PlanMove:
+			line = localization.GetMessage("plan_move", step.Source, step.Target, size)
+		case actions.PlanCopy:
+			line = localization.GetMessage("plan_copy", step.Source, step.Target, trash.FormatSize(step.CopyBytes))
+		case actions.PlanEncrypt:
+			line = localization.GetMessage("plan_encrypt", step.Source, step.Target, trash.FormatSize(step.CopyBytes))
+		case actions.PlanEvict:
+			line = localization.GetMessage("plan_evict", step.TrashName, size)
+		case actions.PlanRestore:
+			line = localization.GetMessage("plan_restore", step.TrashName, step.Target, size)
+			if step.CopyBytes > 0 {
+				line = localization.GetMessage("plan_restore_copy", step.TrashName, step.Target, trash.FormatSize(step.CopyBytes))
+			}
+		case actions.PlanPurge:
+			line = localization.GetMessage("plan_purge", step.Source, size)
+		}
+		fmt.Println(line)
+		totals.Steps++
+		totals.CopyBytes += step.CopyBytes
 	}
+}
+
+func PrintPlanSummary(totals PlanTotals) {
+	fmt.Println(localization.GetMessage("plan_summary", totals.Steps, trash.FormatSize(totals.CopyBytes)))
+}
+
+func PrintShredWarning(path string) {
+	if warning := actions.ShredWarning(path); warning != "" {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+}
 
-	for _, arg := range os.Args[1:] {
-		if arg == "--help" || arg == "-h" {
-			pflag.Usage()
-			os.Exit(0)
+func runList(opts Options, args []string) error {
+	entries, err := actions.ListTrash()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, localization.GetMessage("list_header"))
+	for _, entry := range entries {
+		size, count, owner := "-", "-", "-"
+		if md := entry.Metadata; md != nil {
+			size = md.FormatSize()
+			count = fmt.Sprint(md.FileCount)
+			owner = md.DeletedBy
+			if md.Hostname != "" {
+				owner += "@" + md.Hostname
+			}
+		}
+		if entry.Storage != trash.StoragePlain {
+			size += " [" + entry.Storage + "]"
 		}
+		originalPath := entry.OriginalPath
+		if originalPath == "" && entry.EncryptedPath != "" {
+			originalPath = localization.GetMessage("encrypted_path")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.DeletionDate.Local().Format("2006-01-02 15:04"), size, count, owner, entry.TrashName, originalPath)
+	}
+	return w.Flush()
+}
+
+// statsLargest is how many of the largest items --stats lists.
+const statsLargest = 10
+
+func runStats(opts Options, args []string) error {
+	stats, err := actions.Stats(statsLargest)
+	if err != nil {
+		return err
+	}
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
 	}
 
-	pflag.Parse()
+	fmt.Println(localization.GetMessage("stats_total", stats.Items, stats.Files,
+		trash.FormatSize(stats.TotalSize), trash.FormatSize(stats.StoredSize)))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, section := range []struct {
+		title  string
+		groups []actions.StatsGroup
+	}{
+		{"stats_by_directory", stats.ByDirectory},
+		{"stats_by_extension", stats.ByExtension},
+		{"stats_by_age", stats.ByAge},
+	} {
+		fmt.Fprintf(w, "\n%s\n", localization.GetMessage(section.title))
+		for _, group := range section.groups {
+			fmt.Fprintf(w, "  %s\t%d\t%s\n", group.Key, group.Count, trash.FormatSize(group.Size))
+		}
+	}
+	fmt.Fprintf(w, "\n%s\n", localization.GetMessage("stats_largest"))
+	for _, item := range stats.Largest {
+		originalPath := item.OriginalPath
+		if originalPath == "" {
+			originalPath = localization.GetMessage("encrypted_path")
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", trash.FormatSize(item.Size), item.TrashName, originalPath)
+	}
+	return w.Flush()
+}
 
-	if opts.ShowVersion {
-		printVersionAndExit()
+func runCompress(opts Options, args []string) error {
+	policy, err := actions.DefaultCompressPolicy()
+	if err != nil {
+		return err
+	}
+	if opts.CompressAfter > 0 {
+		policy.OlderThan = time.Duration(opts.CompressAfter) * 24 * time.Hour
 	}
-	if opts.EmptyTrash {
-		if err := actions.EmptyTrash(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error emptying trash: %v\n", err)
-			os.Exit(1)
+	if opts.CompressMinSize != "" {
+		if policy.MinSize, err = trash.ParseSize(opts.CompressMinSize); err != nil {
+			return err
 		}
-		os.Exit(0)
+	}
+	if !policy.Enabled() {
+		fmt.Println(localization.GetMessage("compress_disabled"))
+		return nil
 	}
 
-	return opts
+	compressed, err := actions.Compress(policy)
+	if opts.Verbose {
+		for _, entry := range compressed {
+			size := "-"
+			if entry.Metadata != nil {
+				size = entry.Metadata.FormatSize()
+			}
+			fmt.Println(localization.GetMessage("compress_item_verbose", entry.TrashName, size, trash.FormatSize(entry.StoredSize)))
+		}
+	}
+	fmt.Println(localization.GetMessage("compress_summary", len(compressed)))
+	return err
 }
 
-func Args() []string {
-	return pflag.Args()
+func runFsck(opts Options, args []string) error {
+	trashPath, err := actions.GetTrashPath()
+	if err != nil {
+		return err
+	}
+
+	trashInfoPath, err := trash.GetTrashInfoPath()
+	if err != nil {
+		return err
+	}
+
+	// A dry run only reports what fsck would repair.
+	repair := !opts.DryRun
+	report, err := trash.Fsck(trashPath, trashInfoPath, repair)
+	if err != nil {
+		return err
+	}
+
+	if report.Clean() {
+		fmt.Println(localization.GetMessage("fsck_clean"))
+		return nil
+	}
+	printFsckReport(report, repair)
+	return nil
 }
 
-func printVersionAndExit() {
-	const version = "brm 1.0.0"
-	fmt.Println(version)
-	os.Exit(0)
+// printFsckReport prints what fsck fixed, or with repaired unset what it
+// found and left alone.
+func printFsckReport(report trash.FsckReport, repaired bool) {
+	suffix := ""
+	if !repaired {
+		suffix = "_found"
+	}
+	if report.CorruptIndex && repaired {
+		fmt.Println(localization.GetMessage("fsck_corrupt_index", report.BackupPath))
+	} else if report.CorruptIndex {
+		fmt.Println(localization.GetMessage("fsck_corrupt_index_found"))
+	}
+	if report.CorruptJournal && repaired {
+		fmt.Println(localization.GetMessage("fsck_corrupt_journal", report.JournalLine, report.JournalBackupPath))
+	} else if report.CorruptJournal {
+		fmt.Println(localization.GetMessage("fsck_corrupt_journal_found", report.JournalLine))
+	}
+	for _, name := range report.DuplicateNames {
+		fmt.Println(localization.GetMessage("fsck_duplicate_entry"+suffix, name))
+	}
+	for _, entry := range report.MissingFiles {
+		fmt.Println(localization.GetMessage("fsck_missing_file"+suffix, entry.TrashName, entry.OriginalPath))
+	}
+	for _, entry := range report.OrphanFiles {
+		fmt.Println(localization.GetMessage("fsck_orphan_file"+suffix, entry.TrashName, entry.OriginalPath))
+	}
+	for _, blobPath := range report.OrphanBlobs {
+		fmt.Println(localization.GetMessage("fsck_orphan_blob"+suffix, blobPath))
+	}
 }
 
+const Version = "1.0.0"
@@ -0,0 +1,94 @@
+package flags
+
+import (
+	"brm/audit"
+	"brm/localization"
+	"brm/trash"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var ErrTimeSpec = errors.New("invalid time, expected a date such as 2006-01-02, a time such as 2006-01-02 15:04 or an age such as 36h or 7d")
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime reads the value of --since or --until: a local date or time, or
+// an age such as 36h or 7d before now.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q", ErrTimeSpec, value)
+}
+
+// runLog prints the audit log records between --since and --until about the
+// items or paths in args, or about everything without args.
+func runLog(opts Options, args []string) error {
+	query := audit.Query{Names: args}
+	now := time.Now()
+	var err error
+	if opts.Since != "" {
+		if query.Since, err = parseTime(opts.Since, now); err != nil {
+			return &UsageError{Err: err}
+		}
+	}
+	if opts.Until != "" {
+		if query.Until, err = parseTime(opts.Until, now); err != nil {
+			return &UsageError{Err: err}
+		}
+	}
+
+	path, err := audit.DefaultPath()
+	if err != nil {
+		return err
+	}
+	records, err := audit.Read(path, query)
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, rec := range records {
+			if err := encoder.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, localization.GetMessage("log_header"))
+	for _, rec := range records {
+		paths := strings.Join(rec.Paths, ", ")
+		if paths == "" {
+			paths = strings.Join(rec.TrashNames, ", ")
+		}
+		outcome := localization.GetMessage("log_outcome_ok")
+		if rec.Outcome != audit.OutcomeOK {
+			outcome = localization.GetMessage("log_outcome_failed")
+			if rec.Error != "" {
+				outcome += ": " + rec.Error
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", rec.Time.Local().Format("2006-01-02 15:04:05"),
+			rec.User, rec.Op, rec.PID, trash.FormatSize(rec.Bytes), paths, outcome)
+	}
+	return w.Flush()
+}
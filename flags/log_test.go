@@ -0,0 +1,28 @@
+package flags
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	for value, want := range map[string]time.Time{
+		"2026-10-01":          time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local),
+		"2026-10-01 08:30":    time.Date(2026, 10, 1, 8, 30, 0, 0, time.Local),
+		"2026-10-01 08:30:15": time.Date(2026, 10, 1, 8, 30, 15, 0, time.Local),
+		"36h":                 now.Add(-36 * time.Hour),
+		"7d":                  now.AddDate(0, 0, -7),
+	} {
+		got, err := parseTime(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseTime(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "yesterday", "-1d", "-2h"} {
+		if _, err := parseTime(value, now); !errors.Is(err, ErrTimeSpec) {
+			t.Errorf("parseTime(%q) = %v, want ErrTimeSpec", value, err)
+		}
+	}
+}
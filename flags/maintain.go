@@ -0,0 +1,195 @@
+package flags
+
+import (
+	"brm/actions"
+	"brm/localization"
+	"brm/trash"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const unitName = "brm-maintain"
+
+var ErrCronInterval = errors.New("cron cannot repeat the maintenance interval, expected a divisor of an hour or of a day")
+
+func runMaintain(opts Options, args []string) error {
+	policy, err := actions.DefaultMaintainPolicy()
+	if err != nil {
+		return err
+	}
+	report, err := actions.Maintain(policy)
+	printMaintainReport(report, opts.Verbose)
+	return err
+}
+
+// runDaemon runs the maintenance pass every policy.Interval until it is
+// interrupted. Failed passes are logged and retried on the next tick.
+func runDaemon(opts Options, args []string) error {
+	policy, err := actions.DefaultMaintainPolicy()
+	if err != nil {
+		return err
+	}
+	trashPath, err := actions.GetTrashPath()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Println(localization.GetMessage("daemon_started", trashPath, policy.Interval))
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := actions.Maintain(policy)
+		printMaintainReport(report, opts.Verbose)
+		if err != nil {
+			log.Println(ErrorMessage(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func printMaintainReport(report actions.MaintainReport, verbose bool) {
+	if !report.Fsck.Clean() {
+		printFsckReport(report.Fsck, report.Repaired)
+		if !report.Repaired {
+			fmt.Println(localization.GetMessage("maintain_fsck_hint"))
+		}
+	}
+	for _, entry := range report.Evicted {
+		fmt.Println(localization.GetMessage("evicted_entry", entry.TrashName, entrySize(entry),
+			entry.DeletionDate.Local().Format("2006-01-02 15:04")))
+	}
+	if verbose {
+		for _, entry := range report.Expired {
+			fmt.Println(localization.GetMessage("expired_entry_verbose", entry.TrashName,
+				entry.DeletionDate.Local().Format("2006-01-02 15:04")))
+		}
+		for _, entry := range report.Compressed {
+			fmt.Println(localization.GetMessage("compress_item_verbose", entry.TrashName, entrySize(entry),
+				trash.FormatSize(entry.StoredSize)))
+		}
+	}
+	fmt.Println(localization.GetMessage("maintain_summary",
+		len(report.Expired), len(report.Evicted), len(report.Compressed)))
+}
+
+func entrySize(entry trash.TrashInfo) string {
+	if entry.Metadata == nil {
+		return "-"
+	}
+	return entry.Metadata.FormatSize()
+}
+
+// runInstallUnits writes a systemd user service and timer that run
+// "brm --command maintain" and a crontab line doing the same for systems
+// without systemd. --command keeps a file named maintain in the working
+// directory from being trashed instead. Enabling either is left to the user.
+func runInstallUnits(opts Options, args []string) error {
+	policy, err := actions.DefaultMaintainPolicy()
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	schedule, err := cronSchedule(policy.Interval)
+	if err != nil {
+		return err
+	}
+
+	unitDir := os.Getenv("XDG_CONFIG_HOME")
+	if unitDir == "" {
+		unitDir = filepath.Join(home, ".config")
+	}
+	unitDir = filepath.Join(unitDir, "systemd", "user")
+	cronPath := filepath.Join(home, ".brm", unitName+".cron")
+
+	files := []struct{ path, content string }{
+		{filepath.Join(unitDir, unitName+".service"), serviceUnit(executable)},
+		{filepath.Join(unitDir, unitName+".timer"), timerUnit(policy.Interval)},
+		{cronPath, fmt.Sprintf("%s %q --command maintain\n", schedule, executable)},
+	}
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file.path, []byte(file.content), 0644); err != nil {
+			return err
+		}
+		fmt.Println(localization.GetMessage("unit_written", file.path))
+	}
+
+	if _, err := exec.LookPath("systemctl"); err == nil {
+		fmt.Println(localization.GetMessage("units_systemd_hint", unitName+".timer"))
+	} else {
+		fmt.Println(localization.GetMessage("units_cron_hint", cronPath))
+	}
+	return nil
+}
+
+func serviceUnit(executable string) string {
+	return fmt.Sprintf(`[Unit]
+Description=brm trash maintenance
+
+[Service]
+Type=oneshot
+ExecStart=%q --command maintain
+Nice=10
+IOSchedulingClass=idle
+`, executable)
+}
+
+func timerUnit(interval time.Duration) string {
+	return fmt.Sprintf(`[Unit]
+Description=Periodic brm trash maintenance
+
+[Timer]
+OnBootSec=10min
+OnUnitActiveSec=%ds
+
+[Install]
+WantedBy=timers.target
+`, int64(interval/time.Second))
+}
+
+// cronSchedule turns interval into a crontab schedule. Cron steps restart
+// at every hour and every day, so only whole minutes dividing an hour and
+// whole hours dividing a day repeat evenly; anything else fails rather than
+// running at a different rate than the timer.
+func cronSchedule(interval time.Duration) (string, error) {
+	if minutes := int64(interval / time.Minute); interval%time.Minute == 0 {
+		switch {
+		case minutes == 1:
+			return "* * * * *", nil
+		case minutes > 1 && minutes < 60 && 60%minutes == 0:
+			return fmt.Sprintf("*/%d * * * *", minutes), nil
+		case minutes == 60:
+			return "0 * * * *", nil
+		case minutes%60 == 0 && minutes < 24*60 && 24%(minutes/60) == 0:
+			return fmt.Sprintf("0 */%d * * *", minutes/60), nil
+		case minutes == 24*60:
+			return "0 0 * * *", nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrCronInterval, interval)
+}
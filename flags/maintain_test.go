@@ -0,0 +1,60 @@
+package flags
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		want     string
+	}{
+		{time.Minute, "* * * * *"},
+		{15 * time.Minute, "*/15 * * * *"},
+		{time.Hour, "0 * * * *"},
+		{6 * time.Hour, "0 */6 * * *"},
+		{24 * time.Hour, "0 0 * * *"},
+	} {
+		got, err := cronSchedule(tc.interval)
+		if err != nil || got != tc.want {
+			t.Errorf("cronSchedule(%s) = %q, %v; want %q", tc.interval, got, err, tc.want)
+		}
+	}
+
+	// Cron steps restart every hour and day, so these would not repeat
+	// evenly: */45 runs at :00 and :45, and nothing in cron means 48h.
+	for _, interval := range []time.Duration{
+		30 * time.Second, 90 * time.Second, 45 * time.Minute, 90 * time.Minute,
+		5 * time.Hour, 48 * time.Hour, 7 * 24 * time.Hour,
+	} {
+		if got, err := cronSchedule(interval); !errors.Is(err, ErrCronInterval) {
+			t.Errorf("cronSchedule(%s) = %q, %v; want ErrCronInterval", interval, got, err)
+		}
+	}
+}
+
+func TestUnitsRunMaintainBesideAFileOfThatName(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile(filepath.Join(dir, "maintain"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const executable = "/usr/bin/brm"
+	var execStart string
+	for _, line := range strings.Split(serviceUnit(executable), "\n") {
+		if args, ok := strings.CutPrefix(line, "ExecStart="); ok {
+			execStart = args
+		}
+	}
+	args, ok := strings.CutPrefix(execStart, `"`+executable+`" `)
+	if !ok {
+		t.Fatalf("ExecStart=%s does not run %s", execStart, executable)
+	}
+	assertDispatch(t, strings.Fields(args), "maintain", []string{})
+}
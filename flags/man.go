@@ -0,0 +1,172 @@
+package flags
+
+import (
+	"brm/localization"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// manLanguages are the man pages --generate-man writes, by subdirectory of
+// the man root and locale.
+var manLanguages = []struct {
+	dir    string
+	locale string
+}{
+	{"", "en_US.UTF-8"},
+	{"ru", "ru_RU.UTF-8"},
+}
+
+var manExitCodes = []struct {
+	code int
+	key  string
+}{
+	{ExitOK, "man_exit_ok"},
+	{ExitFailure, "man_exit_failure"},
+	{ExitUsage, "man_exit_usage"},
+	{ExitPartial, "man_exit_partial"},
+	{ExitCancelled, "man_exit_cancelled"},
+	{ExitProtected, "man_exit_protected"},
+}
+
+var manExamples = []struct {
+	command string
+	key     string
+}{
+	{"brm notes.txt build/", "man_example_delete"},
+	{"brm -i *.log", "man_example_interactive"},
+	{"brm restore ~/notes.txt", "man_example_restore"},
+	{"brm ls", "man_example_list"},
+	{"find . -name '*.tmp' -print0 | brm --from-stdin -0", "man_example_stdin"},
+	{"brm -n empty", "man_example_dry_run"},
+	{"brm purge --shred secret.key", "man_example_shred"},
+	{"brm log --since 7d ~/project", "man_example_log"},
+	{"source <(brm completion bash)", "man_example_completion"},
+}
+
+var manFiles = []struct {
+	path string
+	key  string
+}{
+	{"~/.trash", "man_file_trash"},
+	{"~/.brm/config.json", "man_file_config"},
+	{"~/.brm/trash.json", "man_file_index"},
+	{"~/.brm/trash.log", "man_file_journal"},
+	{"~/.brm/audit.log", "man_file_audit"},
+}
+
+// generateMan writes brm.1 for every language under root, in the man1
+// directories man expects: root/man1 and root/ru/man1.
+func (c *CLI) generateMan(root string) error {
+	locale := localization.Locale()
+	defer localization.SetLocale(locale)
+
+	for _, lang := range manLanguages {
+		localization.SetLocale(lang.locale)
+
+		var page bytes.Buffer
+		c.writeManPage(&page)
+
+		dir := filepath.Join(root, lang.dir, "man1")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, "brm.1")
+		if err := os.WriteFile(path, page.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// writeManPage renders the page in the current locale. The options are
+// registered anew, so their descriptions come from the same catalog.
+func (c *CLI) writeManPage(w io.Writer) {
+	fs := newFlagSet(&Options{})
+
+	fmt.Fprintf(w, ".TH BRM 1 \"\" \"brm %s\" \"%s\"\n", Version, roff(localization.GetMessage("man_manual")))
+
+	manSection(w, "man_section_name")
+	fmt.Fprintf(w, "brm \\- %s\n", roff(localization.GetMessage("man_summary")))
+
+	manSection(w, "man_section_synopsis")
+	fmt.Fprintf(w, ".B brm\n[\\fI%s\\fR] [\\fI%s\\fR...]\n", roff(localization.GetMessage("man_options_arg")), roff(localization.GetMessage("man_files_arg")))
+	for _, command := range c.visibleCommands() {
+		fmt.Fprintf(w, ".br\n.B brm %s\n", roff(command.Name))
+		if command.Args != "" {
+			fmt.Fprintf(w, "\\fI%s\\fR\n", roff(command.Args))
+		}
+	}
+
+	manSection(w, "man_section_description")
+	for i, paragraph := range strings.Split(localization.GetMessage("man_description"), "\n\n") {
+		if i > 0 {
+			fmt.Fprintln(w, ".PP")
+		}
+		fmt.Fprintln(w, roff(paragraph))
+	}
+
+	manSection(w, "man_section_options")
+	fs.VisitAll(func(flag *pflag.Flag) {
+		fmt.Fprintln(w, ".TP")
+		name := "\\fB\\-\\-" + roff(flag.Name) + "\\fR"
+		if flag.Shorthand != "" {
+			name = "\\fB\\-" + roff(flag.Shorthand) + "\\fR, " + name
+		}
+		varName, usage := pflag.UnquoteUsage(flag)
+		if varName != "" {
+			if flag.NoOptDefVal != "" {
+				name += "[=\\fI" + roff(varName) + "\\fR]"
+			} else {
+				name += " \\fI" + roff(varName) + "\\fR"
+			}
+		}
+		fmt.Fprintln(w, name)
+		if varName != "" && flag.DefValue != "" && flag.DefValue != "0" {
+			usage += " " + localization.GetMessage("man_default", flag.DefValue)
+		}
+		fmt.Fprintln(w, roff(usage))
+	})
+
+	manSection(w, "man_section_commands")
+	for _, command := range c.visibleCommands() {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(command.Name), roff(localization.GetMessage(command.Summary)))
+	}
+
+	manSection(w, "man_section_exit_status")
+	for _, exit := range manExitCodes {
+		fmt.Fprintf(w, ".TP\n.B %d\n%s\n", exit.code, roff(localization.GetMessage(exit.key)))
+	}
+
+	manSection(w, "man_section_examples")
+	for _, example := range manExamples {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(example.command), roff(localization.GetMessage(example.key)))
+	}
+
+	manSection(w, "man_section_files")
+	for _, file := range manFiles {
+		fmt.Fprintf(w, ".TP\n.I %s\n%s\n", roff(file.path), roff(localization.GetMessage(file.key)))
+	}
+}
+
+func manSection(w io.Writer, key string) {
+	fmt.Fprintf(w, ".SH %s\n", roff(localization.GetMessage(key)))
+}
+
+var roffEscaper = strings.NewReplacer(`\`, `\e`, `-`, `\-`)
+
+// roff escapes text for a man page, including a leading control character
+// that would otherwise start a request.
+func roff(text string) string {
+	text = roffEscaper.Replace(text)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
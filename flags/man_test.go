@@ -0,0 +1,68 @@
+package flags
+
+import (
+	"brm/localization"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestGenerateManWritesEveryLanguage(t *testing.T) {
+	locale := localization.Locale()
+	root := t.TempDir()
+	c := NewCLI(Command{Name: CommandRemove, Summary: "command_rm"}, Command{Name: CommandTUI, Summary: "command_tui"})
+	if err := c.generateMan(root); err != nil {
+		t.Fatalf("generateMan: %v", err)
+	}
+	if got := localization.Locale(); got != locale {
+		t.Errorf("locale after generateMan %q, want %q", got, locale)
+	}
+
+	pages := make(map[string]string)
+	for _, lang := range manLanguages {
+		page, err := os.ReadFile(filepath.Join(root, lang.dir, "man1", "brm.1"))
+		if err != nil {
+			t.Fatalf("man page for %s: %v", lang.locale, err)
+		}
+		pages[lang.locale] = string(page)
+
+		localization.SetLocale(lang.locale)
+		want := []string{".TH BRM 1 ", ".SH " + roff(localization.GetMessage("man_section_options"))}
+		newFlagSet(&Options{}).VisitAll(func(flag *pflag.Flag) {
+			want = append(want, `\fB\-\-`+roff(flag.Name)+`\fR`)
+		})
+		for _, command := range c.visibleCommands() {
+			want = append(want, ".B brm "+roff(command.Name))
+		}
+		for _, exit := range manExitCodes {
+			want = append(want, fmt.Sprintf(".B %d\n%s", exit.code, roff(localization.GetMessage(exit.key))))
+		}
+		localization.SetLocale(locale)
+		for _, w := range want {
+			if !strings.Contains(string(page), w) {
+				t.Errorf("%s man page lacks %q", lang.locale, w)
+			}
+		}
+	}
+	if pages["en_US.UTF-8"] == pages["ru_RU.UTF-8"] {
+		t.Error("the Russian man page is the English one")
+	}
+}
+
+func TestRoffEscapesControlCharacters(t *testing.T) {
+	for _, test := range []struct{ text, want string }{
+		{"--permanent", `\-\-permanent`},
+		{`C:\trash`, `C:\etrash`},
+		{".hidden", `\&.hidden`},
+		{"'quoted'", `\&'quoted'`},
+		{"plain text", "plain text"},
+	} {
+		if got := roff(test.text); got != test.want {
+			t.Errorf("roff(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
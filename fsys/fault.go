@@ -0,0 +1,208 @@
+package fsys
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Fault makes matching operations of a FaultFS fail with Err, e.g.
+// syscall.EXDEV for rename, syscall.ENOSPC for write or syscall.EACCES.
+type Fault struct {
+	// Op is one of the FS method names in lower case ("rename", "openfile",
+	// "mkdir", ...) or "write" for writes to an open file. Empty matches any.
+	Op string
+	// Path is a filepath.Match pattern; empty matches any path.
+	Path string
+	// After lets that many bytes through before a "write" fault fires.
+	After int64
+	Err   error
+}
+
+func (f Fault) matches(op, path string) bool {
+	if f.Op != "" && f.Op != op {
+		return false
+	}
+	if f.Path == "" {
+		return true
+	}
+	ok, _ := filepath.Match(f.Path, path)
+	return ok
+}
+
+// FaultFS wraps another FS and injects errors into selected operations.
+type FaultFS struct {
+	FS
+	mu     sync.Mutex
+	faults []Fault
+}
+
+func NewFaultFS(inner FS, faults ...Fault) *FaultFS {
+	return &FaultFS{FS: inner, faults: faults}
+}
+
+func (f *FaultFS) Inject(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, fault)
+}
+
+func (f *FaultFS) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+func (f *FaultFS) fault(op, path string) (Fault, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, fault := range f.faults {
+		if fault.matches(op, path) {
+			return fault, true
+		}
+	}
+	return Fault{}, false
+}
+
+func (f *FaultFS) check(op, path string) error {
+	if fault, ok := f.fault(op, path); ok {
+		return pathError(op, path, fault.Err)
+	}
+	return nil
+}
+
+func (f *FaultFS) Stat(name string) (fs.FileInfo, error) {
+	if err := f.check("stat", name); err != nil {
+		return nil, err
+	}
+	return f.FS.Stat(name)
+}
+
+func (f *FaultFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := f.check("lstat", name); err != nil {
+		return nil, err
+	}
+	return f.FS.Lstat(name)
+}
+
+func (f *FaultFS) Open(name string) (File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if err := f.check("openfile", name); err != nil {
+		return nil, err
+	}
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if fault, ok := f.fault("write", name); ok {
+		return &faultFile{File: file, name: name, fault: fault}, nil
+	}
+	return file, nil
+}
+
+func (f *FaultFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.check("readdir", name); err != nil {
+		return nil, err
+	}
+	return f.FS.ReadDir(name)
+}
+
+func (f *FaultFS) Readlink(name string) (string, error) {
+	if err := f.check("readlink", name); err != nil {
+		return "", err
+	}
+	return f.FS.Readlink(name)
+}
+
+func (f *FaultFS) Symlink(oldname, newname string) error {
+	if fault, ok := f.fault("symlink", newname); ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fault.Err}
+	}
+	return f.FS.Symlink(oldname, newname)
+}
+
+func (f *FaultFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := f.check("mkdir", name); err != nil {
+		return err
+	}
+	return f.FS.Mkdir(name, perm)
+}
+
+func (f *FaultFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := f.check("mkdirall", name); err != nil {
+		return err
+	}
+	return f.FS.MkdirAll(name, perm)
+}
+
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	if fault, ok := f.fault("rename", oldpath); ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fault.Err}
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.check("remove", name); err != nil {
+		return err
+	}
+	return f.FS.Remove(name)
+}
+
+func (f *FaultFS) RemoveAll(name string) error {
+	if err := f.check("removeall", name); err != nil {
+		return err
+	}
+	return f.FS.RemoveAll(name)
+}
+
+func (f *FaultFS) Chmod(name string, mode fs.FileMode) error {
+	if err := f.check("chmod", name); err != nil {
+		return err
+	}
+	return f.FS.Chmod(name, mode)
+}
+
+func (f *FaultFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.check("chtimes", name); err != nil {
+		return err
+	}
+	return f.FS.Chtimes(name, atime, mtime)
+}
+
+func (f *FaultFS) Lchown(name string, uid, gid int) error {
+	if err := f.check("lchown", name); err != nil {
+		return err
+	}
+	return f.FS.Lchown(name, uid, gid)
+}
+
+type faultFile struct {
+	File
+	name    string
+	fault   Fault
+	written int64
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	allowed := f.fault.After - f.written
+	if allowed >= int64(len(p)) {
+		n, err := f.File.Write(p)
+		f.written += int64(n)
+		return n, err
+	}
+	if allowed < 0 {
+		allowed = 0
+	}
+	n, err := f.File.Write(p[:allowed])
+	f.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, pathError("write", f.name, f.fault.Err)
+}
@@ -0,0 +1,415 @@
+package fsys
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memNode struct {
+	mode    fs.FileMode
+	data    []byte
+	target  string
+	modTime time.Time
+}
+
+type memInfo struct {
+	name string
+	node memNode
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i memInfo) ModTime() time.Time { return i.node.modTime }
+func (i memInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
+
+// MemFS is an in-memory FS for tests. It has a single root directory "/"
+// and behaves like one POSIX filesystem, so renames never cross devices.
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: map[string]*memNode{
+		"/": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+	}}
+}
+
+func clean(name string) string {
+	return filepath.Clean("/" + name)
+}
+
+func isUnder(dir, path string) bool {
+	return dir == "/" || strings.HasPrefix(path, dir+"/")
+}
+
+func pathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// resolve follows symlinks in the final path element.
+func (m *MemFS) resolve(name string) (string, *memNode, error) {
+	for i := 0; i < 40; i++ {
+		node, ok := m.nodes[name]
+		if !ok {
+			return name, nil, fs.ErrNotExist
+		}
+		if node.mode&fs.ModeSymlink == 0 {
+			return name, node, nil
+		}
+		target := node.target
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+		name = clean(target)
+	}
+	return name, nil, pathError("stat", name, os.ErrInvalid)
+}
+
+func (m *MemFS) parentDir(op, name string) error {
+	parent, ok := m.nodes[filepath.Dir(name)]
+	if !ok {
+		return pathError(op, name, fs.ErrNotExist)
+	}
+	if !parent.mode.IsDir() {
+		return pathError(op, name, os.ErrInvalid)
+	}
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	_, node, err := m.resolve(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return memInfo{name: filepath.Base(name), node: *node}, nil
+}
+
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, pathError("lstat", name, fs.ErrNotExist)
+	}
+	return memInfo{name: filepath.Base(name), node: *node}, nil
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	resolved, node, err := m.resolve(name)
+	if err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, pathError("open", name, fs.ErrExist)
+	}
+	if err != nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, pathError("open", name, err)
+		}
+		if err := m.parentDir("open", resolved); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[resolved] = node
+	}
+	if node.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, pathError("open", name, os.ErrInvalid)
+	}
+	if flag&os.O_TRUNC != 0 {
+		node.data = nil
+	}
+
+	file := &memFile{fs: m, name: resolved, node: node, writable: flag&(os.O_WRONLY|os.O_RDWR) != 0}
+	if flag&os.O_APPEND != 0 {
+		file.offset = int64(len(node.data))
+	}
+	return file, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	resolved, node, err := m.resolve(name)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	if !node.mode.IsDir() {
+		return nil, pathError("readdir", name, os.ErrInvalid)
+	}
+
+	var entries []fs.DirEntry
+	for path, child := range m.nodes {
+		if path != resolved && filepath.Dir(path) == resolved {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(path), node: *child}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return "", pathError("readlink", name, fs.ErrNotExist)
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", pathError("readlink", name, os.ErrInvalid)
+	}
+	return node.target, nil
+}
+
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newname = clean(newname)
+	if _, ok := m.nodes[newname]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := m.parentDir("symlink", newname); err != nil {
+		return err
+	}
+	m.nodes[newname] = &memNode{mode: fs.ModeSymlink | 0777, target: oldname, modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if _, ok := m.nodes[name]; ok {
+		return pathError("mkdir", name, fs.ErrExist)
+	}
+	if err := m.parentDir("mkdir", name); err != nil {
+		return err
+	}
+	m.nodes[name] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	name = clean(name)
+	if info, err := m.Stat(name); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return pathError("mkdir", name, os.ErrInvalid)
+	}
+	if parent := filepath.Dir(name); parent != name {
+		if err := m.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	err := m.Mkdir(name, perm)
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, newpath = clean(oldpath), clean(newpath)
+	linkError := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	node, ok := m.nodes[oldpath]
+	if !ok {
+		return linkError(fs.ErrNotExist)
+	}
+	if oldpath == newpath {
+		return nil
+	}
+	if node.mode.IsDir() && isUnder(oldpath, newpath) {
+		return linkError(os.ErrInvalid)
+	}
+	if existing, ok := m.nodes[newpath]; ok {
+		if existing.mode.IsDir() != node.mode.IsDir() {
+			return linkError(os.ErrExist)
+		}
+		for path := range m.nodes {
+			if path != newpath && isUnder(newpath, path) {
+				return linkError(os.ErrExist)
+			}
+		}
+	}
+	if err := m.parentDir("rename", newpath); err != nil {
+		return linkError(fs.ErrNotExist)
+	}
+
+	moved := make(map[string]*memNode)
+	for path, child := range m.nodes {
+		if path == oldpath || isUnder(oldpath, path) {
+			moved[newpath+strings.TrimPrefix(path, oldpath)] = child
+			delete(m.nodes, path)
+		}
+	}
+	for path, child := range moved {
+		m.nodes[path] = child
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if _, ok := m.nodes[name]; !ok {
+		return pathError("remove", name, fs.ErrNotExist)
+	}
+	for path := range m.nodes {
+		if path != name && isUnder(name, path) {
+			return pathError("remove", name, os.ErrExist)
+		}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	for path := range m.nodes {
+		if path == name || isUnder(name, path) {
+			delete(m.nodes, path)
+		}
+	}
+	if name == "/" {
+		m.nodes["/"] = &memNode{mode: fs.ModeDir | 0755, modTime: time.Now()}
+	}
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	_, node, err := m.resolve(name)
+	if err != nil {
+		return pathError("chmod", name, err)
+	}
+	node.mode = node.mode.Type() | mode.Perm()
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	_, node, err := m.resolve(name)
+	if err != nil {
+		return pathError("chtimes", name, err)
+	}
+	node.modTime = mtime
+	return nil
+}
+
+// Lchown only checks that name exists; MemFS does not model ownership.
+func (m *MemFS) Lchown(name string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if _, ok := m.nodes[name]; !ok {
+		return pathError("lchown", name, fs.ErrNotExist)
+	}
+	return nil
+}
+
+type memFile struct {
+	fs       *MemFS
+	name     string
+	node     *memNode
+	offset   int64
+	writable bool
+	closed   bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if !f.writable {
+		return 0, pathError("write", f.name, os.ErrPermission)
+	}
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset = end
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return memInfo{name: filepath.Base(f.name), node: *f.node}, nil
+}
+
+var _ FS = (*MemFS)(nil)
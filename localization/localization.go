@@ -8,13 +8,16 @@ import (
 var messages = map[string]map[string]string{
 	"en_US.UTF-8": {
 		"err_remove_root":                  "Removing root directory is forbidden",
-		"err_remove_trash_self":            "Removing trash directory without recovery",
+		"err_remove_trash_self":            "Path is inside the trash and can only be deleted permanently",
 		"confirm_delete_files":             "Delete %d files? (y/N)",
 		"confirm_delete_file":              "Delete %s?",
 		"delete_cancelled":                 "Operation cancelled by user",
 		"file_deleted_verbose":             "File %s successfully moved to trash",
 		"error_moving_to_trash":            "Error moving file %s to trash: %v",
-		"usage_header":                     "Usage: %s [options] [files...]",
+		"usage_header":                     "Usage: %[1]s [options] [files...]\n       %[1]s <command> [options] [arguments...]",
+		"usage_commands":                   "Commands:",
+		"usage_options":                    "Options:",
+		"usage_hint":                       "Run %s --help for usage",
 		"flag_interactive_i":               "Prompt before every removal",
 		"flag_interactive_I":               "Prompt once before removing more than three files, or when removing recursively",
 		"flag_verbose":                     "Explain what is being done",
@@ -40,17 +43,182 @@ var messages = map[string]map[string]string{
 		"visual_mode_activated":            "Visual mode activated. Use ↑↓ to select multiple items.",
 		"visual_mode_deactivated":          "Visual mode deactivated.",
 		"could_not_find_original_path_for": "Could not find original path for",
+		"err_protected_path":               "Refusing to trash protected path",
+		"protected_rule_git_root":          "git repository root",
+		"protected_path_hint":              "Use --force-protected to trash protected paths anyway",
+		"flag_force_protected":             "Allow trashing paths from the protection list",
+		"flag_permanent":                   "Permanently delete the trash or items inside it without prompting",
+		"err_not_in_trash":                 "Path is not inside the trash",
+		"err_restore_conflict":             "Restore target already exists",
+		"confirm_permanent_delete":         "Permanently delete %s from trash? This cannot be undone",
+		"permanent_required_hint":          "Use --permanent to delete items from the trash without a prompt",
+		"file_deleted_permanently_verbose": "File %s permanently deleted",
+		"flag_purge":                       "Permanently delete the given trash names (or paths inside the trash)",
+		"flag_shred":                       "Overwrite file contents before permanent deletion (with --empty-trash, --purge, --permanent)",
+		"flag_shred_passes":                "Number of overwrite passes for --shred",
+		"flag_shred_pattern":               "Overwrite pattern for --shred: random or zero",
+		"err_shred_pattern":                "Unknown shred pattern, expected random or zero",
+		"shred_warning_cow":                "Warning: %s is a copy-on-write filesystem, overwritten data may survive in other blocks or snapshots",
+		"shred_warning_journaled":          "Warning: %s keeps a journal, file names and data may survive in it",
+		"shred_warning_network":            "Warning: %s is a network or FUSE filesystem, brm cannot verify that data is overwritten on the server",
+		"shred_warning_linked":             "Warning: %s has other hard links, it was unlinked without overwriting its data",
+		"confirm_shred_files":              "Shred %d item(s)? This cannot be undone",
+		"err_key_required":                 "Encrypted trash needs a passphrase or \"key_file\" in config",
+		"err_not_a_file":                   "Only files can be previewed",
+		"passphrase_prompt":                "Trash passphrase",
+		"passphrase_confirm_prompt":        "Repeat the passphrase",
+		"err_passphrase_mismatch":          "The passphrases do not match",
+		"encrypted_path":                   "(encrypted)",
+		"preview_binary":                   "(binary file, %d bytes shown)",
+		"err_quota_exceeded":               "Trash quota exceeded",
+		"err_no_space":                     "Not enough free space in the trash filesystem",
+		"err_quota_policy":                 "Unknown quota policy, expected evict, refuse or prompt",
+		"evicted_entry":                    "Evicted %s (%s, deleted %s) to make room",
+		"confirm_evict":                    "Purge %d oldest trash item(s) to make room for %s?",
+		"expired_entry_verbose":            "Expired %s (deleted %s)",
+		"maintain_summary":                 "Maintenance done: %d expired, %d evicted, %d compressed",
+		"daemon_started":                   "Maintaining %s every %s",
+		"unit_written":                     "Wrote %s",
+		"units_systemd_hint":               "Enable with: systemctl --user daemon-reload && systemctl --user enable --now %s",
+		"units_cron_hint":                  "systemctl not found, install the cron job with: (crontab -l; cat %s) | crontab -",
+		"flag_stats":                       "Show trash size and usage statistics",
+		"flag_json":                        "With --stats or log, print JSON instead of a table",
+		"stats_total":                      "Items: %d, files: %d, size: %s, stored: %s",
+		"stats_by_directory":               "By directory:",
+		"stats_by_extension":               "By extension:",
+		"stats_by_age":                     "By age:",
+		"stats_largest":                    "Largest items:",
+		"stats_panel":                      "%d item(s), %s (stored %s), largest in %s",
+		"flag_restore":                     "Restore the given items, named by trash name or original path",
+		"flag_dry_run":                     "Run all checks and print what would be done without changing anything",
+		"err_dry_run_unsupported":          "This trash cannot plan a dry run",
+		"error_restoring":                  "Error restoring %s: %v",
+		"restored_verbose":                 "Restored: %s",
+		"plan_move":                        "move %s -> %s (%s)",
+		"plan_copy":                        "copy %s -> %s across filesystems (%s to copy)",
+		"plan_encrypt":                     "encrypt %s -> %s (%s to copy)",
+		"plan_evict":                       "evict %s from trash to make room (%s)",
+		"plan_restore":                     "restore %s -> %s (%s)",
+		"plan_restore_copy":                "restore %s -> %s (%s to copy)",
+		"plan_purge":                       "purge %s (%s)",
+		"plan_summary":                     "Dry run: %d step(s), %s to copy, nothing was changed",
+		"flag_from_stdin":                  "Read the paths to delete from standard input, one per line",
+		"flag_null":                        "With --from-stdin or --files-from, paths are separated by NUL bytes (find -print0)",
+		"flag_files_from":                  "Read the paths to delete from `FILE` (- for standard input)",
+		"batch_items":                      "%d item(s)",
+		"flag_jobs":                        "Move up to `N` items at once",
+		"summary_line":                     "%d succeeded, %d failed",
+		"flag_bwlimit":                     "Cap the copy rate into the trash, bytes per second (e.g. 20M)",
+		"err_bwlimit":                      "Invalid --bwlimit, expected a size such as 20M",
+		"err_no_items":                     "No items given",
+		"err_extra_args":                   "Command takes no arguments (use brm rm to delete files named like a command)",
+		"flag_dedup":                       "Store identical file contents in the trash only once",
+		"flag_compress":                    "Archive old or large trash items (policy from config or --compress-older-than/--compress-min-size)",
+		"flag_compress_older_than":         "With --compress, archive items deleted more than `N` days ago",
+		"flag_compress_min_size":           "With --compress, archive items of at least this size (e.g. 100M)",
+		"err_compress_unsupported":         "This trash cannot store compressed items",
+		"err_unsupported_option":           "This trash does not support the option",
+		"err_cross_device":                 "Copying %s to %s across filesystems failed: %s",
+		"err_index_corrupt":                "Trash index is corrupt",
+		"err_index_too_new":                "Trash index was written by a newer version of brm",
+		"err_index_read_only":              "Trash index is open read-only",
+		"err_wrong_key":                    "Wrong passphrase or key file",
+		"err_encrypted_corrupt":            "Encrypted data is corrupt or was modified",
+		"err_completion_shell":             "Unknown shell, expected bash, zsh or fish",
+		"err_time_spec":                    "Invalid time, expected a date such as 2006-01-02, a time such as 2006-01-02 15:04 or an age such as 36h or 7d",
+		"err_hook":                         "Refused by the %s hook (%v)",
+		"err_unknown_hook":                 "Unknown hook in the configuration, expected pre-delete, post-delete, pre-restore, post-restore or pre-purge",
+		"flag_since":                       "With log, show records from `TIME` on: a date, a time or an age such as 7d",
+		"flag_until":                       "With log, show records before `TIME`",
+		"flag_generate_man":                "Write the man pages (English and Russian) under `DIR`/man1 and DIR/ru/man1",
+		"flag_command":                     "Run the subcommand `NAME` even if a file of that name exists",
+		"man_manual":                       "User Commands",
+		"man_summary":                      "move files to a trash that can be browsed, restored and purged",
+		"man_options_arg":                  "options",
+		"man_files_arg":                    "files",
+		"man_default":                      "(default: %s)",
+		"man_section_name":                 "NAME",
+		"man_section_synopsis":             "SYNOPSIS",
+		"man_section_description":          "DESCRIPTION",
+		"man_section_options":              "OPTIONS",
+		"man_section_commands":             "COMMANDS",
+		"man_section_exit_status":          "EXIT STATUS",
+		"man_section_examples":             "EXAMPLES",
+		"man_section_files":                "FILES",
+		"man_description":                  "brm moves files and directories to a trash instead of deleting them, and records where they came from, who deleted them and when. Items can be restored to their original path, purged one by one, or removed together with --empty-trash.\n\nWithout arguments brm opens an interactive browser of the file system and the trash. Root, the trash itself and protected paths such as system directories are refused unless --force-protected is given.",
+		"command_rm":                       "Move files to the trash (the default when no command is given).",
+		"command_ls":                       "List the items in the trash.",
+		"command_restore":                  "Restore items, given by trash name or original path.",
+		"command_purge":                    "Delete items from the trash for good.",
+		"command_empty":                    "Empty the trash.",
+		"command_tui":                      "Open the interactive browser of the file system and the trash (the default without arguments).",
+		"command_stats":                    "Show how the trash is used.",
+		"command_fsck":                     "Check the index against the trash and repair it.",
+		"command_compress":                 "Compress old items now.",
+		"command_maintain":                 "Run one maintenance pass: check the index, expire old items, enforce the quota and compress.",
+		"command_daemon":                   "Repeat the maintenance pass every maintenance.interval until interrupted.",
+		"command_install_units":            "Write a systemd user timer and a cron line that run brm maintain.",
+		"command_completion":               "Print the completion script for bash, zsh or fish.",
+		"command_log":                      "Show the audit log, optionally only about the given items or paths.",
+		"man_exit_ok":                      "Every item was processed.",
+		"man_exit_failure":                 "No item was processed.",
+		"man_exit_usage":                   "Invalid arguments, such as an unknown flag or a malformed --bwlimit.",
+		"man_exit_partial":                 "Only some of the items were processed.",
+		"man_exit_cancelled":               "The user declined a confirmation.",
+		"man_exit_protected":               "Every failure was a refusal to touch root, the trash or a protected path.",
+		"man_example_delete":               "Move a file and a directory to the trash.",
+		"man_example_interactive":          "Ask before trashing each log file.",
+		"man_example_restore":              "Restore the latest deleted item with this original path.",
+		"man_example_list":                 "List the trash with sizes and who deleted each item.",
+		"man_example_stdin":                "Trash the paths found by find, NUL-separated.",
+		"man_example_dry_run":              "Show what emptying the trash would remove without removing it.",
+		"man_example_shred":                "Overwrite a trash item before deleting it for good.",
+		"man_example_completion":           "Enable completion in the current bash session.",
+		"man_example_log":                  "Show who deleted, restored or purged anything under ~/project in the last week.",
+		"man_file_trash":                   "The trash directory.",
+		"man_file_config":                  "Configuration: protected paths, quota, retention, compression, encryption.",
+		"man_file_index":                   "Snapshot of the trash index.",
+		"man_file_journal":                 "Journal of index changes, folded into the snapshot from time to time.",
+		"man_file_audit":                   "Audit log of every delete, restore, purge and empty, one JSON record per line.",
+		"compress_disabled":                "No compression policy set, use --compress-older-than, --compress-min-size or \"compress\" in config",
+		"compress_item_verbose":            "Compressed %s: %s -> %s",
+		"compress_summary":                 "Compressed %d item(s)",
+		"flag_list":                        "List trashed items with their metadata",
+		"list_header":                      "DELETED\tSIZE\tFILES\tBY\tTRASH NAME\tORIGINAL PATH",
+		"log_header":                       "TIME\tUSER\tOPERATION\tPID\tSIZE\tPATHS\tRESULT",
+		"log_outcome_ok":                   "ok",
+		"log_outcome_failed":               "failed",
+		"details_line":                     "%s · deleted %s by %s · %s, %d file(s), %s",
+		"flag_fsck":                        "Check the trash index against the trash directory and repair it",
+		"fsck_clean":                       "Trash index is consistent",
+		"fsck_corrupt_index":               "Index could not be parsed, backed up to %s and rebuilt",
+		"fsck_corrupt_journal":             "Journal could not be parsed from line %d on, backed up to %s; the changes before it were kept",
+		"fsck_duplicate_entry":             "Dropped duplicate entry %s",
+		"fsck_missing_file":                "Dropped entry %s (%s): file is missing from trash",
+		"fsck_orphan_file":                 "Added entry for untracked file %s, will restore to %s",
+		"fsck_orphan_blob":                 "Removed unreferenced blob %s",
+		"fsck_corrupt_index_found":         "Index could not be parsed",
+		"fsck_corrupt_journal_found":       "Journal could not be parsed from line %d on",
+		"fsck_duplicate_entry_found":       "Duplicate entry %s",
+		"fsck_missing_file_found":          "Entry %s (%s): file is missing from trash",
+		"fsck_orphan_file_found":           "Untracked file %s in trash, would restore to %s",
+		"fsck_orphan_blob_found":           "Unreferenced blob %s",
+		"maintain_fsck_hint":               "The index was left as it is; run brm fsck to repair it",
+		"err_cron_interval":                "Cron cannot repeat the maintenance interval, expected a divisor of an hour or of a day",
 	},
 
 	"ru_RU.UTF-8": {
 		"err_remove_root":                  "Удаление корневой директории запрещено",
-		"err_remove_trash_self":            "Удаление директории корзины без возможности",
+		"err_remove_trash_self":            "Путь находится в корзине и может быть удалён только безвозвратно",
 		"confirm_delete_files":             "Удалить %d файлов? (y/N)",
 		"confirm_delete_file":              "Удалить %s?",
 		"delete_cancelled":                 "Операция отменена пользователем",
 		"file_deleted_verbose":             "Файл %s успешно перемещён в корзину",
 		"error_moving_to_trash":            "Ошибка при перемещении файла %s в корзину: %v",
-		"usage_header":                     "Использование: %s [опции] [файлы...]",
+		"usage_header":                     "Использование: %[1]s [опции] [файлы...]\n               %[1]s <команда> [опции] [аргументы...]",
+		"usage_commands":                   "Команды:",
+		"usage_options":                    "Опции:",
+		"usage_hint":                       "Справка: %s --help",
 		"flag_interactive_i":               "Запрашивать подтверждение перед каждым удалением",
 		"flag_interactive_I":               "Запрашивать подтверждение один раз перед удалением более трёх файлов или рекурсивным удалением",
 		"flag_verbose":                     "Показывать подробности выполняемых действий",
@@ -76,6 +244,168 @@ var messages = map[string]map[string]string{
 		"visual_mode_activated":            "Режим выделения активирован. Используйте ↑↓ для выбора нескольких элементов.",
 		"visual_mode_deactivated":          "Режим выделения деактивирован.",
 		"could_not_find_original_path_for": "Could not find original path for",
+		"err_protected_path":               "Отказ перемещать в корзину защищённый путь",
+		"protected_rule_git_root":          "корень git-репозитория",
+		"protected_path_hint":              "Используйте --force-protected, чтобы всё равно переместить защищённый путь в корзину",
+		"flag_force_protected":             "Разрешить перемещение в корзину путей из списка защиты",
+		"flag_permanent":                   "Безвозвратно удалить корзину или её содержимое без подтверждения",
+		"err_not_in_trash":                 "Путь не находится в корзине",
+		"err_restore_conflict":             "Путь для восстановления уже существует",
+		"confirm_permanent_delete":         "Безвозвратно удалить %s из корзины? Это действие нельзя отменить",
+		"permanent_required_hint":          "Используйте --permanent, чтобы удалять файлы из корзины без подтверждения",
+		"file_deleted_permanently_verbose": "Файл %s удалён безвозвратно",
+		"flag_purge":                       "Безвозвратно удалить указанные элементы корзины (по имени в корзине или пути внутри неё)",
+		"flag_shred":                       "Перезаписывать содержимое файлов перед безвозвратным удалением (с --empty-trash, --purge, --permanent)",
+		"flag_shred_passes":                "Количество проходов перезаписи для --shred",
+		"flag_shred_pattern":               "Шаблон перезаписи для --shred: random или zero",
+		"err_shred_pattern":                "Неизвестный шаблон перезаписи, ожидается random или zero",
+		"shred_warning_cow":                "Внимание: %s — файловая система с копированием при записи, данные могут сохраниться в других блоках или снимках",
+		"shred_warning_journaled":          "Внимание: %s ведёт журнал, имена файлов и данные могут в нём сохраниться",
+		"shred_warning_network":            "Внимание: %s — сетевая или FUSE файловая система, brm не может проверить перезапись данных на сервере",
+		"shred_warning_linked":             "Внимание: у %s есть другие жёсткие ссылки, файл удалён без перезаписи данных",
+		"confirm_shred_files":              "Уничтожить %d элемент(ов)? Это действие нельзя отменить",
+		"err_key_required":                 "Для зашифрованной корзины нужна парольная фраза или \"key_file\" в конфигурации",
+		"err_not_a_file":                   "Предпросмотр доступен только для файлов",
+		"passphrase_prompt":                "Парольная фраза корзины",
+		"passphrase_confirm_prompt":        "Повторите парольную фразу",
+		"err_passphrase_mismatch":          "Парольные фразы не совпадают",
+		"encrypted_path":                   "(зашифровано)",
+		"preview_binary":                   "(двоичный файл, показано байт: %d)",
+		"err_quota_exceeded":               "Превышена квота корзины",
+		"err_no_space":                     "Недостаточно свободного места в файловой системе корзины",
+		"err_quota_policy":                 "Неизвестная политика квоты, ожидается evict, refuse или prompt",
+		"evicted_entry":                    "Вытеснен %s (%s, удалён %s), чтобы освободить место",
+		"confirm_evict":                    "Безвозвратно удалить %d самых старых элементов корзины, чтобы освободить место для %s?",
+		"expired_entry_verbose":            "Истёк срок хранения %s (удалён %s)",
+		"maintain_summary":                 "Обслуживание завершено: истекло %d, вытеснено %d, сжато %d",
+		"daemon_started":                   "Обслуживание %s каждые %s",
+		"unit_written":                     "Записан %s",
+		"units_systemd_hint":               "Включите командой: systemctl --user daemon-reload && systemctl --user enable --now %s",
+		"units_cron_hint":                  "systemctl не найден, установите задание cron командой: (crontab -l; cat %s) | crontab -",
+		"flag_stats":                       "Показать размер корзины и статистику использования",
+		"flag_json":                        "С --stats или log выводить JSON вместо таблицы",
+		"stats_total":                      "Элементов: %d, файлов: %d, размер: %s, занято: %s",
+		"stats_by_directory":               "По директориям:",
+		"stats_by_extension":               "По расширениям:",
+		"stats_by_age":                     "По возрасту:",
+		"stats_largest":                    "Самые большие элементы:",
+		"stats_panel":                      "Элементов: %d, %s (занято %s), больше всего в %s",
+		"flag_restore":                     "Восстановить указанные элементы по имени в корзине или исходному пути",
+		"flag_dry_run":                     "Выполнить все проверки и показать план действий, ничего не меняя",
+		"err_dry_run_unsupported":          "Эта корзина не умеет строить план пробного запуска",
+		"error_restoring":                  "Ошибка при восстановлении %s: %v",
+		"restored_verbose":                 "Восстановлен: %s",
+		"plan_move":                        "переместить %s -> %s (%s)",
+		"plan_copy":                        "скопировать %s -> %s на другую файловую систему (копировать %s)",
+		"plan_encrypt":                     "зашифровать %s -> %s (копировать %s)",
+		"plan_evict":                       "вытеснить %s из корзины, чтобы освободить место (%s)",
+		"plan_restore":                     "восстановить %s -> %s (%s)",
+		"plan_restore_copy":                "восстановить %s -> %s (копировать %s)",
+		"plan_purge":                       "безвозвратно удалить %s (%s)",
+		"plan_summary":                     "Пробный запуск: шагов %d, копировать %s, ничего не изменено",
+		"flag_from_stdin":                  "Читать пути для удаления со стандартного ввода, по одному в строке",
+		"flag_null":                        "С --from-stdin или --files-from пути разделены байтом NUL (find -print0)",
+		"flag_files_from":                  "Читать пути для удаления из `FILE` (- — стандартный ввод)",
+		"batch_items":                      "элементов: %d",
+		"flag_jobs":                        "Перемещать до `N` элементов одновременно",
+		"summary_line":                     "Успешно: %d, с ошибками: %d",
+		"flag_bwlimit":                     "Ограничить скорость копирования в корзину, байт в секунду (например, 20M)",
+		"err_bwlimit":                      "Неверное значение --bwlimit, ожидается размер, например 20M",
+		"err_no_items":                     "Не указаны элементы",
+		"err_extra_args":                   "Команда не принимает аргументов (чтобы удалить файлы с именем команды, используйте brm rm)",
+		"flag_dedup":                       "Хранить одинаковое содержимое файлов в корзине только один раз",
+		"flag_compress":                    "Архивировать старые или большие элементы корзины (правила из конфигурации или --compress-older-than/--compress-min-size)",
+		"flag_compress_older_than":         "С --compress архивировать элементы, удалённые более `N` дней назад",
+		"flag_compress_min_size":           "С --compress архивировать элементы не меньше указанного размера (например, 100M)",
+		"err_compress_unsupported":         "Эта корзина не умеет хранить сжатые элементы",
+		"err_unsupported_option":           "Эта корзина не поддерживает параметр",
+		"err_cross_device":                 "Не удалось скопировать %s в %s на другую файловую систему: %s",
+		"err_index_corrupt":                "Индекс корзины повреждён",
+		"err_index_too_new":                "Индекс корзины записан более новой версией brm",
+		"err_index_read_only":              "Индекс корзины открыт только для чтения",
+		"err_wrong_key":                    "Неверная парольная фраза или файл ключа",
+		"err_encrypted_corrupt":            "Зашифрованные данные повреждены или изменены",
+		"err_completion_shell":             "Неизвестная оболочка, ожидается bash, zsh или fish",
+		"err_time_spec":                    "Неверное время, ожидается дата вида 2006-01-02, время вида 2006-01-02 15:04 или давность вида 36h или 7d",
+		"err_hook":                         "Отклонено хуком %s (%v)",
+		"err_unknown_hook":                 "Неизвестный хук в конфигурации, ожидается pre-delete, post-delete, pre-restore, post-restore или pre-purge",
+		"flag_since":                       "С log показывать записи начиная с `ВРЕМЯ`: дата, время или давность, например 7d",
+		"flag_until":                       "С log показывать записи до `ВРЕМЯ`",
+		"flag_generate_man":                "Записать man-страницы (английскую и русскую) в `DIR`/man1 и DIR/ru/man1",
+		"flag_command":                     "Выполнить подкоманду `NAME`, даже если есть файл с таким именем",
+		"man_manual":                       "Пользовательские команды",
+		"man_summary":                      "перемещение файлов в корзину с просмотром, восстановлением и очисткой",
+		"man_options_arg":                  "опции",
+		"man_files_arg":                    "файлы",
+		"man_default":                      "(по умолчанию: %s)",
+		"man_section_name":                 "ИМЯ",
+		"man_section_synopsis":             "ОБЗОР",
+		"man_section_description":          "ОПИСАНИЕ",
+		"man_section_options":              "ПАРАМЕТРЫ",
+		"man_section_commands":             "КОМАНДЫ",
+		"man_section_exit_status":          "КОД ВОЗВРАТА",
+		"man_section_examples":             "ПРИМЕРЫ",
+		"man_section_files":                "ФАЙЛЫ",
+		"man_description":                  "brm не удаляет файлы и директории, а перемещает их в корзину, запоминая, откуда они были удалены, кем и когда. Элементы можно восстановить по исходному пути, удалить по одному или все сразу с --empty-trash.\n\nБез аргументов brm открывает интерактивный просмотр файловой системы и корзины. Корень, сама корзина и защищённые пути, например системные директории, не перемещаются без --force-protected.",
+		"command_rm":                       "Переместить файлы в корзину (по умолчанию, если команда не указана).",
+		"command_ls":                       "Показать содержимое корзины.",
+		"command_restore":                  "Восстановить элементы по имени в корзине или исходному пути.",
+		"command_purge":                    "Удалить элементы из корзины безвозвратно.",
+		"command_empty":                    "Очистить корзину.",
+		"command_tui":                      "Открыть интерактивный просмотр файловой системы и корзины (по умолчанию без аргументов).",
+		"command_stats":                    "Показать статистику корзины.",
+		"command_fsck":                     "Сверить индекс с корзиной и исправить его.",
+		"command_compress":                 "Сжать старые элементы сейчас.",
+		"command_maintain":                 "Один проход обслуживания: проверка индекса, срок хранения, квота и сжатие.",
+		"command_daemon":                   "Повторять проход обслуживания каждые maintenance.interval до прерывания.",
+		"command_install_units":            "Записать таймер systemd пользователя и строку cron, запускающие brm maintain.",
+		"command_completion":               "Вывести скрипт автодополнения для bash, zsh или fish.",
+		"command_log":                      "Показать журнал аудита, при необходимости только по указанным элементам или путям.",
+		"man_exit_ok":                      "Все элементы обработаны.",
+		"man_exit_failure":                 "Ни один элемент не обработан.",
+		"man_exit_usage":                   "Ошибка в аргументах, например неизвестный флаг или неверный --bwlimit.",
+		"man_exit_partial":                 "Обработана только часть элементов.",
+		"man_exit_cancelled":               "Пользователь отказался в подтверждении.",
+		"man_exit_protected":               "Все отказы вызваны защитой корня, корзины или защищённого пути.",
+		"man_example_delete":               "Переместить в корзину файл и директорию.",
+		"man_example_interactive":          "Спрашивать перед перемещением каждого лог-файла.",
+		"man_example_restore":              "Восстановить последний удалённый элемент с этим исходным путём.",
+		"man_example_list":                 "Показать содержимое корзины с размерами и тем, кто удалил каждый элемент.",
+		"man_example_stdin":                "Переместить в корзину пути, найденные find, разделённые NUL.",
+		"man_example_dry_run":              "Показать, что удалит очистка корзины, ничего не удаляя.",
+		"man_example_shred":                "Перезаписать элемент корзины и удалить его безвозвратно.",
+		"man_example_completion":           "Включить автодополнение в текущем сеансе bash.",
+		"man_example_log":                  "Показать, кто удалял, восстанавливал или стирал что-либо в ~/project за последнюю неделю.",
+		"man_file_trash":                   "Директория корзины.",
+		"man_file_config":                  "Конфигурация: защищённые пути, квота, срок хранения, сжатие, шифрование.",
+		"man_file_index":                   "Снимок индекса корзины.",
+		"man_file_journal":                 "Журнал изменений индекса, периодически сворачивается в снимок.",
+		"man_file_audit":                   "Журнал аудита всех удалений, восстановлений, стираний и очисток, по одной записи JSON в строке.",
+		"compress_disabled":                "Правила сжатия не заданы, используйте --compress-older-than, --compress-min-size или \"compress\" в конфигурации",
+		"compress_item_verbose":            "Сжат %s: %s -> %s",
+		"compress_summary":                 "Сжато элементов: %d",
+		"flag_list":                        "Показать файлы в корзине с их метаданными",
+		"list_header":                      "УДАЛЁН\tРАЗМЕР\tФАЙЛОВ\tКЕМ\tИМЯ В КОРЗИНЕ\tИСХОДНЫЙ ПУТЬ",
+		"log_header":                       "ВРЕМЯ\tПОЛЬЗОВАТЕЛЬ\tОПЕРАЦИЯ\tPID\tРАЗМЕР\tПУТИ\tРЕЗУЛЬТАТ",
+		"log_outcome_ok":                   "успешно",
+		"log_outcome_failed":               "ошибка",
+		"details_line":                     "%s · удалён %s пользователем %s · %s, файлов: %d, %s",
+		"flag_fsck":                        "Проверить индекс корзины по содержимому корзины и исправить его",
+		"fsck_clean":                       "Индекс корзины согласован",
+		"fsck_corrupt_index":               "Не удалось разобрать индекс, копия сохранена в %s, индекс перестроен",
+		"fsck_corrupt_journal":             "Не удалось разобрать журнал начиная со строки %d, копия сохранена в %s; изменения до этой строки сохранены",
+		"fsck_duplicate_entry":             "Удалена повторяющаяся запись %s",
+		"fsck_missing_file":                "Удалена запись %s (%s): файл отсутствует в корзине",
+		"fsck_orphan_file":                 "Добавлена запись для неучтённого файла %s, он будет восстановлен в %s",
+		"fsck_orphan_blob":                 "Удалён блоб без ссылок %s",
+		"fsck_corrupt_index_found":         "Не удалось разобрать индекс",
+		"fsck_corrupt_journal_found":       "Не удалось разобрать журнал начиная со строки %d",
+		"fsck_duplicate_entry_found":       "Повторяющаяся запись %s",
+		"fsck_missing_file_found":          "Запись %s (%s): файл отсутствует в корзине",
+		"fsck_orphan_file_found":           "Неучтённый файл %s в корзине, был бы восстановлен в %s",
+		"fsck_orphan_blob_found":           "Блоб без ссылок %s",
+		"maintain_fsck_hint":               "Индекс оставлен как есть; исправить его можно командой brm fsck",
+		"err_cron_interval":                "Cron не может повторять проход с таким интервалом, нужен делитель часа или суток",
 	},
 }
 var langCode = ""
@@ -92,6 +422,17 @@ func getLocale() string {
 	return langCode
 }
 
+// Locale returns the catalog GetMessage uses.
+func Locale() string {
+	return getLocale()
+}
+
+// SetLocale switches GetMessage to another catalog, e.g. to render the man
+// page of every language.
+func SetLocale(locale string) {
+	langCode = locale
+}
+
 func GetMessage(key string, args ...any) string {
 	locale := getLocale()
 	if msgs, ok := messages[locale]; ok {
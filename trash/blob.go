@@ -0,0 +1,40 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlobDirName is the directory inside a trash that holds deduplicated file
+// contents, one file per SHA-256 sum.
+const BlobDirName = ".blobs"
+
+// Blob is a file of a deduplicated item whose content lives in the blob
+// store. Mode, times and ownership are per reference, since several
+// files with different attributes may share one blob.
+type Blob struct {
+	// Path is relative to the item; "." is the item itself.
+	Path    string      `json:"path"`
+	SHA256  string      `json:"sha256"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	UID     uint32      `json:"uid"`
+	GID     uint32      `json:"gid"`
+}
+
+func BlobPath(trashDir, sum string) string {
+	return filepath.Join(trashDir, BlobDirName, sum[:2], sum)
+}
+
+// BlobRefs counts the references to every blob made by entries.
+func BlobRefs(entries []TrashInfo) map[string]int {
+	refs := make(map[string]int)
+	for _, entry := range entries {
+		for _, blob := range entry.Blobs {
+			refs[blob.SHA256]++
+		}
+	}
+	return refs
+}
@@ -0,0 +1,52 @@
+package trash
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// FormatSize formats the size of the item md describes, with a "+" when
+// only part of it could be measured.
+func (md *Metadata) FormatSize() string {
+	if md.SizeUnknown {
+		return FormatSize(md.Size) + "+"
+	}
+	return FormatSize(md.Size)
+}
+
+// ParseSize parses sizes such as "512", "10K", "1.5GiB" or "2 MB". Units are
+// powers of 1024, like the ones FormatSize prints.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		if exp := strings.IndexByte("KMGTPE", value[n-1]); exp >= 0 {
+			for i := 0; i <= exp; i++ {
+				multiplier *= 1024
+			}
+			value = value[:n-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(number * float64(multiplier)), nil
+}
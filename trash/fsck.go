@@ -0,0 +1,204 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FsckReport is what Fsck found and, when repairing, fixed. CorruptIndex
+// is set for an unreadable snapshot and CorruptJournal for an unreadable
+// journal line, JournalLine; the backup paths are where a repair moved them.
+type FsckReport struct {
+	CorruptIndex      bool
+	BackupPath        string
+	CorruptJournal    bool
+	JournalLine       int
+	JournalBackupPath string
+	MissingFiles      []TrashInfo
+	OrphanFiles       []TrashInfo
+	OrphanBlobs       []string
+	DuplicateNames    []string
+}
+
+func (r FsckReport) Clean() bool {
+	return !r.CorruptIndex && !r.CorruptJournal && len(r.MissingFiles) == 0 && len(r.OrphanFiles) == 0 &&
+		len(r.OrphanBlobs) == 0 && len(r.DuplicateNames) == 0
+}
+
+// backupCorrupt moves an unreadable snapshot or journal out of the way.
+func backupCorrupt(path string) (string, error) {
+	backupPath := path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(path, backupPath); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+func recoveredPath(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(string(filepath.Separator), name)
+	}
+	return filepath.Join(home, "brm-recovered", name)
+}
+
+// Fsck checks the index at filePath against the trash directory and, with
+// repair set, rebuilds the index from what it found. The snapshot and the
+// journal are read on their own: entries survive from whichever of them is
+// readable, and from a corrupt journal the lines before the first bad one.
+// Without repair nothing is written, locked or migrated.
+func Fsck(trashDir, filePath string, repair bool) (FsckReport, error) {
+	var report FsckReport
+
+	var store Store
+	if repair {
+		var err error
+		if store, err = OpenStoreAt(filePath); err != nil {
+			return report, err
+		}
+		defer store.Close()
+	}
+
+	var snapshot []TrashInfo
+	var err error
+	if repair {
+		snapshot, err = LoadTrashInfo(filePath)
+	} else {
+		snapshot, _, err = readIndex(filePath)
+	}
+	if errors.Is(err, ErrIndexCorrupt) {
+		report.CorruptIndex = true
+	} else if err != nil {
+		return report, err
+	}
+	report.DuplicateNames = duplicateNames(snapshot)
+
+	index := &logStore{journalPath: journalPathFor(filePath)}
+	index.reset(snapshot)
+	var journalErr *IndexCorruptError
+	if err := index.replay(); errors.As(err, &journalErr) {
+		report.CorruptJournal = true
+		report.JournalLine = journalErr.Line
+	} else if err != nil {
+		return report, err
+	}
+	entries := index.entries()
+
+	seen := make(map[string]struct{}, len(entries))
+	validEntries := make([]TrashInfo, 0, len(entries))
+	for _, entry := range entries {
+		seen[entry.StoredName()] = struct{}{}
+
+		present, err := itemPresent(trashDir, entry)
+		if err != nil {
+			return report, err
+		}
+		if !present {
+			report.MissingFiles = append(report.MissingFiles, entry)
+			continue
+		}
+		validEntries = append(validEntries, entry)
+	}
+
+	// Entries lost with an unreadable part of the index may still refer to
+	// blobs, which would then look unreferenced.
+	if !report.CorruptIndex && !report.CorruptJournal {
+		report.OrphanBlobs, err = orphanBlobs(trashDir, BlobRefs(validEntries))
+		if err != nil {
+			return report, err
+		}
+	}
+
+	dirEntries, err := os.ReadDir(trashDir)
+	if err != nil {
+		return report, err
+	}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.Name() == BlobDirName {
+			continue
+		}
+		if _, ok := seen[dirEntry.Name()]; ok {
+			continue
+		}
+		deletionDate := time.Now()
+		if info, err := dirEntry.Info(); err == nil {
+			deletionDate = info.ModTime()
+		}
+		orphan := TrashInfo{
+			TrashName:    dirEntry.Name(),
+			OriginalPath: recoveredPath(dirEntry.Name()),
+			DeletionDate: deletionDate,
+		}
+		report.OrphanFiles = append(report.OrphanFiles, orphan)
+		validEntries = append(validEntries, orphan)
+	}
+
+	if !repair || report.Clean() {
+		return report, nil
+	}
+	if report.CorruptIndex {
+		if report.BackupPath, err = backupCorrupt(filePath); err != nil {
+			return report, err
+		}
+	}
+	if report.CorruptJournal {
+		if report.JournalBackupPath, err = backupCorrupt(index.journalPath); err != nil {
+			return report, err
+		}
+	}
+	for _, blobPath := range report.OrphanBlobs {
+		if err := os.Remove(blobPath); err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+	}
+	return report, store.Replace(validEntries)
+}
+
+// itemPresent reports whether the trash still holds the item. A
+// deduplicated file has nothing in the trash directory but its blob.
+func itemPresent(trashDir string, entry TrashInfo) (bool, error) {
+	paths := []string{filepath.Join(trashDir, entry.StoredName())}
+	for _, blob := range entry.Blobs {
+		if blob.Path == "." {
+			paths = append(paths, BlobPath(trashDir, blob.SHA256))
+		}
+	}
+
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err == nil {
+			return true, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func orphanBlobs(trashDir string, refs map[string]int) ([]string, error) {
+	blobPaths, err := filepath.Glob(filepath.Join(trashDir, BlobDirName, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []string
+	for _, blobPath := range blobPaths {
+		if refs[filepath.Base(blobPath)] == 0 {
+			orphans = append(orphans, blobPath)
+		}
+	}
+	return orphans, nil
+}
+
+func duplicateNames(entries []TrashInfo) []string {
+	var duplicates []string
+	seen := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		if _, ok := seen[entry.TrashName]; ok {
+			duplicates = append(duplicates, entry.TrashName)
+		}
+		seen[entry.TrashName] = struct{}{}
+	}
+	return duplicates
+}
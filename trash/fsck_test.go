@@ -0,0 +1,190 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFsckTrash makes a trash directory holding files named by names and an
+// empty state directory for its index.
+func newFsckTrash(t *testing.T, names ...string) (trashDir, indexPath string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	trashDir = filepath.Join(home, ".trash")
+	if err := os.MkdirAll(trashDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(trashDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexPath = filepath.Join(home, ".brm", "trash.json")
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return trashDir, indexPath
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dirState is every file under dir with its content, to tell whether
+// anything changed.
+func dirState(t *testing.T, dir string) string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		files = append(files, path+"="+string(data))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return strings.Join(files, "\n")
+}
+
+func TestFsckKeepsSnapshotWhenJournalIsCorrupt(t *testing.T) {
+	trashDir, indexPath := newFsckTrash(t, "a", "b", "c", "d")
+	if err := SaveTrashInfo(indexPath, []TrashInfo{testEntry("a", "/work/a", 2*time.Hour), testEntry("b", "/work/b", time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	journalPath := journalPathFor(indexPath)
+	writeFile(t, journalPath, `{"op":"add","entry":{"trash_name":"c","original_path":"/work/c"}}
+not json
+{"op":"add","entry":{"trash_name":"d","original_path":"/work/d"}}
+`)
+
+	report, err := Fsck(trashDir, indexPath, true)
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if report.CorruptIndex || report.BackupPath != "" {
+		t.Fatalf("readable snapshot reported corrupt: %+v", report)
+	}
+	if !report.CorruptJournal || report.JournalLine != 2 {
+		t.Fatalf("corrupt journal not reported: %+v", report)
+	}
+	if backup, err := os.ReadFile(report.JournalBackupPath); err != nil || !strings.Contains(string(backup), "not json") {
+		t.Fatalf("journal backup %q: %v", backup, err)
+	}
+	if len(report.OrphanFiles) != 1 || report.OrphanFiles[0].TrashName != "d" {
+		t.Fatalf("orphans %+v, want only d", report.OrphanFiles)
+	}
+
+	store := openTestStore(t, indexPath)
+	defer store.Close()
+	// Entries sort by deletion date, which c lacks.
+	want := "c=/work/c a=/work/a b=/work/b d=" + recoveredPath("d")
+	if got := entryNames(t, store); got != want {
+		t.Fatalf("rebuilt entries %q, want %q", got, want)
+	}
+}
+
+func TestFsckRebuildsCorruptSnapshotFromJournal(t *testing.T) {
+	trashDir, indexPath := newFsckTrash(t, "a", "x")
+	writeFile(t, indexPath, `{"version": 2, "entries": [`)
+	writeFile(t, journalPathFor(indexPath), `{"op":"add","entry":{"trash_name":"a","original_path":"/work/a"}}
+`)
+
+	report, err := Fsck(trashDir, indexPath, true)
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if !report.CorruptIndex || report.CorruptJournal {
+		t.Fatalf("report %+v, want only the snapshot corrupt", report)
+	}
+	if backup, err := os.ReadFile(report.BackupPath); err != nil || string(backup) != `{"version": 2, "entries": [` {
+		t.Fatalf("snapshot backup %q: %v", backup, err)
+	}
+
+	store := openTestStore(t, indexPath)
+	defer store.Close()
+	want := "a=/work/a x=" + recoveredPath("x")
+	if got := entryNames(t, store); got != want {
+		t.Fatalf("rebuilt entries %q, want %q", got, want)
+	}
+}
+
+// writeUntidyTrash sets up an index entry whose file is gone, a file
+// without an entry and a blob nothing refers to.
+func writeUntidyTrash(t *testing.T) (trashDir, indexPath, blobPath string) {
+	t.Helper()
+	trashDir, indexPath = newFsckTrash(t, "kept", "orphan")
+	if err := SaveTrashInfo(indexPath, []TrashInfo{testEntry("kept", "/work/kept", time.Hour), testEntry("missing", "/work/missing", 0)}); err != nil {
+		t.Fatal(err)
+	}
+	blobPath = BlobPath(trashDir, strings.Repeat("ab", 32))
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, blobPath, "blob")
+	return trashDir, indexPath, blobPath
+}
+
+func TestFsckRepairsOrphansAndMissingFiles(t *testing.T) {
+	trashDir, indexPath, blobPath := writeUntidyTrash(t)
+
+	report, err := Fsck(trashDir, indexPath, true)
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if len(report.MissingFiles) != 1 || report.MissingFiles[0].TrashName != "missing" {
+		t.Fatalf("missing files %+v", report.MissingFiles)
+	}
+	if len(report.OrphanFiles) != 1 || report.OrphanFiles[0].TrashName != "orphan" {
+		t.Fatalf("orphan files %+v", report.OrphanFiles)
+	}
+	if len(report.OrphanBlobs) != 1 || report.OrphanBlobs[0] != blobPath {
+		t.Fatalf("orphan blobs %v", report.OrphanBlobs)
+	}
+	if _, err := os.Stat(blobPath); !os.IsNotExist(err) {
+		t.Fatalf("orphan blob kept: %v", err)
+	}
+
+	store := openTestStore(t, indexPath)
+	want := "kept=/work/kept orphan=" + recoveredPath("orphan")
+	if got := entryNames(t, store); got != want {
+		t.Fatalf("rebuilt entries %q, want %q", got, want)
+	}
+	store.Close()
+
+	if report, err := Fsck(trashDir, indexPath, true); err != nil || !report.Clean() {
+		t.Fatalf("second Fsck: %+v, %v", report, err)
+	}
+}
+
+func TestFsckDryRunChangesNothing(t *testing.T) {
+	trashDir, indexPath, _ := writeUntidyTrash(t)
+	writeFile(t, journalPathFor(indexPath), "not json\n")
+	home := filepath.Dir(trashDir)
+	before := dirState(t, home)
+
+	report, err := Fsck(trashDir, indexPath, false)
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if !report.CorruptJournal || len(report.MissingFiles) != 1 || len(report.OrphanFiles) != 1 {
+		t.Fatalf("dry run report %+v", report)
+	}
+	if report.JournalBackupPath != "" || report.BackupPath != "" {
+		t.Fatalf("dry run backed up the index: %+v", report)
+	}
+	if after := dirState(t, home); after != before {
+		t.Fatalf("dry run changed files:\n%s\nwas:\n%s", after, before)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package trash
+
+import "os"
+
+func lockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func unlockFile(file *os.File) error {
+	return file.Close()
+}
@@ -0,0 +1,81 @@
+package trash
+
+import "sync"
+
+// memoryStore is a Store that lives only in memory; Close keeps its contents
+// so one instance can be shared across operations.
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]TrashInfo
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{entries: make(map[string]TrashInfo)}
+}
+
+func (s *memoryStore) Add(entries ...TrashInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		s.entries[entry.TrashName] = entry
+	}
+	return nil
+}
+
+func (s *memoryStore) Get(trashName string) (TrashInfo, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[trashName]
+	return entry, ok, nil
+}
+
+func (s *memoryStore) FindByOriginalPath(path string) ([]TrashInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []TrashInfo
+	for _, entry := range s.entries {
+		if entry.OriginalPath == path {
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *memoryStore) Remove(trashNames ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range trashNames {
+		delete(s.entries, name)
+	}
+	return nil
+}
+
+func (s *memoryStore) All() ([]TrashInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]TrashInfo, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *memoryStore) Replace(entries []TrashInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]TrashInfo, len(entries))
+	for _, entry := range entries {
+		s.entries[entry.TrashName] = entry
+	}
+	return nil
+}
+
+func (s *memoryStore) CheckWritable() error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
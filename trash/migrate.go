@@ -0,0 +1,192 @@
+package trash
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const IndexVersion = 2
+
+var (
+	ErrIndexCorrupt = errors.New("trash index is corrupt")
+	ErrIndexTooNew  = errors.New("trash index was written by a newer version of brm")
+)
+
+// IndexCorruptError reports an index or journal that cannot be read. Path and
+// Line are set when known. It matches ErrIndexCorrupt.
+type IndexCorruptError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *IndexCorruptError) Error() string {
+	msg := ErrIndexCorrupt.Error()
+	if e.Path != "" {
+		msg += ": " + e.Path
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" line %d", e.Line)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *IndexCorruptError) Is(target error) bool { return target == ErrIndexCorrupt }
+
+func (e *IndexCorruptError) Unwrap() error { return e.Err }
+
+func corrupt(format string, args ...any) error {
+	return &IndexCorruptError{Err: fmt.Errorf(format, args...)}
+}
+
+type indexFile struct {
+	Version int         `json:"version"`
+	Entries []TrashInfo `json:"entries"`
+}
+
+type migration func(data []byte) ([]byte, error)
+
+// migrations[v] upgrades an index of version v to version v+1.
+var migrations = map[int]migration{
+	1: migrateV1ToV2,
+}
+
+func migrateV1ToV2(data []byte) ([]byte, error) {
+	var entries []TrashInfo
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []TrashInfo{}
+	}
+	return json.Marshal(indexFile{Version: 2, Entries: entries})
+}
+
+func detectVersion(data []byte) (int, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] == '[' || bytes.Equal(trimmed, []byte("null")) {
+		return 1, nil
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(trimmed, &header); err != nil {
+		return 0, &IndexCorruptError{Err: err}
+	}
+	if header.Version < 1 {
+		return 0, corrupt("missing version")
+	}
+	return header.Version, nil
+}
+
+func decodeIndex(data []byte) ([]TrashInfo, int, error) {
+	version, err := detectVersion(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("[]")
+	}
+
+	onDiskVersion := version
+	for version < IndexVersion {
+		migrate, ok := migrations[version]
+		if !ok {
+			return nil, 0, corrupt("no migration from version %d", version)
+		}
+		data, err = migrate(data)
+		if err != nil {
+			return nil, 0, corrupt("migrating from version %d: %w", version, err)
+		}
+		version++
+	}
+
+	var index indexFile
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, 0, &IndexCorruptError{Err: err}
+	}
+	return index.Entries, onDiskVersion, nil
+}
+
+func readIndex(path string) ([]TrashInfo, int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, IndexVersion, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	entries, version, err := decodeIndex(data)
+	var corruptErr *IndexCorruptError
+	if errors.As(err, &corruptErr) {
+		corruptErr.Path = path
+	}
+	return entries, version, err
+}
+
+func peekVersion(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return 1, nil
+	} else if err != nil {
+		return 0, &IndexCorruptError{Err: err}
+	}
+	if token == nil || token == json.Delim('[') {
+		return 1, nil
+	}
+	if token != json.Delim('{') {
+		return 0, corrupt("unexpected %v", token)
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return 0, &IndexCorruptError{Err: err}
+		}
+		if key == "version" {
+			var version int
+			if err := decoder.Decode(&version); err != nil {
+				return 0, &IndexCorruptError{Err: err}
+			}
+			return version, nil
+		}
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return 0, &IndexCorruptError{Err: err}
+		}
+	}
+	return 0, corrupt("missing version")
+}
+
+// CheckWritable reads only the header of the index, so it stays cheap for large indexes.
+func CheckWritable(path string) error {
+	version, err := peekVersion(path)
+	if os.IsNotExist(err) || errors.Is(err, ErrIndexCorrupt) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if version > IndexVersion {
+		return fmt.Errorf("%w: version %d, this brm supports up to %d", ErrIndexTooNew, version, IndexVersion)
+	}
+	return nil
+}
+
+func backupBeforeMigration(path string, version int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fmt.Sprintf("%s.v%d.bak", path, version), data, 0644)
+}
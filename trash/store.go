@@ -0,0 +1,393 @@
+package trash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrReadOnly = errors.New("trash index is open read-only")
+
+// compactThreshold is the journal size after which Close folds it into the snapshot.
+const compactThreshold = 4 << 20
+
+type Store interface {
+	Add(entries ...TrashInfo) error
+	Get(trashName string) (TrashInfo, bool, error)
+	FindByOriginalPath(path string) ([]TrashInfo, error)
+	Remove(trashNames ...string) error
+	All() ([]TrashInfo, error)
+	Replace(entries []TrashInfo) error
+	CheckWritable() error
+	Close() error
+}
+
+type journalRecord struct {
+	Op    string     `json:"op"`
+	Entry *TrashInfo `json:"entry,omitempty"`
+	Name  string     `json:"name,omitempty"`
+}
+
+// logStore keeps the versioned trash.json as a snapshot and appends every change
+// to trash.log, so adding or removing entries never rewrites the whole index.
+// The snapshot and journal are only read when a lookup needs them, but then
+// in full: there is no on-disk index by name, so the first lookup of every
+// brm process costs time linear in the size of the trash. That is cheap for
+// the thousands of entries a trash usually holds, and operations on many
+// items keep one store open rather than loading it per item; Close compacts
+// the journal so it does not grow past compactThreshold on top of the
+// snapshot.
+type logStore struct {
+	indexPath   string
+	journalPath string
+	lock        *os.File
+	journal     *os.File
+	readOnly    bool
+	loaded      bool
+	byName      map[string]TrashInfo
+	byOriginal  map[string]map[string]struct{}
+}
+
+func journalPathFor(indexPath string) string {
+	return strings.TrimSuffix(indexPath, ".json") + ".log"
+}
+
+func OpenStore() (Store, error) {
+	indexPath, err := GetTrashInfoPath()
+	if err != nil {
+		return nil, err
+	}
+	return OpenStoreAt(indexPath)
+}
+
+func OpenStoreAt(indexPath string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		return nil, err
+	}
+	lock, err := lockFile(indexPath + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	return &logStore{
+		indexPath:   indexPath,
+		journalPath: journalPathFor(indexPath),
+		lock:        lock,
+	}, nil
+}
+
+// OpenStoreReadOnly opens the index at indexPath for looking things up
+// without writing anything: it takes no lock, so it sees the index as some
+// writer left it, leaves an old format unmigrated and never compacts the
+// journal. A missing index is empty. Changes fail with ErrReadOnly.
+func OpenStoreReadOnly(indexPath string) (Store, error) {
+	return &logStore{
+		indexPath:   indexPath,
+		journalPath: journalPathFor(indexPath),
+		readOnly:    true,
+	}, nil
+}
+
+func (s *logStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	var entries []TrashInfo
+	var err error
+	if s.readOnly {
+		entries, _, err = readIndex(s.indexPath)
+	} else {
+		entries, err = LoadTrashInfo(s.indexPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.reset(entries)
+	if err := s.replay(); err != nil {
+		return err
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *logStore) reset(entries []TrashInfo) {
+	s.byName = make(map[string]TrashInfo, len(entries))
+	s.byOriginal = make(map[string]map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		s.put(entry)
+	}
+}
+
+// replay applies the journal to the loaded entries. At a line it cannot
+// read it stops with an IndexCorruptError, the lines before it applied.
+func (s *logStore) replay() error {
+	file, err := os.Open(s.journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything after the last newline is a write interrupted by a crash.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return &IndexCorruptError{Path: s.journalPath, Line: lineNo, Err: err}
+		}
+		switch {
+		case record.Op == "add" && record.Entry != nil:
+			s.put(*record.Entry)
+		case record.Op == "remove":
+			s.drop(record.Name)
+		default:
+			return &IndexCorruptError{Path: s.journalPath, Line: lineNo, Err: fmt.Errorf("unknown operation %q", record.Op)}
+		}
+	}
+}
+
+func (s *logStore) put(entry TrashInfo) {
+	s.drop(entry.TrashName)
+	s.byName[entry.TrashName] = entry
+	names, ok := s.byOriginal[entry.OriginalPath]
+	if !ok {
+		names = make(map[string]struct{})
+		s.byOriginal[entry.OriginalPath] = names
+	}
+	names[entry.TrashName] = struct{}{}
+}
+
+func (s *logStore) drop(trashName string) {
+	entry, ok := s.byName[trashName]
+	if !ok {
+		return
+	}
+	delete(s.byName, trashName)
+	if names, ok := s.byOriginal[entry.OriginalPath]; ok {
+		delete(names, trashName)
+		if len(names) == 0 {
+			delete(s.byOriginal, entry.OriginalPath)
+		}
+	}
+}
+
+func (s *logStore) CheckWritable() error {
+	return CheckWritable(s.indexPath)
+}
+
+func (s *logStore) appendRecords(records []journalRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := s.CheckWritable(); err != nil {
+		return err
+	}
+
+	if s.journal == nil {
+		journal, err := os.OpenFile(s.journalPath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		if err := trimTornTail(journal); err != nil {
+			journal.Close()
+			return err
+		}
+		s.journal = journal
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	_, err := s.journal.Write(buf.Bytes())
+	return err
+}
+
+// trimTornTail cuts the journal back to its last newline. replay skips
+// what a crash left after it, but a record appended behind such a fragment
+// would end up on the same line and make the journal unreadable.
+func trimTornTail(journal *os.File) error {
+	info, err := journal.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+	buf := make([]byte, 4096)
+	for offset := end; offset > 0; {
+		n := min(int64(len(buf)), offset)
+		offset -= n
+		if _, err := journal.ReadAt(buf[:n], offset); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if keep := offset + int64(i) + 1; keep < end {
+				return journal.Truncate(keep)
+			}
+			return nil
+		}
+	}
+	if end > 0 {
+		return journal.Truncate(0)
+	}
+	return nil
+}
+
+func (s *logStore) Add(entries ...TrashInfo) error {
+	records := make([]journalRecord, len(entries))
+	for i := range entries {
+		records[i] = journalRecord{Op: "add", Entry: &entries[i]}
+	}
+	if err := s.appendRecords(records); err != nil {
+		return err
+	}
+	if s.loaded {
+		for _, entry := range entries {
+			s.put(entry)
+		}
+	}
+	return nil
+}
+
+func (s *logStore) Get(trashName string) (TrashInfo, bool, error) {
+	if err := s.load(); err != nil {
+		return TrashInfo{}, false, err
+	}
+	entry, ok := s.byName[trashName]
+	return entry, ok, nil
+}
+
+func (s *logStore) FindByOriginalPath(path string) ([]TrashInfo, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	var entries []TrashInfo
+	for name := range s.byOriginal[path] {
+		entries = append(entries, s.byName[name])
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *logStore) Remove(trashNames ...string) error {
+	records := make([]journalRecord, len(trashNames))
+	for i, name := range trashNames {
+		records[i] = journalRecord{Op: "remove", Name: name}
+	}
+	if err := s.appendRecords(records); err != nil {
+		return err
+	}
+	if s.loaded {
+		for _, name := range trashNames {
+			s.drop(name)
+		}
+	}
+	return nil
+}
+
+func (s *logStore) All() ([]TrashInfo, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s.entries(), nil
+}
+
+func (s *logStore) entries() []TrashInfo {
+	entries := make([]TrashInfo, 0, len(s.byName))
+	for _, entry := range s.byName {
+		entries = append(entries, entry)
+	}
+	sortEntries(entries)
+	return entries
+}
+
+func (s *logStore) Replace(entries []TrashInfo) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := SaveTrashInfo(s.indexPath, entries); err != nil {
+		return err
+	}
+	if err := s.truncateJournal(); err != nil {
+		return err
+	}
+
+	s.reset(entries)
+	s.loaded = true
+	return nil
+}
+
+func (s *logStore) truncateJournal() error {
+	if s.journal != nil {
+		if err := s.journal.Close(); err != nil {
+			return err
+		}
+		s.journal = nil
+	}
+	err := os.Remove(s.journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *logStore) compact() error {
+	entries, err := s.All()
+	if err != nil {
+		return err
+	}
+	return s.Replace(entries)
+}
+
+func (s *logStore) Close() error {
+	if s.readOnly {
+		return nil
+	}
+	var err error
+	if info, statErr := os.Stat(s.journalPath); statErr == nil && info.Size() > compactThreshold {
+		err = s.compact()
+	}
+	if s.journal != nil {
+		if closeErr := s.journal.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if unlockErr := unlockFile(s.lock); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+func sortEntries(entries []TrashInfo) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].DeletionDate.Equal(entries[j].DeletionDate) {
+			return entries[i].DeletionDate.Before(entries[j].DeletionDate)
+		}
+		return entries[i].TrashName < entries[j].TrashName
+	})
+}
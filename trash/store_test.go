@@ -0,0 +1,262 @@
+package trash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry(name, originalPath string, age time.Duration) TrashInfo {
+	return TrashInfo{
+		TrashName:    name,
+		OriginalPath: originalPath,
+		DeletionDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(-age),
+	}
+}
+
+func entryNames(t *testing.T, store Store) string {
+	t.Helper()
+	entries, err := store.All()
+	if err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.TrashName+"="+entry.OriginalPath)
+	}
+	return strings.Join(names, " ")
+}
+
+func openTestStore(t *testing.T, indexPath string) Store {
+	t.Helper()
+	store, err := OpenStoreAt(indexPath)
+	if err != nil {
+		t.Fatalf("OpenStoreAt: %v", err)
+	}
+	return store
+}
+
+func TestJournalReplay(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "state", "trash.json")
+	store := openTestStore(t, indexPath)
+	if err := store.Add(testEntry("a", "/work/a", 3*time.Hour), testEntry("b", "/work/b", 2*time.Hour)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := store.Add(testEntry("c", "/work/a", time.Hour)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := store.Remove("b"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	// Adding a name again replaces its entry.
+	if err := store.Add(testEntry("a", "/work/moved", 3*time.Hour)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(indexPath); !os.IsNotExist(err) {
+		t.Fatalf("changes rewrote the snapshot: %v", err)
+	}
+
+	store = openTestStore(t, indexPath)
+	defer store.Close()
+	if got, want := entryNames(t, store), "a=/work/moved c=/work/a"; got != want {
+		t.Fatalf("replayed entries %q, want %q", got, want)
+	}
+	if entries, err := store.FindByOriginalPath("/work/a"); err != nil || len(entries) != 1 || entries[0].TrashName != "c" {
+		t.Fatalf("FindByOriginalPath: %+v, %v", entries, err)
+	}
+	if _, ok, err := store.Get("b"); ok || err != nil {
+		t.Fatalf("removed entry found: %v, %v", ok, err)
+	}
+}
+
+func TestJournalTornAndCorruptLines(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "trash.json")
+	store := openTestStore(t, indexPath)
+	if err := store.Add(testEntry("a", "/work/a", 0)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	store.Close()
+
+	journalPath := journalPathFor(indexPath)
+	journal, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A crash in the middle of an append leaves a line without a newline.
+	if _, err := journal.WriteString(`{"op":"add","entry":{"trash_name":"b"`); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	store = openTestStore(t, indexPath)
+	if got := entryNames(t, store); got != "a=/work/a" {
+		t.Fatalf("entries with a torn last line: %q", got)
+	}
+	// The next append must not land on the end of the fragment.
+	if err := store.Add(testEntry("c", "/work/c", 0)); err != nil {
+		t.Fatalf("Add after a torn line: %v", err)
+	}
+	store.Close()
+
+	store = openTestStore(t, indexPath)
+	if got := entryNames(t, store); got != "a=/work/a c=/work/c" {
+		t.Fatalf("entries after appending to a torn journal: %q", got)
+	}
+	store.Close()
+
+	if err := os.WriteFile(journalPath, []byte("{\"op\":\"remove\",\"name\":\"a\"}\nnot json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store = openTestStore(t, indexPath)
+	defer store.Close()
+	var corruptErr *IndexCorruptError
+	if _, err := store.All(); !errors.As(err, &corruptErr) || corruptErr.Line != 2 || corruptErr.Path != journalPath {
+		t.Fatalf("All with a corrupt line: %v", err)
+	}
+}
+
+func TestCloseCompactsLargeJournal(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "trash.json")
+	store := openTestStore(t, indexPath)
+	if err := store.Add(testEntry("a", "/work/a", time.Hour), testEntry("b", "/work/b", 0)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := store.Remove("a"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	store.Close()
+
+	// A small journal stays as it is.
+	if _, err := os.Stat(journalPathFor(indexPath)); err != nil {
+		t.Fatalf("journal after a small Close: %v", err)
+	}
+
+	// Blank lines are skipped on replay, so they grow the journal past the
+	// threshold without changing what it says.
+	journal, err := os.OpenFile(journalPathFor(indexPath), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Write(bytes.Repeat([]byte("\n"), compactThreshold+1)); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	store = openTestStore(t, indexPath)
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(journalPathFor(indexPath)); !os.IsNotExist(err) {
+		t.Fatalf("journal left after compaction: %v", err)
+	}
+	entries, version, err := readIndex(indexPath)
+	if err != nil || version != IndexVersion || len(entries) != 1 || entries[0].TrashName != "b" {
+		t.Fatalf("compacted snapshot: %+v, version %d, %v", entries, version, err)
+	}
+}
+
+func TestMigrateVersion1Index(t *testing.T) {
+	for _, tc := range []struct {
+		name, index, want string
+	}{
+		{"array", `[{"trash_name":"a","original_path":"/work/a"}]`, "a=/work/a"},
+		{"null", "null", ""},
+		{"empty file", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexPath := filepath.Join(t.TempDir(), "trash.json")
+			if err := os.WriteFile(indexPath, []byte(tc.index), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			store := openTestStore(t, indexPath)
+			if got := entryNames(t, store); got != tc.want {
+				t.Fatalf("entries %q, want %q", got, tc.want)
+			}
+			store.Close()
+
+			backup, err := os.ReadFile(indexPath + ".v1.bak")
+			if err != nil || string(backup) != tc.index {
+				t.Fatalf("backup %q, %v; want the original index", backup, err)
+			}
+			if version, err := peekVersion(indexPath); err != nil || version != IndexVersion {
+				t.Fatalf("version after migration %d, %v", version, err)
+			}
+		})
+	}
+}
+
+func TestIndexTooNewOrCorrupt(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "trash.json")
+	newer := fmt.Sprintf(`{"version": %d, "entries": []}`, IndexVersion+1)
+	if err := os.WriteFile(indexPath, []byte(newer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := openTestStore(t, indexPath)
+	if err := store.CheckWritable(); !errors.Is(err, ErrIndexTooNew) {
+		t.Fatalf("CheckWritable of a newer index: %v, want ErrIndexTooNew", err)
+	}
+	if err := store.Add(testEntry("a", "/work/a", 0)); !errors.Is(err, ErrIndexTooNew) {
+		t.Fatalf("Add to a newer index: %v, want ErrIndexTooNew", err)
+	}
+	store.Close()
+
+	for _, index := range []string{`{"entries": []}`, `{"version": 0}`, `"x"`} {
+		if err := os.WriteFile(indexPath, []byte(index), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := readIndex(indexPath); !errors.Is(err, ErrIndexCorrupt) {
+			t.Fatalf("readIndex(%s): %v, want ErrIndexCorrupt", index, err)
+		}
+	}
+}
+
+func TestOpenStoreReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "trash.json")
+	index := `[{"trash_name":"a","original_path":"/work/a"}]`
+	if err := os.WriteFile(indexPath, []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenStoreReadOnly(indexPath)
+	if err != nil {
+		t.Fatalf("OpenStoreReadOnly: %v", err)
+	}
+	if got := entryNames(t, store); got != "a=/work/a" {
+		t.Fatalf("entries %q", got)
+	}
+	if err := store.Add(testEntry("b", "/work/b", 0)); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Add: %v, want ErrReadOnly", err)
+	}
+	if err := store.Replace(nil); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Replace: %v, want ErrReadOnly", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files next to the index: %v, %v", files, err)
+	}
+	if data, _ := os.ReadFile(indexPath); string(data) != index {
+		t.Fatalf("index rewritten: %s", data)
+	}
+
+	missing, err := OpenStoreReadOnly(filepath.Join(dir, "missing", "trash.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := entryNames(t, missing); got != "" {
+		t.Fatalf("entries of a missing index: %q", got)
+	}
+}
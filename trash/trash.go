@@ -1,8 +1,8 @@
 package trash
 
 import (
+	"brm/config"
 	"encoding/json"
-	"errors"
 	"os"
 	"path/filepath"
 	"time"
@@ -12,15 +12,72 @@ type TrashInfo struct {
 	TrashName    string    `json:"trash_name"`
 	OriginalPath string    `json:"original_path"`
 	DeletionDate time.Time `json:"deletion_date"`
+	Metadata     *Metadata `json:"metadata,omitempty"`
+	// EncryptedPath replaces OriginalPath when paths are encrypted.
+	EncryptedPath string `json:"encrypted_path,omitempty"`
+	// Storage is how the item is kept in the trash: StoragePlain,
+	// StorageTarGzip, StorageDedup or StorageEncrypted.
+	Storage    string `json:"storage,omitempty"`
+	StoredSize int64  `json:"stored_size,omitempty"`
+	// Blobs lists the files of a StorageDedup item kept in the blob store.
+	Blobs []Blob `json:"blobs,omitempty"`
+}
+
+const (
+	StoragePlain     = ""
+	StorageTarGzip   = "tar.gz"
+	StorageDedup     = "dedup"
+	StorageEncrypted = "encrypted"
+)
+
+// StoredName is the name of the item inside the trash directory, which
+// differs from TrashName for archived and encrypted items.
+func (e TrashInfo) StoredName() string {
+	switch e.Storage {
+	case StorageTarGzip:
+		return e.TrashName + ".tar.gz"
+	case StorageEncrypted:
+		return e.TrashName + ".enc"
+	}
+	return e.TrashName
+}
+
+type Metadata struct {
+	Size          int64       `json:"size"`
+	FileCount     int64       `json:"file_count"`
+	Mode          os.FileMode `json:"mode"`
+	UID           uint32      `json:"uid"`
+	GID           uint32      `json:"gid"`
+	ModTime       time.Time   `json:"mtime"`
+	Inode         uint64      `json:"inode,omitempty"`
+	Device        uint64      `json:"device,omitempty"`
+	SymlinkTarget string      `json:"symlink_target,omitempty"`
+	SHA256        string      `json:"sha256,omitempty"`
+	DeletedBy     string      `json:"deleted_by,omitempty"`
+	Hostname      string      `json:"hostname,omitempty"`
+	Cwd           string      `json:"cwd,omitempty"`
+	CommandLine   []string    `json:"command_line,omitempty"`
+	// SizeUnknown is set when a directory could not be walked completely;
+	// Size and FileCount then count only what could be read.
+	SizeUnknown bool `json:"size_unknown,omitempty"`
+}
+
+// TrashInfoPath is where the default index lives, ~/.brm/trash.json. Unlike
+// GetTrashInfoPath it creates nothing.
+func TrashInfoPath() (string, error) {
+	dirPath, err := config.GetStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dirPath, "trash.json"), nil
 }
 
 func GetTrashInfoPath() (string, error) {
-	home, err := os.UserHomeDir()
+	filePath, err := TrashInfoPath()
 	if err != nil {
-		return "", errors.New("cannot determine user home directory")
+		return "", err
 	}
-	dirPath := filepath.Join(home, ".brm")
-	filePath := filepath.Join(dirPath, "trash.json")
+	dirPath := filepath.Dir(filePath)
 
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
 		err = os.MkdirAll(dirPath, 0755)
@@ -30,7 +87,7 @@ func GetTrashInfoPath() (string, error) {
 	}
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		err = os.WriteFile(filePath, []byte("[]"), 0644)
+		err = SaveTrashInfo(filePath, []TrashInfo{})
 		if err != nil {
 			return "", err
 		}
@@ -40,6 +97,13 @@ func GetTrashInfoPath() (string, error) {
 }
 
 func SaveTrashInfo(path string, entries []TrashInfo) error {
+	if err := CheckWritable(path); err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []TrashInfo{}
+	}
+
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -48,63 +112,36 @@ func SaveTrashInfo(path string, entries []TrashInfo) error {
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(entries)
+	return encoder.Encode(indexFile{Version: IndexVersion, Entries: entries})
 }
 
 func LoadTrashInfo(path string) ([]TrashInfo, error) {
-	file, err := os.Open(path)
+	entries, version, err := readIndex(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	var entries []TrashInfo
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&entries)
-	return entries, err
-}
-
-func AddTrashInfoEntry(entry TrashInfo) error {
-	var entries []TrashInfo
-
-	filePath, err := GetTrashInfoPath()
-	if err != nil {
-		return err
-	}
-
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return err
-	}
-
-	if stat.Size() > 0 {
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&entries); err != nil {
-			entries = []TrashInfo{}
+	if version < IndexVersion {
+		if err := backupBeforeMigration(path, version); err != nil {
+			return nil, err
+		}
+		if err := SaveTrashInfo(path, entries); err != nil {
+			return nil, err
 		}
 	}
 
-	entries = append(entries, entry)
-
-	if _, err := file.Seek(0, 0); err != nil {
-		return err
-	}
+	return entries, nil
+}
 
-	if err := file.Truncate(0); err != nil {
+func AddTrashInfoEntry(entry TrashInfo) error {
+	store, err := OpenStore()
+	if err != nil {
 		return err
 	}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(entries); err != nil {
+	if err := store.Add(entry); err != nil {
+		store.Close()
 		return err
 	}
-
-	return nil
+	return store.Close()
 }
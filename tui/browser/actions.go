@@ -2,9 +2,9 @@ package browser
 
 import (
 	"brm/actions"
-	"brm/trash"
+	"brm/flags"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"brm/localization"
@@ -12,22 +12,22 @@ import (
 
 func (m *Model) restoreSelected() {
 	if !m.isInTrash() {
-		m.err = fmt.Errorf("%s", localization.GetMessage("restoration_only_in_trash"))
+		m.err = errors.New(localization.GetMessage("restoration_only_in_trash"))
 		return
 	}
 	if len(m.selected) == 0 {
-		m.err = fmt.Errorf("%s", localization.GetMessage("no_files_selected"))
+		m.err = errors.New(localization.GetMessage("no_files_selected"))
 		return
 	}
 	err := actions.Restore()
 	if err != nil {
-		m.err = fmt.Errorf("%s", localization.GetMessage("error_restoring_file", "files", err))
+		m.err = errors.New(localization.GetMessage("error_restoring_file", "files", flags.ErrorMessage(err)))
 		return
 	}
 	m.selected = make(map[string]struct{})
 	entries, err := readDirSorted(m.path)
 	if err != nil {
-		m.err = fmt.Errorf("%s", localization.GetMessage("failed_to_refresh_directory", err))
+		m.err = errors.New(localization.GetMessage("failed_to_refresh_directory", flags.ErrorMessage(err)))
 		return
 	}
 	m.entries = entries
@@ -36,7 +36,7 @@ func (m *Model) restoreSelected() {
 
 func (m *Model) restoreVisualSelected() {
 	if !m.isInTrash() {
-		m.err = fmt.Errorf("%s", localization.GetMessage("restoration_only_in_trash"))
+		m.err = errors.New(localization.GetMessage("restoration_only_in_trash"))
 		return
 	}
 	if !m.visualMode {
@@ -46,44 +46,33 @@ func (m *Model) restoreVisualSelected() {
 	if start > end {
 		start, end = end, start
 	}
+	var names []string
 	for i := start; i <= end && i < len(m.entries); i++ {
-		entry := m.entries[i]
-		fullPath := filepath.Join(m.path, entry.Name())
-		trashInfoPath, err := trash.GetTrashInfoPath()
-		if err != nil {
-			m.err = fmt.Errorf("%s", localization.GetMessage("unable_to_get_trash_info_path", err))
-			return
-		}
-		entries, err := trash.LoadTrashInfo(trashInfoPath)
-		if err != nil {
-			m.err = fmt.Errorf("%s", localization.GetMessage("unable_to_load_trash_info", err))
-			return
-		}
-		found := false
-		for _, info := range entries {
-			if info.TrashName == entry.Name() {
-				restoreErr := os.Rename(fullPath, info.OriginalPath)
-				if restoreErr != nil {
-					m.err = fmt.Errorf("%s", localization.GetMessage("error_restoring_file", fullPath, restoreErr))
-					return
-				}
-				err := trash.SaveTrashInfo(trashInfoPath, removeTrashInfo(entries, info))
-				if err != nil {
-					m.err = fmt.Errorf("%s", localization.GetMessage("unable_to_update_trash_info", err))
-					return
-				}
-				found = true
-				break
-			}
-		}
-		if !found {
-			m.err = fmt.Errorf("%s", localization.GetMessage("could_not_find_original_path_for", entry.Name()))
-			return
+		names = append(names, m.entries[i].Name())
+	}
+	// The first failure is shown; the other items are still restored.
+	var restoreErr error
+	err := actions.RestoreItems(names, func(name string, err error) {
+		switch {
+		case restoreErr != nil || err == nil:
+		case errors.Is(err, actions.ErrNotInTrash):
+			restoreErr = errors.New(localization.GetMessage("could_not_find_original_path_for", name))
+		default:
+			fullPath := filepath.Join(m.path, name)
+			restoreErr = errors.New(localization.GetMessage("error_restoring_file", fullPath, flags.ErrorMessage(err)))
 		}
+	})
+	if err != nil {
+		m.err = errors.New(localization.GetMessage("unable_to_load_trash_info", flags.ErrorMessage(err)))
+		return
+	}
+	if restoreErr != nil {
+		m.err = restoreErr
+		return
 	}
 	entries, err := readDirSorted(m.path)
 	if err != nil {
-		m.err = fmt.Errorf("%s", localization.GetMessage("failed_to_refresh_directory", err))
+		m.err = errors.New(localization.GetMessage("failed_to_refresh_directory", flags.ErrorMessage(err)))
 		return
 	}
 	m.entries = entries
@@ -91,57 +80,53 @@ func (m *Model) restoreVisualSelected() {
 	m.err = nil
 }
 
-func (m *Model) deleteSelected() {
+func (m *Model) deleteSelected(purgeOpts actions.PurgeOptions) {
 	if len(m.selected) == 0 && !m.visualMode && m.cursor < len(m.entries) {
 		entry := m.entries[m.cursor]
 		fullPath := filepath.Join(m.path, entry.Name())
-		confirmed, err := confirmDeletePrompt(1)
+		confirmed, err := confirmDeletePrompt(1, purgeOpts.Shred != nil)
 		if err != nil || !confirmed {
-			m.err = fmt.Errorf("%s", localization.GetMessage("deletion_cancelled_by_user"))
+			m.err = errors.New(localization.GetMessage("deletion_cancelled_by_user"))
 			return
 		}
 		if m.isInTrash() {
-			if entry.IsDir() {
-				err = os.RemoveAll(fullPath)
-			} else {
-				err = os.Remove(fullPath)
-			}
+			err = actions.PermanentDelete(fullPath, purgeOpts)
 			if err != nil {
-				m.err = fmt.Errorf("%s", localization.GetMessage("error_deleting_file", fullPath, err))
+				m.err = errors.New(localization.GetMessage("error_deleting_file", fullPath, flags.ErrorMessage(err)))
 				return
 			}
 		} else {
-			err = actions.SaveDelete(fullPath)
+			err = actions.SaveDelete(fullPath, actions.DeleteOptions{})
 			if err != nil {
-				m.err = fmt.Errorf("%s", localization.GetMessage("error_deleting_file", fullPath, err))
+				m.err = errors.New(localization.GetMessage("error_deleting_file", fullPath, flags.ErrorMessage(err)))
 				return
 			}
 		}
 	} else if len(m.selected) > 0 {
-		confirmed, err := confirmDeletePrompt(len(m.selected))
+		confirmed, err := confirmDeletePrompt(len(m.selected), purgeOpts.Shred != nil)
 		if err != nil || !confirmed {
-			m.err = fmt.Errorf("%s", localization.GetMessage("deletion_cancelled_by_user"))
+			m.err = errors.New(localization.GetMessage("deletion_cancelled_by_user"))
 			return
 		}
 		for path := range m.selected {
 			if m.isInTrash() {
-				err = os.RemoveAll(path)
+				err = actions.PermanentDelete(path, purgeOpts)
 			} else {
-				err = actions.SaveDelete(path)
+				err = actions.SaveDelete(path, actions.DeleteOptions{})
 			}
 			if err != nil {
-				m.err = fmt.Errorf("%s", localization.GetMessage("error_deleting_file", path, err))
+				m.err = errors.New(localization.GetMessage("error_deleting_file", path, flags.ErrorMessage(err)))
 				return
 			}
 			delete(m.selected, path)
 		}
 	} else if m.visualMode {
-		m.deleteVisualSelected()
+		m.deleteVisualSelected(purgeOpts)
 		return
 	}
 	entries, err := readDirSorted(m.path)
 	if err != nil {
-		m.err = fmt.Errorf("%s", localization.GetMessage("error_refreshing_directory", err))
+		m.err = errors.New(localization.GetMessage("error_refreshing_directory", flags.ErrorMessage(err)))
 		return
 	}
 	if m.cursor > 0 && len(entries) <= m.cursor {
@@ -151,7 +136,7 @@ func (m *Model) deleteSelected() {
 	m.err = nil
 }
 
-func (m *Model) deleteVisualSelected() {
+func (m *Model) deleteVisualSelected(purgeOpts actions.PurgeOptions) {
 	if !m.visualMode {
 		return
 	}
@@ -164,33 +149,77 @@ func (m *Model) deleteVisualSelected() {
 		fullPath := filepath.Join(m.path, m.entries[i].Name())
 		pathsToDelete = append(pathsToDelete, fullPath)
 	}
-	confirmed, err := confirmDeletePrompt(len(pathsToDelete))
+	confirmed, err := confirmDeletePrompt(len(pathsToDelete), purgeOpts.Shred != nil)
 	if err != nil || !confirmed {
-		m.err = fmt.Errorf("%s", localization.GetMessage("deletion_cancelled_by_user"))
+		m.err = errors.New(localization.GetMessage("deletion_cancelled_by_user"))
 		return
 	}
 	inTrash := m.isInTrash()
 	for _, path := range pathsToDelete {
 		if inTrash {
-			err = os.RemoveAll(path)
+			err = actions.PermanentDelete(path, purgeOpts)
 			if err != nil {
-				m.err = fmt.Errorf("%s", localization.GetMessage("error_deleting_file", path, err))
+				m.err = errors.New(localization.GetMessage("error_deleting_file", path, flags.ErrorMessage(err)))
 				return
 			}
 		} else {
-			err = actions.SaveDelete(path)
+			err = actions.SaveDelete(path, actions.DeleteOptions{})
 			if err != nil {
-				m.err = fmt.Errorf("%s", localization.GetMessage("error_deleting_file", path, err))
+				m.err = errors.New(localization.GetMessage("error_deleting_file", path, flags.ErrorMessage(err)))
 				return
 			}
 		}
 	}
 	entries, err := readDirSorted(m.path)
 	if err != nil {
-		m.err = fmt.Errorf("%s", localization.GetMessage("error_refreshing_directory", err))
+		m.err = errors.New(localization.GetMessage("error_refreshing_directory", flags.ErrorMessage(err)))
 		return
 	}
 	m.entries = entries
 	m.cursor = 0
 	m.err = nil
 }
+
+func (m *Model) shredSelected() {
+	shredOpts := actions.DefaultShredOptions()
+	var linked string
+	shredOpts.OnLinked = func(path string) {
+		if linked == "" {
+			linked = path
+		}
+	}
+	purgeOpts := actions.PurgeOptions{Shred: &shredOpts}
+	if m.visualMode {
+		m.deleteVisualSelected(purgeOpts)
+		m.visualMode = false
+	} else {
+		m.deleteSelected(purgeOpts)
+	}
+	if m.err == nil && linked != "" {
+		m.err = errors.New(localization.GetMessage("shred_warning_linked", linked))
+	}
+	if m.err == nil {
+		if warning := actions.ShredWarning(m.path); warning != "" {
+			m.err = fmt.Errorf("%s", warning)
+		}
+	}
+}
+
+const (
+	previewBytes = 4096
+	previewLines = 10
+)
+
+func (m *Model) previewSelected() {
+	if m.cursor >= len(m.entries) {
+		return
+	}
+	name := m.entries[m.cursor].Name()
+	preview, err := actions.Preview(name, previewBytes)
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.preview, m.previewName = preview, name
+	m.err = nil
+}
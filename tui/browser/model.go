@@ -1,6 +1,8 @@
 package browser
 
 import (
+	"brm/actions"
+	"brm/trash"
 	"os"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -16,6 +18,10 @@ type Model struct {
 	selected    map[string]struct{}
 	visualMode  bool
 	visualStart int
+	trashInfo   map[string]trash.TrashInfo
+	trashStats  *actions.TrashStats
+	preview     []byte
+	previewName string
 }
 
 func NewModel(startPath string) Model {
@@ -1,8 +1,9 @@
 package browser
 
 import (
+	"brm/actions"
 	"brm/localization"
-	"fmt"
+	"errors"
 	"path/filepath"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -33,6 +34,9 @@ func (m *Model) openDir() {
 			m.entries = entries
 			m.cursor = 0
 			m.err = nil
+			if m.isInTrash() {
+				m.loadTrashInfo()
+			}
 		} else {
 			m.err = err
 		}
@@ -47,6 +51,9 @@ func (m *Model) goBack() {
 		m.entries = entries
 		m.cursor = 0
 		m.err = nil
+		if m.isInTrash() {
+			m.loadTrashInfo()
+		}
 	} else {
 		m.err = err
 	}
@@ -85,14 +92,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.restoreSelected()
 				}
 			} else {
-				m.err = fmt.Errorf("%s", localization.GetMessage("restoration_only_in_trash"))
+				m.err = errors.New(localization.GetMessage("restoration_only_in_trash"))
 			}
 		case "d", "delete":
 			if m.visualMode {
-				m.deleteVisualSelected()
+				m.deleteVisualSelected(actions.PurgeOptions{})
 				m.visualMode = false
 			} else {
-				m.deleteSelected()
+				m.deleteSelected(actions.PurgeOptions{})
+			}
+		case "S":
+			if m.isInTrash() {
+				m.shredSelected()
+			}
+		case "p":
+			if m.isInTrash() {
+				m.previewSelected()
 			}
 		}
 	case tea.WindowSizeMsg:
@@ -101,4 +116,3 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 	return m, nil
 }
-
@@ -2,41 +2,109 @@ package browser
 
 import (
 	"brm/actions"
+	"brm/flags"
+	"brm/localization"
 	"brm/trash"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"time"
 )
 
 func (m *Model) isInTrash() bool {
 	path, err := actions.GetTrashPath()
-	m.err = fmt.Errorf("cannot open trash: %v", err)
+	if err != nil {
+		m.err = fmt.Errorf("%s: %s", localization.GetMessage("cannot_open_trash"), flags.ErrorMessage(err))
+		return false
+	}
 	return m.path == path
 }
 
 func (m *Model) openTrash() {
-	homeDir, err := os.UserHomeDir()
+	trashPath, err := actions.GetTrashPath()
 	if err != nil {
-		m.err = fmt.Errorf("cannot determine home directory: %v", err)
+		m.err = fmt.Errorf("%s: %s", localization.GetMessage("cannot_open_trash"), flags.ErrorMessage(err))
 		return
 	}
-	trashPath := filepath.Join(homeDir, ".trash")
 	entries, err := readDirSorted(trashPath)
 	if err != nil {
-		m.err = fmt.Errorf("cannot open trash: %v", err)
+		m.err = fmt.Errorf("%s: %s", localization.GetMessage("cannot_open_trash"), flags.ErrorMessage(err))
 		return
 	}
 	m.path = trashPath
 	m.entries = entries
 	m.cursor = 0
 	m.err = nil
+	m.loadTrashInfo()
+}
+
+func (m *Model) loadTrashInfo() {
+	m.trashInfo = make(map[string]trash.TrashInfo)
+	m.trashStats = nil
+	t, err := actions.DefaultTrash()
+	if err != nil {
+		return
+	}
+	if stats, err := actions.StatsTrash(t, time.Now(), 1); err == nil {
+		m.trashStats = &stats
+	}
+	entries, err := t.List()
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		m.trashInfo[entry.StoredName()] = entry
+	}
+}
+
+// blobEntry stands for a deduplicated file, which exists only in the blob store.
+type blobEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e blobEntry) Name() string {
+	return e.name
 }
 
-func removeTrashInfo(list []trash.TrashInfo, entry trash.TrashInfo) []trash.TrashInfo {
-	for i, v := range list {
-		if v.TrashName == entry.TrashName {
-			return append(list[:i], list[i+1:]...)
+// withTrashItems hides the blob store of the trash at path and lists
+// deduplicated files in its place. Other directories are left as they are.
+func withTrashItems(path string, entries []os.DirEntry) []os.DirEntry {
+	trashPath, err := actions.GetTrashPath()
+	if err != nil || path != trashPath {
+		return entries
+	}
+
+	present := make(map[string]bool, len(entries))
+	items := make([]os.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name() == trash.BlobDirName {
+			continue
+		}
+		present[entry.Name()] = true
+		items = append(items, entry)
+	}
+
+	t, err := actions.DefaultTrash()
+	if err != nil {
+		return items
+	}
+	trashInfo, err := t.List()
+	if err != nil {
+		return items
+	}
+	for _, info := range trashInfo {
+		if info.Storage != trash.StorageDedup || present[info.StoredName()] {
+			continue
+		}
+		for _, blob := range info.Blobs {
+			if blob.Path != "." {
+				continue
+			}
+			if blobInfo, err := os.Lstat(trash.BlobPath(trashPath, blob.SHA256)); err == nil {
+				items = append(items, blobEntry{fs.FileInfoToDirEntry(blobInfo), info.TrashName})
+			}
 		}
 	}
-	return list
+	return items
 }
@@ -2,6 +2,9 @@ package browser
 
 import (
 	"brm/localization"
+	"brm/trash"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -31,6 +34,7 @@ func readDirSorted(path string) ([]os.DirEntry, error) {
 	if err != nil {
 		return nil, err
 	}
+	entries = withTrashItems(path, entries)
 	sort.Slice(entries, func(i, j int) bool {
 		iIsDir := entries[i].IsDir()
 		jIsDir := entries[j].IsDir()
@@ -45,9 +49,13 @@ func readDirSorted(path string) ([]os.DirEntry, error) {
 	return entries, nil
 }
 
-func confirmDeletePrompt(count int) (bool, error) {
+// confirmDeletePrompt asks before count items are deleted, or shredded
+// when shred is set, since that cannot be undone even from the trash.
+func confirmDeletePrompt(count int, shred bool) (bool, error) {
 	var label string
-	if count == 1 {
+	if shred {
+		label = localization.GetMessage("confirm_shred_files", count)
+	} else if count == 1 {
 		label = localization.GetMessage("confirm_delete_file", "")
 	} else {
 		label = localization.GetMessage("confirm_delete_files", count)
@@ -58,7 +66,7 @@ func confirmDeletePrompt(count int) (bool, error) {
 	}
 	result, err := prompt.Run()
 	if err != nil {
-		return false, fmt.Errorf("%s", localization.GetMessage("deletion_cancelled_by_user"))
+		return false, errors.New(localization.GetMessage("deletion_cancelled_by_user"))
 	}
 	answer := strings.ToLower(strings.TrimSpace(result))
 	return answer == "y" || answer == "", nil
@@ -86,7 +94,7 @@ func (m Model) renderHeader() string {
 func (m Model) renderFooter() string {
 	footerContent := "↑/↓ or j/k — move, Enter/l — open dir, Backspace/h — up, v — visual mode, T — trash, d/delete — delete, q — quit"
 	if m.isInTrash() {
-		footerContent += " | R — restore"
+		footerContent += " | R — restore, S — shred, p — preview"
 	}
 	footerContentWidth := runewidth.StringWidth(footerContent)
 	padding := max(0, m.width-footerContentWidth)
@@ -149,6 +157,79 @@ func (m Model) renderEntries() string {
 	return s.String()
 }
 
+func (m Model) renderStats() string {
+	if !m.isInTrash() || m.trashStats == nil || m.trashStats.Items == 0 {
+		return ""
+	}
+	stats := m.trashStats
+	largestDir := stats.ByDirectory[0]
+	line := localization.GetMessage("stats_panel", stats.Items, trash.FormatSize(stats.TotalSize),
+		trash.FormatSize(stats.StoredSize), fmt.Sprintf("%s (%s)", largestDir.Key, trash.FormatSize(largestDir.Size)))
+
+	ages := make([]string, 0, len(stats.ByAge))
+	for _, group := range stats.ByAge {
+		if group.Count > 0 {
+			ages = append(ages, fmt.Sprintf("%s: %d", group.Key, group.Count))
+		}
+	}
+	line += " | " + strings.Join(ages, ", ")
+	if m.width > 0 && runewidth.StringWidth(line) > m.width {
+		line = runewidth.Truncate(line, m.width-3, "...")
+	}
+	return fmt.Sprintf("%s%s%s\n", FgYellow, line, Reset)
+}
+
+func (m Model) renderDetails() string {
+	if !m.isInTrash() || m.cursor >= len(m.entries) {
+		return ""
+	}
+	info, ok := m.trashInfo[m.entries[m.cursor].Name()]
+	if !ok {
+		return ""
+	}
+	originalPath := info.OriginalPath
+	if originalPath == "" && info.EncryptedPath != "" {
+		originalPath = localization.GetMessage("encrypted_path")
+	}
+	line := originalPath
+	if md := info.Metadata; md != nil {
+		owner := md.DeletedBy
+		if md.Hostname != "" {
+			owner += "@" + md.Hostname
+		}
+		line = localization.GetMessage("details_line", originalPath,
+			info.DeletionDate.Local().Format("2006-01-02 15:04"), owner,
+			md.FormatSize(), md.FileCount, md.Mode)
+	}
+	if m.width > 0 && runewidth.StringWidth(line) > m.width {
+		line = runewidth.Truncate(line, m.width-3, "...")
+	}
+	return fmt.Sprintf("%s%s%s\n", FgCyan, line, Reset)
+}
+
+func (m Model) renderPreview() string {
+	if m.preview == nil || m.cursor >= len(m.entries) || m.entries[m.cursor].Name() != m.previewName {
+		return ""
+	}
+	if bytes.IndexByte(m.preview, 0) >= 0 {
+		return localization.GetMessage("preview_binary", len(m.preview)) + "\n"
+	}
+
+	lines := strings.Split(strings.ToValidUTF8(string(m.preview), "?"), "\n")
+	if len(lines) > previewLines {
+		lines = lines[:previewLines]
+	}
+	var s strings.Builder
+	for _, line := range lines {
+		line = stripAnsi(strings.ReplaceAll(line, "\t", "    "))
+		if m.width > 0 && runewidth.StringWidth(line) > m.width {
+			line = runewidth.Truncate(line, m.width-3, "...")
+		}
+		s.WriteString(line + "\n")
+	}
+	return s.String()
+}
+
 func (m Model) renderSelected() string {
 	if len(m.selected) == 0 {
 		return ""
@@ -178,8 +259,10 @@ func (m Model) View() string {
 	s.WriteString(m.renderHeader())
 	s.WriteString(m.renderEntries())
 	s.WriteString(m.renderFooter())
+	s.WriteString(m.renderStats())
+	s.WriteString(m.renderDetails())
+	s.WriteString(m.renderPreview())
 	s.WriteString(m.renderSelected())
 	s.WriteString(m.renderError())
 	return s.String()
 }
-